@@ -16,6 +16,7 @@ package tiap
 
 import (
 	"archive/tar"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
@@ -27,6 +28,8 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/v1/daemon"
@@ -39,14 +42,56 @@ import (
 type App struct {
 	sourcePath string
 	tmpDir     string
+	keepTmp    bool
 	repo       string
 	project    *ComposerProject
+	digests    *digestCache      // precomputed digests, if any
+	addedFiles map[string]string // package paths of added files to their digests
 }
 
 // DefaultIEAppArch is the denormalized platform architecture name of the
 // default "unnamed" architecture.
 const DefaultIEAppArch = "x86-64"
 
+// IEAppArchitectures lists the IE App architectures recognized by Industrial
+// Edge for the “arch” field of “detail.json”.
+var IEAppArchitectures = []string{DefaultIEAppArch, "arm64"}
+
+// CheckIEAppArch returns an error if the specified IE App architecture isn't
+// one of the IEAppArchitectures, as the Industrial Edge catalog would reject
+// the app package later anyway.
+func CheckIEAppArch(iearch string) error {
+	if !slices.Contains(IEAppArchitectures, iearch) {
+		return fmt.Errorf("unrecognized IE App architecture %q, must be one of %q",
+			iearch, IEAppArchitectures)
+	}
+	return nil
+}
+
+// DetailsFile is the name of the app details file inside app templates and
+// packages, as used by Industrial Edge.
+var DetailsFile = "detail.json"
+
+// MaxFiles limits the number of files copied from an app template into the
+// staging directory, as well as the number of files packaged, as a safety
+// valve against runaway templates, such as accidentally pointing at $HOME.
+// Zero or a negative number means no limit.
+var MaxFiles = 10000
+
+// tooManyFiles returns an error if the specified file count exceeds MaxFiles.
+func tooManyFiles(count int) error {
+	if MaxFiles > 0 && count > MaxFiles {
+		return fmt.Errorf("too many files, exceeding the maximum of %d files", MaxFiles)
+	}
+	return nil
+}
+
+// errComposerInRoot signals a Docker compose project file directly inside the
+// template root, instead of inside the app repository subdirectory.
+var errComposerInRoot = errors.New("Docker compose project file must not be placed in " +
+	"the template root, but instead in the app repository subdirectory " +
+	"(such as “$REPO/docker-compose.yml”)")
+
 // NewApp returns an IE App object initialized from the specified “template”
 // path.
 func NewApp(source string) (a *App, err error) {
@@ -65,26 +110,54 @@ func NewApp(source string) (a *App, err error) {
 	// skip any Docker composer file for now. However, the notice its directory
 	// as the "repository".
 	log.Info(fmt.Sprintf("🏗  creating temporary project copy in %q", tmpDir))
+	staged, err := stagePathFilter()
+	if err != nil {
+		return nil, err
+	}
 	repo := ""
-	err = copy.Copy(source, tmpDir, copy.Options{
-		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
-			if slices.Contains(composerFiles, info.Name()) {
-				repo = filepath.Dir(src)
-				return true, nil
+	files := 0
+	opts, err := stageCopyOptions(func(info os.FileInfo, src, dest string) (bool, error) {
+		if rel, err := filepath.Rel(source, src); err == nil && !staged(rel) {
+			log.Debugf("🐛 not staging %q", rel)
+			return true, nil
+		}
+		if abs, err := filepath.Abs(src); err == nil && slices.Contains(StageExcludes, abs) {
+			log.Debugf("🐛 not staging excluded %q", src)
+			return true, nil
+		}
+		if !info.IsDir() {
+			files++
+			if err := tooManyFiles(files); err != nil {
+				return false, err
 			}
-			return false, nil
-		},
+		}
+		if slices.Contains(composerFiles, info.Name()) {
+			repo = filepath.Dir(src)
+			return true, nil
+		}
+		return false, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	err = copy.Copy(source, tmpDir, opts)
 	if err != nil {
 		return nil, fmt.Errorf("cannot copy app template structure, reason: %w", err)
 	}
 	if repo == "" {
+		if len(StagePaths) != 0 {
+			return nil, fmt.Errorf("project lacks Docker compose project file within stage paths %q",
+				StagePaths)
+		}
 		return nil, errors.New("project lacks Docker compose project file")
 	}
 	repo, err = filepath.Rel(source, repo)
 	if err != nil {
 		return nil, errors.New("cannot determine relative repository path")
 	}
+	if repo == "." {
+		return nil, errComposerInRoot
+	}
 	log.Info(fmt.Sprintf("🫙  app repository detected as %q", repo))
 
 	// Try to locate and load the Docker composer project
@@ -103,8 +176,108 @@ func NewApp(source string) (a *App, err error) {
 	return
 }
 
-// Done removes all temporary work files.
+// ResumeApp returns an IE App object for the specified “template” path, but
+// reusing the existing staging directory “stage” of a previous, interrupted
+// (and kept) run instead of creating a new one. Container images already
+// pulled and saved successfully into the staging directory won't be pulled
+// again. ResumeApp checks that the staging directory looks like a tiap stage
+// for the template before trusting it. The staging directory is always kept.
+func ResumeApp(source string, stage string) (*App, error) {
+	repo, err := findRepo(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStage(stage, repo); err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("♻  resuming with staging directory %q", stage))
+	log.Info(fmt.Sprintf("🫙  app repository detected as %q", repo))
+	project, err := LoadComposerProject(filepath.Join(source, repo))
+	if err != nil {
+		return nil, err
+	}
+	return &App{
+		sourcePath: source,
+		tmpDir:     stage,
+		keepTmp:    true,
+		repo:       repo,
+		project:    project,
+	}, nil
+}
+
+// findRepo returns the relative path of the app repository inside the
+// specified template, that is, the directory containing the Docker compose
+// project file.
+func findRepo(source string) (string, error) {
+	repo := ""
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && slices.Contains(composerFiles, d.Name()) {
+			repo = filepath.Dir(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot read app template structure, reason: %w", err)
+	}
+	if repo == "" {
+		return "", errors.New("project lacks Docker compose project file")
+	}
+	repo, err = filepath.Rel(source, repo)
+	if err != nil {
+		return "", errors.New("cannot determine relative repository path")
+	}
+	if repo == "." {
+		return "", errComposerInRoot
+	}
+	return repo, nil
+}
+
+// checkStage checks that the specified directory looks like a tiap staging
+// directory for an app with the specified repository.
+func checkStage(stage string, repo string) error {
+	if info, err := os.Stat(filepath.Join(stage, DetailsFile)); err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a tiap staging directory: missing %s", stage, DetailsFile)
+	}
+	if info, err := os.Stat(filepath.Join(stage, repo)); err != nil || !info.IsDir() {
+		return fmt.Errorf("%q is not a tiap staging directory: missing app repository %q",
+			stage, repo)
+	}
+	return nil
+}
+
+// detailsPath returns the path of the app details file inside the stage.
+func (a *App) detailsPath() string {
+	return filepath.Join(a.tmpDir, DetailsFile)
+}
+
+// StageDir returns the path of the temporary staging directory.
+func (a *App) StageDir() string {
+	return a.tmpDir
+}
+
+// KeepStage keeps the temporary staging directory when calling Done, so that
+// an interrupted run can be resumed later using ResumeApp.
+func (a *App) KeepStage() {
+	a.keepTmp = true
+}
+
+// AllowLatest permits image references using the “latest” tag, logging only a
+// warning, see also [ComposerProject.AllowLatest].
+func (a *App) AllowLatest() {
+	a.project.AllowLatest()
+}
+
+// Done removes all temporary work files, unless told to keep them.
 func (a *App) Done() {
+	if a.keepTmp {
+		if a.tmpDir != "" {
+			log.Info(fmt.Sprintf("📌  kept staging folder %q", a.tmpDir))
+		}
+		return
+	}
 	if a.tmpDir != "" {
 		os.RemoveAll(a.tmpDir)
 		log.Info(fmt.Sprintf("🧹  removed temporary folder %q", a.tmpDir))
@@ -112,6 +285,43 @@ func (a *App) Done() {
 	}
 }
 
+// Lint checks the app's composer project for common structural mistakes,
+// returning a LintError listing the issues found, if any.
+func (a *App) Lint() error {
+	return a.project.Lint()
+}
+
+// CheckPorts checks that no two services of the app's composer project
+// publish the same host port.
+func (a *App) CheckPorts() error {
+	return a.project.CheckPorts()
+}
+
+// MovingTags returns the services using image tags matching any of the
+// specified patterns, see also [ComposerProject.MovingTags].
+func (a *App) MovingTags(patterns []string) ([]MovingTag, error) {
+	return a.project.MovingTags(patterns)
+}
+
+// SelectProfiles removes the services not in any of the specified active
+// profiles from the app's composer project, see also
+// [ComposerProject.SelectProfiles].
+func (a *App) SelectProfiles(active []string) error {
+	return a.project.SelectProfiles(active)
+}
+
+// QualifyImages rewrites the image references of all services in the app's
+// composer project into their fully-qualified form.
+func (a *App) QualifyImages() error {
+	return a.project.QualifyImages()
+}
+
+// RewriteImages rewrites the image references of all services in the app's
+// composer project, see also [ComposerProject.RewriteImages].
+func (a *App) RewriteImages(rewrite func(ref string) (string, error)) error {
+	return a.project.RewriteImages(rewrite)
+}
+
 // SetDetails sets the semver (“versionNumber”, oh well) of this release, notes
 // (if any) and optional architecture, and then writes a new “detail.json”
 // into the build directory. This automatically sets the versionId to some
@@ -119,11 +329,32 @@ func (a *App) Done() {
 // suitable versionId value.
 func (a *App) SetDetails(semver string, releasenotes string, iearch string) error {
 	return setDetails(
-		filepath.Join(a.tmpDir, "detail.json"),
+		a.detailsPath(),
 		a.repo,
 		semver, releasenotes, iearch)
 }
 
+// SetVersionedDetails sets the release's version number (“versionNumber”)
+// and version ID (“versionId”) verbatim, as well as notes (if any) and optional
+// architecture, and then writes a new “detail.json” into the build directory.
+// Contrary to SetDetails, the version number doesn't need to be a semver, so
+// embedders are free to use their own versioning schemes. If the version ID is
+// empty, it is derived from the version number in the same way as SetDetails
+// does.
+func (a *App) SetVersionedDetails(
+	versionNumber string,
+	versionID string,
+	releasenotes string,
+	iearch string,
+) error {
+	if versionID == "" {
+		versionID = deriveVersionID(versionNumber, a.repo)
+	}
+	return writeDetails(
+		a.detailsPath(),
+		versionNumber, versionID, releasenotes, iearch)
+}
+
 func setDetails(
 	path string,
 	repo string,
@@ -131,43 +362,75 @@ func setDetails(
 	releasenotes string,
 	iearch string,
 ) error {
-	detailJSON, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("cannot read detail.json, reason: %w", err)
-
-	}
-	var details map[string]any
-	err = json.Unmarshal(detailJSON, &details)
-	if err != nil {
-		return fmt.Errorf("malformed detail.json, reason: %w", err)
-	}
+	versionId := deriveVersionID(semver, repo)
+	log.Info(fmt.Sprintf("📛  semver: %q -> app ID: %q", semver, versionId))
+	return writeDetails(path, semver, versionId, releasenotes, iearch)
+}
 
+// deriveVersionID returns a versionId for the specified version number and
+// app repository name.
+func deriveVersionID(versionNumber string, repo string) string {
 	// dunno what versionId encodes, it seems to suffice that it is just a
 	// unique string of 32 characters in the 0-9, a-z, A-Z set. It doesn't seem
 	// to be base64 so base62 could be a good bet. We simply hash the semver
 	// string (even if its low entropy) and the repo dir name.
 	digester := sha256.New()
-	digester.Write([]byte(semver))
+	digester.Write([]byte(versionNumber))
 	digester.Write([]byte(repo))
 	// Thanks to https://ucarion.com/go-base62 for the stdlib (mis)use as a
 	// stock base62 encoder ;)
 	var bi big.Int
 	bi.SetBytes(digester.Sum(nil))
-	versionId := bi.Text(62)[:32]
-	log.Info(fmt.Sprintf("📛  semver: %q -> app ID: %q", semver, versionId))
+	return bi.Text(62)[:32]
+}
+
+// writeDetails updates the “detail.json” at the specified path with the
+// specified version number, version ID, release notes and IE architecture.
+func writeDetails(
+	path string,
+	versionNumber string,
+	versionId string,
+	releasenotes string,
+	iearch string,
+) error {
+	// As “detail.json” has only a single “arch” field, multi-architecture
+	// apps cannot be represented; so better reject them clearly now instead
+	// of writing an architecture field that Industrial Edge won't understand.
+	if strings.ContainsAny(iearch, ", ") {
+		return fmt.Errorf("cannot set multiple IE App architectures %q, reason: %s",
+			iearch, "detail.json supports only a single \"arch\", build a separate app per architecture")
+	}
+	if iearch != "" {
+		if err := CheckIEAppArch(iearch); err != nil {
+			return err
+		}
+	}
+	return updateDetails(path, func(details map[string]any) {
+		details["versionNumber"] = versionNumber
+		details["versionId"] = versionId
 
-	details["versionNumber"] = semver
-	details["versionId"] = versionId
+		details["releaseNotes"] = releasenotes
 
-	details["releaseNotes"] = releasenotes
+		// set the IE App architecture only if it isn't empty and it's not the
+		// default (x86-64) architecture.
+		if iearch != "" && iearch != DefaultIEAppArch {
+			details["arch"] = iearch
+		}
+	})
+}
 
-	// set the IE App architecture only if it isn't empty and it's not the
-	// default (x86-64) architecture.
-	if iearch != "" && iearch != DefaultIEAppArch {
-		details["arch"] = iearch
+// updateDetails reads the “detail.json” at the specified path, lets the
+// specified update function modify the details, and then writes back the
+// updated details.
+func updateDetails(path string, update func(details map[string]any)) error {
+	details, err := readDetails(path)
+	if err != nil {
+		return err
 	}
 
-	detailJSON, err = json.Marshal(details)
+	update(details)
+
+	detailJSON, err := json.Marshal(details)
 	if err != nil {
 		return fmt.Errorf("cannot JSONize detail information, reason: %w", err)
 	}
@@ -178,29 +441,145 @@ func setDetails(
 	return nil
 }
 
+// ownDetailsFields lists the “detail.json” fields that tiap itself sets.
+var ownDetailsFields = []string{"versionNumber", "versionId", "releaseNotes", "arch"}
+
+// PruneEmptyDetails removes all empty string and null fields from the
+// “detail.json”, such as placeholders the template left unfilled. It never
+// removes the fields that tiap itself sets, even if empty, such as the
+// release notes. PruneEmptyDetails should thus be called after SetDetails.
+func (a *App) PruneEmptyDetails() error {
+	return pruneEmptyDetails(a.detailsPath())
+}
+
+// pruneEmptyDetails removes all empty string and null fields not set by tiap
+// itself from the “detail.json” at the specified path.
+func pruneEmptyDetails(path string) error {
+	return updateDetails(path, func(details map[string]any) {
+		for field, value := range details {
+			if slices.Contains(ownDetailsFields, field) {
+				continue
+			}
+			if value == nil || value == "" {
+				log.Info(fmt.Sprintf("✂  pruning empty detail.json field %q", field))
+				delete(details, field)
+			}
+		}
+	})
+}
+
+// readDetails reads and parses the “detail.json” at the specified path.
+func readDetails(path string) (map[string]any, error) {
+	detailJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read detail.json, reason: %w", err)
+	}
+	var details map[string]any
+	err = json.Unmarshal(detailJSON, &details)
+	if err != nil {
+		return nil, fmt.Errorf("malformed detail.json, reason: %w", err)
+	}
+	if StrictParsing {
+		if err := checkJSONDuplicateKeys(detailJSON); err != nil {
+			return nil, fmt.Errorf("malformed detail.json, reason: %w", err)
+		}
+	}
+	return details, nil
+}
+
+// ImageDigestsDetailsField is the name of the “detail.json” field that
+// WriteImageDigests writes the pulled images with their digests to. Its “x-”
+// prefix avoids collisions with fields used by Industrial Edge.
+const ImageDigestsDetailsField = "x-tiap-images"
+
+// WriteImageDigests writes the references, digests, and IDs of the images
+// pulled by PullAndWriteCompose into the ImageDigestsDetailsField of the
+// “detail.json”. It must thus be called after PullAndWriteCompose and after
+// SetDetails.
+func (a *App) WriteImageDigests() error {
+	images := a.project.SavedImages()
+	if images == nil {
+		images = []SavedImage{}
+	}
+	log.Info(fmt.Sprintf("📝  adding %d image digests to detail.json", len(images)))
+	return updateDetails(a.detailsPath(),
+		func(details map[string]any) {
+			details[ImageDigestsDetailsField] = images
+		})
+}
+
+// SavedImages returns the images pulled and saved by PullAndWriteCompose,
+// sorted by their image references.
+func (a *App) SavedImages() []SavedImage {
+	return a.project.SavedImages()
+}
+
 // PullAndWriteCompose analyzes the project's compose deployment in order to
 // pull the required container images, then saves the images into the temporary
-// stage, and writes composer project.
+// stage, and writes composer project. PullAndWriteCompose is a convenience
+// wrapper for calling ResolveImages, PullImages, and WriteCompose in sequence.
 func (a *App) PullAndWriteCompose(
 	ctx context.Context,
 	platform string,
 	optclient daemon.Client,
+	opts ...PullOption,
 ) error {
 	log.Info("🚚  pulling images and writing composer project...")
-	serviceImages, err := a.project.Images()
+	serviceImages, err := a.ResolveImages()
 	if err != nil {
 		return err
 	}
-	err = a.project.PullImages(
+	if err := a.PullImages(ctx, serviceImages, platform, optclient, opts...); err != nil {
+		return err
+	}
+	return a.WriteCompose()
+}
+
+// Validate checks the app's composer project without pulling any images,
+// applying the same checks as PullAndWriteCompose does, such as rejecting
+// “latest” images and missing memory limits. Validate reports all problems
+// found at once, see also [ComposerProject.Validate].
+func (a *App) Validate() error {
+	return a.project.Validate()
+}
+
+// ResolveImages validates the app's composer project and returns the mapping
+// between its services and the container images they reference, see also
+// [ComposerProject.Images].
+func (a *App) ResolveImages() (ServiceImages, error) {
+	return a.project.Images()
+}
+
+// PullImages pulls the specified service images, as well as the project's
+// extra images, and saves them into the stage, skipping images already saved
+// before. Use ResolveImages to get the service images.
+func (a *App) PullImages(
+	ctx context.Context,
+	serviceImages ServiceImages,
+	platform string,
+	optclient daemon.Client,
+	opts ...PullOption,
+) error {
+	return a.project.PullImages(
 		ctx,
 		serviceImages,
 		platform,
 		filepath.Join(a.tmpDir, a.repo),
 		optclient,
+		opts...,
 	)
-	if err != nil {
-		return err
-	}
+}
+
+// VerifySavedImages checks that the images saved into the stage match the
+// specified platform, see also [ComposerProject.VerifySavedImages].
+func (a *App) VerifySavedImages(platform string) error {
+	return a.project.VerifySavedImages(platform, filepath.Join(a.tmpDir, a.repo))
+}
+
+// WriteCompose writes the app's composer project into the stage as
+// “docker-compose.yml”, reflecting any modifications such as qualified image
+// references.
+func (a *App) WriteCompose() error {
 	composerf, err := os.Create(filepath.Join(a.tmpDir, a.repo, "docker-compose.yml"))
 	if err != nil {
 		return fmt.Errorf("cannot create Docker compose project file, reason: %w", err)
@@ -213,54 +592,253 @@ func (a *App) PullAndWriteCompose(
 	return nil
 }
 
+// WriteComposeJSON additionally writes the project's compose deployment in
+// JSON format as “docker-compose.json” next to the YAML compose project file.
+// It must be called after PullAndWriteCompose and before Package, so that the
+// JSON file gets digested and packaged.
+func (a *App) WriteComposeJSON() error {
+	composerf, err := os.Create(filepath.Join(a.tmpDir, a.repo, "docker-compose.json"))
+	if err != nil {
+		return fmt.Errorf("cannot create Docker compose JSON file, reason: %w", err)
+	}
+	defer composerf.Close()
+	return a.project.SaveJSON(composerf)
+}
+
+// AddFile copies the file at path “src” from outside the app template into
+// the staging directory at the package-relative path “dest”, so that it gets
+// digested and packaged. AddFile rejects destination paths escaping the
+// package root, as well as destination paths colliding with existing files
+// unless “force” is true. It must be called before Package.
+func (a *App) AddFile(src string, dest string, force bool) error {
+	if !filepath.IsLocal(dest) {
+		return fmt.Errorf("cannot add file %q, reason: invalid package path %q", src, dest)
+	}
+	dest = filepath.Clean(dest)
+	if dest == "digests.json" {
+		return fmt.Errorf("cannot add file %q, reason: package path %q is reserved", src, dest)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("cannot add file %q, reason: %w", src, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cannot add file %q, reason: not a regular file", src)
+	}
+	path := filepath.Join(a.tmpDir, dest)
+	if existing, err := os.Lstat(path); err == nil {
+		if !force || !existing.Mode().IsRegular() {
+			return fmt.Errorf("cannot add file %q, reason: package path %q already exists", src, dest)
+		}
+	}
+	log.Info(fmt.Sprintf("📎  adding file %q as %q", src, dest))
+	if err := copy.Copy(src, path); err != nil {
+		return fmt.Errorf("cannot add file %q, reason: %w", src, err)
+	}
+	digest, err := fileDigest(os.DirFS(a.tmpDir), filepath.ToSlash(dest))
+	if err != nil {
+		return fmt.Errorf("cannot add file %q, reason: %w", src, err)
+	}
+	if a.addedFiles == nil {
+		a.addedFiles = map[string]string{}
+	}
+	a.addedFiles[filepath.ToSlash(dest)] = digest
+	return nil
+}
+
+// SourceDateEpochEnvVar names the environment variable optionally specifying
+// the modification time of all packaged files in seconds since the Unix
+// epoch, see https://reproducible-builds.org/specs/source-date-epoch/.
+const SourceDateEpochEnvVar = "SOURCE_DATE_EPOCH"
+
+// packageModTime returns the modification time to record for all packaged
+// files, as specified by the SourceDateEpochEnvVar environment variable,
+// defaulting to the Unix epoch.
+func packageModTime() (time.Time, error) {
+	epoch := os.Getenv(SourceDateEpochEnvVar)
+	if epoch == "" {
+		return time.Unix(0, 0), nil
+	}
+	secs, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, fmt.Errorf("invalid %s %q", SourceDateEpochEnvVar, epoch)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// DefaultPackageOwnerID is the owner and group ID of all packaged files,
+// unless specified otherwise using WithUID and WithGID.
+const DefaultPackageOwnerID = 1000
+
+// PackageOptions controls how Package and PackageTo write an IE app package.
+type PackageOptions struct {
+	UID  int  // owner ID of all packaged files
+	GID  int  // group ID of all packaged files
+	Gzip bool // gzip-compress the whole app package
+}
+
+// PackageOption sets an option for Package and PackageTo.
+type PackageOption func(*PackageOptions)
+
+// WithUID sets the owner ID of all packaged files.
+func WithUID(uid int) PackageOption {
+	return func(o *PackageOptions) { o.UID = uid }
+}
+
+// WithGID sets the group ID of all packaged files.
+func WithGID(gid int) PackageOption {
+	return func(o *PackageOptions) { o.GID = gid }
+}
+
+// WithGzip gzip-compresses the whole app package.
+func WithGzip() PackageOption {
+	return func(o *PackageOptions) { o.Gzip = true }
+}
+
+// packageOptions returns the package options after applying the specified
+// options to the defaults, rejecting negative owner and group IDs.
+func packageOptions(opts []PackageOption) (PackageOptions, error) {
+	options := PackageOptions{
+		UID: DefaultPackageOwnerID,
+		GID: DefaultPackageOwnerID,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.UID < 0 {
+		return PackageOptions{}, fmt.Errorf("invalid package owner ID %d", options.UID)
+	}
+	if options.GID < 0 {
+		return PackageOptions{}, fmt.Errorf("invalid package group ID %d", options.GID)
+	}
+	return options, nil
+}
+
 // Package (finally) packages the IE app project in a IE app package tar file
-// indicated by “out”.
-func (a *App) Package(out string) error {
+// indicated by “out”, see also PackageTo.
+func (a *App) Package(out string, opts ...PackageOption) error {
 	log.Info("🌯  wrapping up...")
 	start := time.Now()
 	defer func() {
 		duration := time.Duration(math.Ceil(time.Since(start).Seconds())) * time.Second
 		log.Infof("🌯  app package %s written in %s", out, duration)
 	}()
+	options, err := a.preparePackage(opts)
+	if err != nil {
+		return err
+	}
+	tarball, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("cannot create IE app package file, reason: %w", err)
+	}
+	defer tarball.Close()
+	if err := a.writePackage(tarball, options); err != nil {
+		return err
+	}
+	if err := tarball.Close(); err != nil {
+		return fmt.Errorf("cannot write IE app package file, reason: %w", err)
+	}
+	log.Info(fmt.Sprintf("✅  ...IE app package %q successfully created", out))
+	return nil // done and dusted.
+}
+
+// PackageTo packages the IE app project as an IE app package tar stream into
+// the specified writer, such as for directly uploading it without an
+// intermediate file. When passing the WithGzip option, PackageTo gzip
+// compresses the whole tar stream.
+//
+// Packaging is reproducible: the same staged files always result in the same
+// app package, byte for byte. For this, PackageTo walks the files in
+// lexicographic order and records only the permissions of the files, with
+// owner and group IDs of 1000 unless specified otherwise, but no owner and
+// group names. All files get the same modification time, as specified by the
+// SOURCE_DATE_EPOCH environment variable, or otherwise the Unix epoch.
+func (a *App) PackageTo(w io.Writer, opts ...PackageOption) error {
+	options, err := a.preparePackage(opts)
+	if err != nil {
+		return err
+	}
+	return a.writePackage(w, options)
+}
+
+// packageSettings are the package options together with the modification
+// time to record for all packaged files.
+type packageSettings struct {
+	PackageOptions
+	modTime time.Time
+}
+
+// preparePackage determines the package settings from the specified options
+// and then calculates and writes the digests of the staged files.
+func (a *App) preparePackage(opts []PackageOption) (packageSettings, error) {
+	options, err := packageOptions(opts)
+	if err != nil {
+		return packageSettings{}, err
+	}
+	modTime, err := packageModTime()
+	if err != nil {
+		return packageSettings{}, err
+	}
 	// Calculate and write digests
 	digestJson, err := os.Create(filepath.Join(a.tmpDir, "digests.json"))
 	if err != nil {
-		return fmt.Errorf("cannot create digests.json, reason: %w", err)
+		return packageSettings{}, fmt.Errorf("cannot create digests.json, reason: %w", err)
+	}
+	if len(DigestAlgorithms) > 0 {
+		err = WriteMixedDigests(digestJson, a.tmpDir, DigestAlgorithms)
+	} else {
+		err = streamDigests(digestJson, os.DirFS(a.tmpDir), a.fileDigest)
 	}
-	err = WriteDigests(digestJson, a.tmpDir)
 	digestJson.Close()
 	if err != nil {
-		return err
+		return packageSettings{}, err
 	}
+	return packageSettings{PackageOptions: options, modTime: modTime}, nil
+}
 
+// writePackage writes the staged files including their digests as an IE app
+// package tar stream into the specified writer.
+func (a *App) writePackage(w io.Writer, options packageSettings) error {
 	// Doctor Tarr and Professor Fether
-	tarball, err := os.Create(out)
-	if err != nil {
-		return fmt.Errorf("cannot create IE app package file, reason: %w", err)
+	var zipper *gzip.Writer
+	if options.Gzip {
+		zipper = gzip.NewWriter(w)
+		w = zipper
 	}
-	defer tarball.Close()
-	tarrer := tar.NewWriter(tarball)
-	defer tarrer.Close()
+	tarrer := tar.NewWriter(w)
 	rootfs := os.DirFS(a.tmpDir)
-	err = fs.WalkDir(rootfs, ".", func(path string, dirEntry fs.DirEntry, err error) error {
+	files := 0
+	err := fs.WalkDir(rootfs, ".", func(path string, dirEntry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if path == "." {
 			return nil
 		}
+		if !dirEntry.IsDir() {
+			files++
+			if err := tooManyFiles(files); err != nil {
+				return err
+			}
+		}
 		log.Info(fmt.Sprintf("   📦  packaging %s", path))
 		stat, err := fs.Stat(rootfs, path)
 		if err != nil {
 			return err
 		}
-		header, err := tar.FileInfoHeader(stat, path)
+		header, err := tar.FileInfoHeader(stat, "")
 		if err != nil {
 			return err
 		}
-		header.Uid = 1000
-		header.Gid = 1000
-		header.Name = filepath.ToSlash(path)
+		header = &tar.Header{
+			Typeflag: header.Typeflag,
+			Name:     filepath.ToSlash(path),
+			Size:     header.Size,
+			Mode:     header.Mode & 0o7777,
+			Uid:      options.UID,
+			Gid:      options.GID,
+			ModTime:  options.modTime,
+		}
 		err = tarrer.WriteHeader(header)
 		if err != nil {
 			return err
@@ -283,6 +861,15 @@ func (a *App) Package(out string) error {
 	if err != nil {
 		return fmt.Errorf("cannot package IE app, reason: %w", err)
 	}
-	log.Info(fmt.Sprintf("✅  ...IE app package %q successfully created", out))
-	return nil // done and dusted.
+	// Make sure to flush the tar stream trailer as well as the gzip footer, if
+	// any, as otherwise the app package would be incomplete.
+	if err := tarrer.Close(); err != nil {
+		return fmt.Errorf("cannot package IE app, reason: %w", err)
+	}
+	if zipper != nil {
+		if err := zipper.Close(); err != nil {
+			return fmt.Errorf("cannot package IE app, reason: %w", err)
+		}
+	}
+	return nil
 }
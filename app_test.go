@@ -15,10 +15,20 @@
 package tiap
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/otiai10/copy"
 	"github.com/sirupsen/logrus"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -88,6 +98,159 @@ var _ = Describe("IE app building", func() {
 				Expect(d).To(HaveKeyWithValue("arch", "arm64"))
 			})
 
+			It("prunes empty fields not set by tiap", func() {
+				Expect(setDetails(tmpPath, "hellorld", semver, "", "")).To(Succeed())
+				Expect(pruneEmptyDetails(tmpPath)).To(Succeed())
+				details = Successful(os.ReadFile(tmpPath))
+				var d map[string]any
+				Expect(json.Unmarshal([]byte(details), &d)).To(Succeed())
+				Expect(d).To(HaveKeyWithValue("releaseNotes", ""))
+				Expect(d).To(HaveKeyWithValue("versionNumber", semver))
+				Expect(d).To(HaveKeyWithValue("title", "Hellorld!"))
+				Expect(d).To(HaveKeyWithValue("swarmModeEnable", false))
+				Expect(d).To(HaveKeyWithValue("required", BeEmpty()))
+				Expect(d).NotTo(HaveKey("restRedirectUrl"))
+				Expect(d).To(HaveKeyWithValue("externalUrl", false))
+			})
+
+			It("rejects multiple architectures", func() {
+				Expect(setDetails(tmpPath, "hellorld", semver, "notes", "arm64,x86-64")).To(
+					MatchError(ContainSubstring("cannot set multiple IE App architectures")))
+				Expect(os.ReadFile(tmpPath)).To(Equal(details))
+			})
+
+			It("rejects unrecognized architectures", func() {
+				Expect(setDetails(tmpPath, "hellorld", semver, "notes", "riscv64")).To(
+					MatchError(ContainSubstring(`unrecognized IE App architecture "riscv64"`)))
+				Expect(os.ReadFile(tmpPath)).To(Equal(details))
+			})
+
+		})
+
+	})
+
+	When("running the individual steps", func() {
+
+		var a *App
+
+		BeforeEach(func() {
+			GrabLog(logrus.InfoLevel)
+			a = Successful(NewApp("testdata/app"))
+			DeferCleanup(func() { a.Done() })
+		})
+
+		It("validates and resolves the service images", func() {
+			Expect(a.Validate()).To(Succeed())
+			Expect(a.ResolveImages()).To(HaveKeyWithValue("hellorld", HavePrefix("busybox:")))
+
+			a.project.yaml["services"].(map[string]any)["hellorld"].(map[string]any)["image"] = "busybox:latest"
+			Expect(a.Validate()).To(MatchError(ContainSubstring("attempts to use latest tag")))
+		})
+
+		It("pulls nothing when there are no images", func(ctx context.Context) {
+			Expect(a.PullImages(ctx, ServiceImages{}, "linux/amd64", nil)).To(Succeed())
+			Expect(a.SavedImages()).To(BeEmpty())
+			Expect(filepath.Join(a.tmpDir, a.repo, "images")).To(BeADirectory())
+		})
+
+		It("writes the composer project", func() {
+			Expect(a.WriteCompose()).To(Succeed())
+			Expect(string(Successful(os.ReadFile(filepath.Join(a.tmpDir, a.repo, "docker-compose.yml"))))).
+				To(ContainSubstring("hellorld:"))
+		})
+
+	})
+
+	It("uses a custom details filename", Serial, func() {
+		GrabLog(logrus.InfoLevel)
+		old := DetailsFile
+		DeferCleanup(func() { DetailsFile = old })
+		DetailsFile = "manifest.json"
+
+		template := GinkgoT().TempDir()
+		Expect(copy.Copy("testdata/app", template)).To(Succeed())
+		Expect(os.Rename(filepath.Join(template, "detail.json"),
+			filepath.Join(template, DetailsFile))).To(Succeed())
+
+		a := Successful(NewApp(template))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.SetDetails("1.2.3", "notes", "")).To(Succeed())
+		Expect(filepath.Join(a.tmpDir, "detail.json")).NotTo(BeAnExistingFile())
+		var d map[string]any
+		Expect(json.Unmarshal(
+			Successful(os.ReadFile(filepath.Join(a.tmpDir, DetailsFile))), &d)).To(Succeed())
+		Expect(d).To(HaveKeyWithValue("versionNumber", "1.2.3"))
+
+		Expect(ResumeApp("testdata/app", "testdata/app")).Error().To(MatchError(
+			ContainSubstring("missing manifest.json")))
+	})
+
+	When("overriding version details", func() {
+
+		var a *App
+
+		BeforeEach(func() {
+			GrabLog(logrus.InfoLevel)
+			a = Successful(NewApp("testdata/app"))
+			DeferCleanup(func() { a.Done() })
+		})
+
+		readDetails := func() map[string]any {
+			GinkgoHelper()
+			var d map[string]any
+			Expect(json.Unmarshal(
+				Successful(os.ReadFile(filepath.Join(a.tmpDir, "detail.json"))), &d)).To(Succeed())
+			return d
+		}
+
+		It("sets version number and ID verbatim", func() {
+			Expect(a.SetVersionedDetails("2023.10-build42", "my-own-version-id", "notes", "arm64")).
+				To(Succeed())
+			d := readDetails()
+			Expect(d).To(HaveKeyWithValue("versionNumber", "2023.10-build42"))
+			Expect(d).To(HaveKeyWithValue("versionId", "my-own-version-id"))
+			Expect(d).To(HaveKeyWithValue("releaseNotes", "notes"))
+			Expect(d).To(HaveKeyWithValue("arch", "arm64"))
+		})
+
+		It("adds image digests", func() {
+			Expect(a.WriteImageDigests()).To(Succeed())
+			Expect(readDetails()).To(HaveKeyWithValue(ImageDigestsDetailsField, BeEmpty()))
+
+			a.project.savedImages = []SavedImage{
+				{Ref: "busybox:stable", Digest: "sha256:1234", ID: "sha256:5678"},
+			}
+			Expect(a.WriteImageDigests()).To(Succeed())
+			d := readDetails()
+			Expect(d).To(HaveKeyWithValue(ImageDigestsDetailsField, ConsistOf(
+				map[string]any{"image": "busybox:stable", "digest": "sha256:1234", "id": "sha256:5678"},
+			)))
+			Expect(d).To(HaveKeyWithValue("title", "Hellorld!"))
+		})
+
+		It("expands the release notes with the images", func() {
+			a.project.savedImages = []SavedImage{
+				{Ref: "alpine:3.18", Digest: "sha256:abcd", ID: "sha256:ef01"},
+				{Ref: "busybox:stable", Digest: "sha256:1234", ID: "sha256:5678"},
+			}
+			Expect(a.SetDetails("1.2.3", "Images:\n{{.Images}}\n{{range .Images}}{{.Ref}};{{end}}", "")).
+				To(Succeed())
+			Expect(a.ExpandReleaseNotes()).To(Succeed())
+			Expect(readDetails()).To(HaveKeyWithValue("releaseNotes",
+				"Images:\n- alpine:3.18 (sha256:abcd)\n- busybox:stable (sha256:1234)\nalpine:3.18;busybox:stable;"))
+
+			Expect(a.SetDetails("1.2.3", "{{.Images", "")).To(Succeed())
+			Expect(a.ExpandReleaseNotes()).To(MatchError(
+				ContainSubstring("cannot parse release notes template")))
+			Expect(a.SetDetails("1.2.3", "{{.Nada}}", "")).To(Succeed())
+			Expect(a.ExpandReleaseNotes()).To(MatchError(
+				ContainSubstring("cannot expand release notes template")))
+		})
+
+		It("derives the version ID when not specified", func() {
+			Expect(a.SetVersionedDetails("2023.10-build42", "", "", "")).To(Succeed())
+			Expect(readDetails()).To(HaveKeyWithValue("versionId",
+				deriveVersionID("2023.10-build42", "hellorld")))
 		})
 
 	})
@@ -116,6 +279,12 @@ var _ = Describe("IE app building", func() {
 				ContainSubstring("project lacks Docker compose")))
 		})
 
+		It("rejects a composer project in the template root", func() {
+			GrabLog(logrus.InfoLevel)
+			Expect(NewApp("testdata/rootcompose")).Error().To(MatchError(
+				ContainSubstring("must not be placed in the template root")))
+		})
+
 		It("reports when unable to load malformed composer project", func() {
 			GrabLog(logrus.InfoLevel)
 			Expect(NewApp("testdata/brokencompose")).Error().To(MatchError(
@@ -124,6 +293,168 @@ var _ = Describe("IE app building", func() {
 
 	})
 
+	It("writes the composer project as JSON", func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		defer a.Done()
+		Expect(a.WriteComposeJSON()).To(Succeed())
+		Expect(filepath.Join(a.tmpDir, a.repo, "docker-compose.json")).To(BeARegularFile())
+
+		a.repo = "nada-nothing-nil"
+		Expect(a.WriteComposeJSON()).To(MatchError(
+			ContainSubstring("cannot create Docker compose JSON file")))
+	})
+
+	It("loads an app template from the current directory", Serial, func() {
+		GrabLog(logrus.InfoLevel)
+		cwd := Successful(os.Getwd())
+		Expect(os.Chdir("testdata/app")).To(Succeed())
+		DeferCleanup(func() { Expect(os.Chdir(cwd)).To(Succeed()) })
+		a := Successful(NewApp("."))
+		defer a.Done()
+		Expect(a.repo).To(Equal("hellorld"))
+		Expect(filepath.Join(a.tmpDir, "detail.json")).To(BeARegularFile())
+	})
+
+	When("limiting the number of files", Serial, func() {
+
+		maxFiles := func(max int) {
+			old := MaxFiles
+			DeferCleanup(func() { MaxFiles = old })
+			MaxFiles = max
+		}
+
+		It("rejects runaway templates", func() {
+			GrabLog(logrus.InfoLevel)
+			template := GinkgoT().TempDir()
+			Expect(copy.Copy("testdata/app", template)).To(Succeed())
+			for idx := range 100 {
+				Expect(os.WriteFile(filepath.Join(template, "hellorld", fmt.Sprintf("file-%d", idx)),
+					nil, 0666)).To(Succeed())
+			}
+			maxFiles(50)
+			Expect(NewApp(template)).Error().To(MatchError(
+				ContainSubstring("exceeding the maximum of 50 files")))
+			maxFiles(0)
+			a := Successful(NewApp(template))
+			a.Done()
+		})
+
+		It("rejects packaging too many files", func() {
+			GrabLog(logrus.InfoLevel)
+			a := Successful(NewApp("testdata/app"))
+			defer a.Done()
+			maxFiles(2)
+			Expect(a.Package(filepath.Join(GinkgoT().TempDir(), "hellorld.app"))).To(MatchError(
+				ContainSubstring("exceeding the maximum of 2 files")))
+		})
+
+	})
+
+	When("adding files", func() {
+
+		var a *App
+		var report string
+
+		BeforeEach(func() {
+			GrabLog(logrus.InfoLevel)
+			a = Successful(NewApp("testdata/app"))
+			DeferCleanup(func() { a.Done() })
+			report = filepath.Join(GinkgoT().TempDir(), "report.txt")
+			Expect(os.WriteFile(report, []byte("hellorld"), 0666)).To(Succeed())
+		})
+
+		It("packages and digests added files", func() {
+			Expect(a.AddFile(report, "licenses/report.txt", false)).To(Succeed())
+			out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+			Expect(a.Package(out)).To(Succeed())
+
+			f := Successful(os.Open(out))
+			defer f.Close()
+			files := map[string][]byte{}
+			tarrer := tar.NewReader(f)
+			for {
+				header, err := tarrer.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				files[header.Name] = Successful(io.ReadAll(tarrer))
+			}
+			Expect(files).To(HaveKeyWithValue("licenses/report.txt", []byte("hellorld")))
+			var digests struct {
+				Files map[string]string `json:"files"`
+			}
+			Expect(json.Unmarshal(files["digests.json"], &digests)).To(Succeed())
+			Expect(digests.Files).To(HaveKeyWithValue("licenses/report.txt",
+				"db3b7b61cbd660bc5e9f0044fdb5b05540e488807c240c3f9243de309cf6265d"))
+		})
+
+		It("overwrites existing files only when forced", func() {
+			Expect(a.AddFile(report, "detail.json", false)).To(MatchError(
+				ContainSubstring("already exists")))
+			Expect(a.AddFile(report, "hellorld", true)).To(MatchError(
+				ContainSubstring("already exists")))
+			Expect(a.AddFile(report, "detail.json", true)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(a.tmpDir, "detail.json"))).To(Equal([]byte("hellorld")))
+		})
+
+		DescribeTable("rejecting invalid additions",
+			func(src string, dest string, errmsg string) {
+				if src == "" {
+					src = report
+				}
+				Expect(a.AddFile(src, dest, true)).To(MatchError(ContainSubstring(errmsg)))
+			},
+			Entry(nil, "", "../report.txt", "invalid package path"),
+			Entry(nil, "", "/report.txt", "invalid package path"),
+			Entry(nil, "", "digests.json", "is reserved"),
+			Entry(nil, "testdata/nada-nothing-nil", "report.txt", "no such file"),
+			Entry(nil, "testdata", "report.txt", "not a regular file"),
+		)
+
+	})
+
+	When("resuming", func() {
+
+		It("keeps and resumes a staging directory", func() {
+			GrabLog(logrus.InfoLevel)
+			a := Successful(NewApp("testdata/app"))
+			stage := a.StageDir()
+			DeferCleanup(func() { os.RemoveAll(stage) })
+			a.KeepStage()
+			a.Done()
+			Expect(stage).To(BeADirectory())
+
+			a = Successful(ResumeApp("testdata/app", stage))
+			Expect(a.StageDir()).To(Equal(stage))
+			Expect(a.repo).To(Equal("hellorld"))
+			a.Done()
+			Expect(stage).To(BeADirectory())
+		})
+
+		It("rejects directories not looking like a stage", func() {
+			GrabLog(logrus.InfoLevel)
+			Expect(ResumeApp("testdata/app", "testdata/composer")).Error().To(MatchError(
+				ContainSubstring("missing detail.json")))
+			Expect(ResumeApp("testdata/app", "testdata/details/good")).Error().To(MatchError(
+				ContainSubstring("missing app repository")))
+		})
+
+		It("rejects broken templates", func() {
+			GrabLog(logrus.InfoLevel)
+			Expect(ResumeApp("/nothing-nada-nil", "testdata/app")).Error().To(MatchError(
+				ContainSubstring("cannot read app template structure")))
+			Expect(ResumeApp("testdata/brokenapp", "testdata/app")).Error().To(MatchError(
+				ContainSubstring("project lacks Docker compose")))
+			Expect(ResumeApp("testdata/rootcompose", "testdata/app")).Error().To(MatchError(
+				ContainSubstring("must not be placed in the template root")))
+			Expect(ResumeApp("testdata/brokencompose", "testdata/brokencompose")).Error().To(MatchError(
+				ContainSubstring("missing detail.json")))
+		})
+
+	})
+
 	When("packaging", func() {
 
 		It("reports error when digests cannot be stored", func() {
@@ -163,3 +494,129 @@ var _ = Describe("IE app building", func() {
 	})
 
 })
+
+var _ = Describe("reproducible app packages", func() {
+
+	pack := func(a *App, opts ...PackageOption) []byte {
+		GinkgoHelper()
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out, opts...)).To(Succeed())
+		return Successful(os.ReadFile(out))
+	}
+
+	It("packages the same files into identical app packages", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(Succeed())
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+
+		first := pack(a)
+		// Touch the staged files, so their modification times change.
+		later := time.Now().Add(time.Hour)
+		Expect(filepath.WalkDir(a.tmpDir, func(path string, d fs.DirEntry, err error) error {
+			Expect(err).NotTo(HaveOccurred())
+			return os.Chtimes(path, later, later)
+		})).To(Succeed())
+		Expect(pack(a)).To(Equal(first))
+
+		tarrer := tar.NewReader(bytes.NewReader(first))
+		for {
+			header, err := tarrer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.ModTime.Unix()).To(BeZero())
+			Expect(header.Uid).To(Equal(1000))
+			Expect(header.Gid).To(Equal(1000))
+			Expect(header.Uname).To(BeEmpty())
+			Expect(header.Gname).To(BeEmpty())
+		}
+	})
+
+	It("packages files with the configured owner and group IDs", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(Succeed())
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+
+		tarrer := tar.NewReader(bytes.NewReader(pack(a, WithUID(0), WithGID(42))))
+		headers := 0
+		for {
+			header, err := tarrer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Uid).To(BeZero())
+			Expect(header.Gid).To(Equal(42))
+			headers++
+		}
+		Expect(headers).NotTo(BeZero())
+
+		Expect(a.Package(filepath.Join(GinkgoT().TempDir(), "hellorld.app"), WithGID(-1))).To(
+			MatchError("invalid package group ID -1"))
+	})
+
+	It("uses SOURCE_DATE_EPOCH", func() {
+		GinkgoT().Setenv(SourceDateEpochEnvVar, "1700000000")
+		Expect(packageModTime()).To(Equal(time.Unix(1700000000, 0)))
+		GinkgoT().Setenv(SourceDateEpochEnvVar, "yesterday")
+		Expect(packageModTime()).Error().To(MatchError(
+			ContainSubstring(`invalid SOURCE_DATE_EPOCH "yesterday"`)))
+	})
+
+})
+
+var _ = Describe("packaging into writers", func() {
+
+	var a *App
+
+	BeforeEach(func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		a = Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(Succeed())
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+	})
+
+	names := func(r io.Reader) []string {
+		GinkgoHelper()
+		var names []string
+		tarrer := tar.NewReader(r)
+		for {
+			header, err := tarrer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, header.Name)
+		}
+		return names
+	}
+
+	It("packages into a writer", func() {
+		var buff bytes.Buffer
+		Expect(a.PackageTo(&buff)).To(Succeed())
+		Expect(names(&buff)).To(ContainElements(
+			"detail.json", "digests.json", "hellorld/docker-compose.yml"))
+
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out)).To(Succeed())
+		buff.Reset()
+		Expect(a.PackageTo(&buff)).To(Succeed())
+		Expect(buff.Bytes()).To(Equal(Successful(os.ReadFile(out))))
+	})
+
+	It("gzips the whole package", func() {
+		var buff bytes.Buffer
+		Expect(a.PackageTo(&buff, WithGzip())).To(Succeed())
+		zipper := Successful(gzip.NewReader(&buff))
+		Expect(names(zipper)).To(ContainElements(
+			"detail.json", "digests.json", "hellorld/docker-compose.yml"))
+		Expect(zipper.Close()).To(Succeed())
+	})
+
+})
@@ -0,0 +1,68 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// VerifySavedImages reads back the image files saved by the most recent call
+// to PullImages from the “images/” subdirectory of the specified root and
+// checks that the OS and architecture of each image match the specified
+// platform. This catches single-platform images having been silently
+// substituted for the requested platform. All mismatches are reported.
+func (p *ComposerProject) VerifySavedImages(platform string, root string) error {
+	wantPlatform, err := ociv1.ParsePlatform(platform)
+	if err != nil {
+		return fmt.Errorf("invalid platform %q: %w", platform, err)
+	}
+	imagesDir := filepath.Join(root, "images")
+	var problems []string
+	for _, saved := range p.savedImages {
+		if err := verifySavedImage(imagesDir, saved.Ref, p.compressedImages, wantPlatform); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// verifySavedImage checks the saved image file for the referenced image in the
+// specified directory to match the wanted platform.
+func verifySavedImage(imagesDir string, imageRef string, compressed bool, wantPlatform *ociv1.Platform) error {
+	image, err := imageFromPath(filepath.Join(imagesDir, imageFilename(imageRef, compressed)))
+	if err != nil {
+		return fmt.Errorf("cannot read back saved image %q, reason: %w", imageRef, err)
+	}
+	config, err := image.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("cannot read back config of saved image %q, reason: %w", imageRef, err)
+	}
+	hasPf := config.Platform()
+	if hasPf == nil || !hasPf.Satisfies(*wantPlatform) {
+		return fmt.Errorf("saved image %q is for platform %q instead of %q",
+			imageRef, config.OS+"/"+config.Architecture, wantPlatform.String())
+	}
+	log.Debugf("🐛 saved image %s verified for platform %s", imageRef, hasPf)
+	return nil
+}
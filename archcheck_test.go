@@ -0,0 +1,77 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("verifying saved image platforms", func() {
+
+	// saveImage writes a random image for the specified OS and architecture
+	// as the saved image file for the specified image reference.
+	saveImage := func(root, imageRef, goos, arch string) SavedImage {
+		GinkgoHelper()
+		image := Successful(random.Image(1024, 1))
+		config := Successful(image.ConfigFile()).DeepCopy()
+		config.OS = goos
+		config.Architecture = arch
+		image = Successful(mutate.ConfigFile(image, config))
+		imagesDir := filepath.Join(root, "images")
+		Expect(os.MkdirAll(imagesDir, 0755)).To(Succeed())
+		Expect(tarball.WriteToFile(filepath.Join(imagesDir, imageFilename(imageRef, false)),
+			Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+		return SavedImage{Ref: imageRef}
+	}
+
+	It("accepts saved images matching the platform", func() {
+		root := GinkgoT().TempDir()
+		p := &ComposerProject{savedImages: []SavedImage{
+			saveImage(root, "foo:1.0", "linux", "arm64"),
+			saveImage(root, "bar:1.0", "linux", "arm64"),
+		}}
+		Expect(p.VerifySavedImages("linux/arm64", root)).To(Succeed())
+	})
+
+	It("rejects a mismatching saved image", func() {
+		root := GinkgoT().TempDir()
+		p := &ComposerProject{savedImages: []SavedImage{
+			saveImage(root, "foo:1.0", "linux", "arm64"),
+			saveImage(root, "bar:1.0", "linux", "amd64"),
+		}}
+		Expect(p.VerifySavedImages("linux/arm64", root)).To(MatchError(
+			`saved image "bar:1.0" is for platform "linux/amd64" instead of "linux/arm64"`))
+	})
+
+	It("reports unreadable saved images and invalid platforms", func() {
+		root := GinkgoT().TempDir()
+		p := &ComposerProject{savedImages: []SavedImage{{Ref: "foo:1.0"}}}
+		Expect(p.VerifySavedImages("linux/arm64", root)).To(MatchError(
+			ContainSubstring(`cannot read back saved image "foo:1.0"`)))
+		Expect(p.VerifySavedImages("linux/arm64/v8/bonkers", root)).To(MatchError(
+			ContainSubstring("invalid platform")))
+	})
+
+})
@@ -0,0 +1,75 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryAuth supplies explicit credentials for a (remote) registry, such as
+// “ghcr.io” or “registry.example.org:5000”; “docker.io” stands for the Docker
+// Hub.
+type RegistryAuth struct {
+	Registry string
+	Auth     authn.Authenticator
+}
+
+// WithAuth authenticates with the specified registry using the specified
+// authenticator. Explicit credentials take precedence over the default
+// keychain with its Docker configuration and credential helpers, which serves
+// as the fallback for all other registries. This way, CI systems can supply
+// credentials without having to write a Docker configuration to disk first.
+// When passing multiple credentials for the same registry, the first one wins.
+func WithAuth(registry string, auth authn.Authenticator) PullOption {
+	return func(o *PullOptions) {
+		o.Auth = append(o.Auth, RegistryAuth{Registry: registry, Auth: auth})
+	}
+}
+
+// WithBasicAuth authenticates with the specified registry using the specified
+// username and password, see also WithAuth.
+func WithBasicAuth(registry string, username, password string) PullOption {
+	return WithAuth(registry, &authn.Basic{Username: username, Password: password})
+}
+
+// explicitKeychain resolves registries to explicit credentials.
+type explicitKeychain []RegistryAuth
+
+var _ authn.Keychain = explicitKeychain{}
+
+// Resolve returns the explicit credentials for the registry of the specified
+// resource, or the anonymous authenticator if there are none.
+func (kc explicitKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	for _, auth := range kc {
+		reg, err := name.NewRegistry(auth.Registry)
+		if err != nil {
+			continue
+		}
+		if reg.RegistryStr() == target.RegistryStr() {
+			return auth.Auth, nil
+		}
+	}
+	return authn.Anonymous, nil
+}
+
+// registryAuth returns the remote option for authenticating with registries,
+// trying the explicit credentials from the pull options first and then falling
+// back to the default keychain.
+func (o PullOptions) registryAuth() remote.Option {
+	return remote.WithAuthFromKeychain(
+		authn.NewMultiKeychain(explicitKeychain(o.Auth), authn.DefaultKeychain))
+}
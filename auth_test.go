@@ -0,0 +1,87 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("registry credentials", Serial, func() {
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		// Make sure to not pick up any credentials of the user running the
+		// tests.
+		GinkgoT().Setenv("DOCKER_CONFIG", GinkgoT().TempDir())
+	})
+
+	It("resolves explicit credentials by registry", func() {
+		kc := explicitKeychain(pullOptions([]PullOption{
+			WithBasicAuth("docker.io", "foo", "bar"),
+			WithBasicAuth("registry.example.org:5000", "baz", "qux"),
+			WithBasicAuth("docker.io", "nada", "nothing"),
+		}).Auth)
+		Expect(kc.Resolve(Successful(name.NewRegistry("index.docker.io")))).To(
+			Equal(&authn.Basic{Username: "foo", Password: "bar"}))
+		Expect(kc.Resolve(Successful(name.NewRegistry("registry.example.org:5000")))).To(
+			Equal(&authn.Basic{Username: "baz", Password: "qux"}))
+		Expect(kc.Resolve(Successful(name.NewRegistry("ghcr.io")))).To(
+			BeIdenticalTo(authn.Anonymous))
+	})
+
+	It("pulls using the configured credentials", func(ctx context.Context) {
+		reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="hellorld"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			reg.ServeHTTP(w, r)
+		}))
+		DeferCleanup(srv.Close)
+		host := strings.TrimPrefix(srv.URL, "http://")
+		imageRef := host + "/hellorld/foo:1.0"
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)),
+			Successful(random.Image(1024, 1)),
+			remote.WithAuth(&authn.Basic{Username: "foo", Password: "bar"}))).To(Succeed())
+
+		Expect(SaveImageToFile(ctx, imageRef, "linux/amd64", GinkgoT().TempDir(), nil)).Error().
+			To(MatchError(ContainSubstring("401 Unauthorized")))
+
+		Expect(SaveImageToFile(ctx, imageRef, "linux/amd64", GinkgoT().TempDir(), nil,
+			WithBasicAuth(host, "foo", "bar"))).Error().NotTo(HaveOccurred())
+		// Credentials don't stick around from one call to the next.
+		Expect(SaveImageToFile(ctx, imageRef, "linux/amd64", GinkgoT().TempDir(), nil)).Error().
+			To(MatchError(ContainSubstring("401 Unauthorized")))
+	})
+
+})
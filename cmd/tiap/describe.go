@@ -0,0 +1,98 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/thediveo/tiap"
+)
+
+// gitDescribe runs “git describe” in the specified directory, returning the
+// description. It gives up after the specified timeout, so that a slow or
+// hung filesystem doesn't block forever.
+func gitDescribe(ctx context.Context, dir string, timeout time.Duration) (string, error) {
+	out, err := runGit(ctx, dir, timeout, "describe")
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(out, "\r\n"), nil
+}
+
+// defaultNotesRange is the pseudo range telling gitReleaseNotes to cover the
+// commits since the previous tag.
+const defaultNotesRange = "auto"
+
+// gitReleaseNotes returns release notes made from the subjects of the commits
+// in the specified git revision range, one “- subject” line per commit. For
+// the defaultNotesRange the commits since the tag preceding HEAD are used; if
+// there is no such previous tag, then the whole history up to HEAD is used.
+func gitReleaseNotes(ctx context.Context, dir string, revrange string, timeout time.Duration) (string, error) {
+	if revrange == defaultNotesRange {
+		revrange = "HEAD"
+		if prev, err := runGit(ctx, dir, timeout, "describe", "--tags", "--abbrev=0", "HEAD^"); err == nil {
+			revrange = strings.Trim(prev, "\r\n") + "..HEAD"
+		}
+	}
+	out, err := runGit(ctx, dir, timeout, "log", "--format=%s", revrange)
+	if err != nil {
+		return "", err
+	}
+	var notes strings.Builder
+	for _, subject := range strings.Split(strings.Trim(out, "\r\n"), "\n") {
+		subject = strings.TrimSpace(subject)
+		if subject == "" {
+			continue
+		}
+		if notes.Len() > 0 {
+			notes.WriteString("\n")
+		}
+		notes.WriteString("- " + subject)
+	}
+	return notes.String(), nil
+}
+
+// runGit runs the configured git binary with the specified arguments in the
+// specified directory, returning its output. The timeout, if positive, limits
+// how long git gets to run.
+func runGit(ctx context.Context, dir string, timeout time.Duration, args ...string) (string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, tiap.GitBinary(), args...)
+	cmd.Dir = dir
+	// Don't wait for any stray child processes still holding on to the
+	// output after git has been killed.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("git %s timed out after %s", args[0], timeout)
+	}
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], stderr)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thediveo/tiap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("git describe", Serial, func() {
+
+	// fakeGit sets up a fake git binary running the specified shell script.
+	fakeGit := func(script string) {
+		GinkgoHelper()
+		bin := filepath.Join(GinkgoT().TempDir(), "git")
+		Expect(os.WriteFile(bin, []byte("#!/bin/sh\n"+script+"\n"), 0755)).To(Succeed())
+		GinkgoT().Setenv(tiap.GitEnvVar, bin)
+	}
+
+	It("describes using the configured git binary", func(ctx context.Context) {
+		fakeGit(`[ "$1" = describe ] && echo v1.2.3`)
+		Expect(gitDescribe(ctx, "", time.Second)).To(Equal("v1.2.3"))
+	})
+
+	It("reports failures", func(ctx context.Context) {
+		fakeGit("echo 'fatal: no names found' >&2; exit 128")
+		Expect(gitDescribe(ctx, "", time.Second)).Error().To(
+			MatchError("git describe failed: fatal: no names found\n"))
+	})
+
+	It("times out on a slow git", func(ctx context.Context) {
+		fakeGit("sleep 10; echo v1.2.3")
+		start := time.Now()
+		Expect(gitDescribe(ctx, "", 200*time.Millisecond)).Error().To(
+			MatchError("git describe timed out after 200ms"))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	Context("release notes from git", func() {
+
+		// fakeHistory stubs a git history with the commits since the previous
+		// tag v1.0.0 and the full history, optionally without any previous
+		// tag at all.
+		fakeHistory := func(prevTag bool) {
+			GinkgoHelper()
+			describe := `echo 'fatal: No names found' >&2; exit 128`
+			if prevTag {
+				describe = `echo v1.0.0`
+			}
+			fakeGit(`case "$1" in
+describe) ` + describe + ` ;;
+log) case "$3" in
+	v1.0.0..HEAD) printf 'fix frobnication\nadd widget\n' ;;
+	v0.9.0..v1.0.0) echo 'initial widget' ;;
+	HEAD) printf 'fix frobnication\nadd widget\ninitial widget\n' ;;
+	*) echo "fatal: bad revision '$3'" >&2; exit 128 ;;
+	esac ;;
+esac`)
+		}
+
+		It("defaults to the commits since the previous tag", func(ctx context.Context) {
+			fakeHistory(true)
+			Expect(gitReleaseNotes(ctx, "", defaultNotesRange, time.Second)).To(Equal(
+				"- fix frobnication\n- add widget"))
+		})
+
+		It("uses the whole history without a previous tag", func(ctx context.Context) {
+			fakeHistory(false)
+			Expect(gitReleaseNotes(ctx, "", defaultNotesRange, time.Second)).To(Equal(
+				"- fix frobnication\n- add widget\n- initial widget"))
+		})
+
+		It("uses an explicit range", func(ctx context.Context) {
+			fakeHistory(true)
+			Expect(gitReleaseNotes(ctx, "", "v0.9.0..v1.0.0", time.Second)).To(Equal(
+				"- initial widget"))
+			Expect(gitReleaseNotes(ctx, "", "v0.0.0..HEAD", time.Second)).Error().To(
+				MatchError("git log failed: fatal: bad revision 'v0.0.0..HEAD'\n"))
+		})
+
+		It("rejects explicit release notes at the same time", func() {
+			cmd := newRootCmd()
+			cmd.SetArgs([]string{"-o", "/tmp/nada.app",
+				"--" + releaseNotesFlag, "foo", "--" + notesFromGitFlag, "testdata"})
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			Expect(cmd.Execute()).To(MatchError(ContainSubstring("were all set")))
+		})
+
+	})
+
+})
@@ -0,0 +1,107 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/tiap"
+)
+
+const diffOutputFlag = "output"
+
+// newDiffCmd returns a new “diff” command that compares two app packages.
+func newDiffCmd() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff OLD.app NEW.app [--output text|json]",
+		Short: "compare details, images, and services of two app packages",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output := successfully(cmd.Flags().GetString(diffOutputFlag))
+			if output != "text" && output != "json" {
+				return withExitCode(exitUsage,
+					fmt.Errorf("unsupported output format %q, must be \"text\" or \"json\"", output))
+			}
+			diff, err := tiap.DiffPackages(args[0], args[1])
+			if err != nil {
+				return withClassifiedExitCode(exitValidation, err)
+			}
+			if output == "json" {
+				return withExitCode(exitIO, writeDiffJSON(cmd.OutOrStdout(), diff))
+			}
+			return withExitCode(exitIO, writeDiff(cmd.OutOrStdout(), diff))
+		},
+	}
+	diffCmd.Flags().String(diffOutputFlag, "text", "output format, either \"text\" or \"json\"")
+	return diffCmd
+}
+
+// writeDiff writes the specified package diff in human-readable form.
+func writeDiff(w io.Writer, diff *tiap.PackageDiff) error {
+	if diff.Empty() {
+		_, err := fmt.Fprintln(w, "no differences")
+		return err
+	}
+	for _, section := range []struct {
+		title   string
+		changes []tiap.Change
+	}{
+		{title: "details", changes: diff.Details},
+		{title: "images", changes: diff.Images},
+		{title: "services", changes: diff.Services},
+	} {
+		if len(section.changes) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s:\n", section.title); err != nil {
+			return err
+		}
+		for _, change := range section.changes {
+			var err error
+			switch change.Kind {
+			case tiap.ChangeAdded:
+				_, err = fmt.Fprintf(w, "  + %s: %s\n", change.Name, diffValue(change.New))
+			case tiap.ChangeRemoved:
+				_, err = fmt.Fprintf(w, "  - %s: %s\n", change.Name, diffValue(change.Old))
+			default:
+				_, err = fmt.Fprintf(w, "  ~ %s: %s -> %s\n",
+					change.Name, diffValue(change.Old), diffValue(change.New))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffValue returns a compact textual representation of the specified value.
+func diffValue(value any) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+// writeDiffJSON writes the specified package diff in JSON format.
+func writeDiffJSON(w io.Writer, diff *tiap.PackageDiff) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diff)
+}
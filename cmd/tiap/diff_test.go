@@ -0,0 +1,91 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thediveo/tiap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("diff", func() {
+
+	var oldPkg, newPkg string
+
+	build := func(version string) string {
+		GinkgoHelper()
+		app := Successful(tiap.NewApp("../../testdata/app"))
+		defer app.Done()
+		Expect(app.SetDetails(version, "notes", "")).To(Succeed())
+		Expect(app.WriteCompose()).To(Succeed())
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(app.Package(out)).To(Succeed())
+		return out
+	}
+
+	BeforeEach(func() {
+		out := logrus.StandardLogger().Out
+		DeferCleanup(func() { logrus.SetOutput(out) })
+		logrus.SetOutput(GinkgoWriter)
+		oldPkg = build("1.0.0")
+		newPkg = build("1.1.0")
+	})
+
+	run := func(args ...string) (string, error) {
+		GinkgoHelper()
+		var out bytes.Buffer
+		cmd := newRootCmd()
+		cmd.SetArgs(append([]string{"diff"}, args...))
+		cmd.SetOut(&out)
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	It("reports differences in text form", func() {
+		out := Successful(run(oldPkg, newPkg))
+		Expect(out).To(HavePrefix("details:\n"))
+		Expect(out).To(ContainSubstring("  ~ versionNumber: \"1.0.0\" -> \"1.1.0\"\n"))
+		Expect(out).NotTo(ContainSubstring("services:"))
+
+		Expect(run(oldPkg, oldPkg)).To(Equal("no differences\n"))
+	})
+
+	It("reports differences in JSON form", func() {
+		var diff tiap.PackageDiff
+		Expect(json.Unmarshal([]byte(Successful(run("--output", "json", oldPkg, newPkg))), &diff)).
+			To(Succeed())
+		Expect(diff.Details).To(ContainElement(And(
+			HaveField("Name", "versionNumber"), HaveField("Kind", tiap.ChangeChanged))))
+		Expect(diff.Images).To(BeEmpty())
+	})
+
+	It("rejects invalid arguments", func() {
+		Expect(run(oldPkg)).Error().To(HaveOccurred())
+		Expect(run("--output", "yaml", oldPkg, newPkg)).Error().To(
+			MatchError(ContainSubstring("unsupported output format")))
+		Expect(run(oldPkg, "nada-nothing-nil.app")).Error().To(
+			MatchError(ContainSubstring("cannot read IE app package")))
+	})
+
+})
@@ -0,0 +1,77 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/moby/moby/client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// daemonPingTimeout limits how long to wait for the Docker daemon to answer
+// the initial ping.
+var daemonPingTimeout = 10 * time.Second
+
+// newDockerClient returns a new Docker/Moby client, either for the specified
+// daemon host or otherwise as configured by the environment.
+func newDockerClient(dockerHost string) (*client.Client, error) {
+	log.Debugf("🐛 creating Docker/Moby client")
+	opts := []client.Opt{
+		client.WithAPIVersionNegotiation(),
+	}
+	if dockerHost != "" {
+		opts = append(opts, client.WithHost(dockerHost))
+	} else {
+		opts = append(opts, client.WithHostFromEnv())
+	}
+	moby, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot contact Docker daemon, reason: %w", err)
+	}
+	log.Debugf("🐛 Docker/Moby client created")
+	return moby, nil
+}
+
+// pingDaemon checks that the Docker daemon is reachable, so that connection
+// problems surface before any staging work gets done. Failing connections are
+// retried up to the specified number of times, doubling the specified delay
+// with each further retry, as for image pulls.
+func pingDaemon(ctx context.Context, moby *client.Client, retries int, delay time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		pingctx, cancel := context.WithTimeout(ctx, daemonPingTimeout)
+		_, err := moby.Ping(pingctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt >= retries || !client.IsErrConnectionFailed(err) || ctx.Err() != nil {
+			return fmt.Errorf("cannot reach Docker daemon at %s (use --pull-always or --skip-daemon-check to bypass), reason: %w",
+				moby.DaemonHost(), err)
+		}
+		log.Warn(fmt.Sprintf("⏳  pinging Docker daemon failed, retrying in %s: %s", delay, err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cannot reach Docker daemon at %s, reason: %w", moby.DaemonHost(), ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	log.Debugf("🐛 Docker daemon at %s is reachable", moby.DaemonHost())
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("Docker daemon check", func() {
+
+	It("reports an unreachable daemon", Serial, func(ctx context.Context) {
+		old := daemonPingTimeout
+		DeferCleanup(func() { daemonPingTimeout = old })
+		daemonPingTimeout = 2 * time.Second
+
+		moby := Successful(newDockerClient("tcp://127.0.0.1:1"))
+		defer moby.Close()
+		Expect(pingDaemon(ctx, moby, 1, 10*time.Millisecond)).To(MatchError(
+			ContainSubstring("cannot reach Docker daemon at tcp://127.0.0.1:1")))
+	})
+
+	It("fails before staging when the daemon is unreachable", func() {
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{"-o", "/tmp/nada.app", "-H", "tcp://127.0.0.1:1",
+			"testdata/nada-nothing-nil"})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring("cannot reach Docker daemon")))
+	})
+
+})
@@ -0,0 +1,105 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes, so that CI pipelines can react differently to different classes
+// of failures, such as retrying transient registry failures, but not invalid
+// app templates.
+const (
+	exitFailure    = 1 // any other failure
+	exitUsage      = 2 // invalid command line flags or arguments
+	exitValidation = 3 // app template or images failed checks
+	exitRegistry   = 4 // registry, network, or Docker daemon failure
+	exitIO         = 5 // reading or writing files failed
+)
+
+// exitCodeError is an error annotated with the exit code tiap should exit
+// with.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// withExitCode annotates the specified error with the specified exit code,
+// unless the error is nil or already annotated.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// withClassifiedExitCode annotates the specified error with an exit code
+// according to the kind of failure: errors accessing files are I/O failures,
+// while registry transport and network errors are registry failures. All other
+// errors get annotated with the specified fallback exit code instead. As with
+// withExitCode, already annotated errors are left untouched.
+func withClassifiedExitCode(fallback int, err error) error {
+	var pathErr *fs.PathError
+	var transportErr *transport.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &pathErr):
+		return withExitCode(exitIO, err)
+	case errors.As(err, &transportErr), errors.As(err, &netErr):
+		return withExitCode(exitRegistry, err)
+	}
+	return withExitCode(fallback, err)
+}
+
+// exitCode returns the exit code for the specified error returned when
+// executing the root command. Errors not annotated with an exit code stem from
+// cobra's command line parsing and thus are usage errors.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitUsage
+}
+
+// withExitCodes annotates the errors returned by the specified command and its
+// subcommands by their kind of failure, defaulting to exitFailure, unless
+// already annotated with a more specific exit code, in order to tell them
+// apart from cobra's usage errors.
+func withExitCodes(cmd *cobra.Command) {
+	if runE := cmd.RunE; runE != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return withClassifiedExitCode(exitFailure, runE(cmd, args))
+		}
+	}
+	for _, subcmd := range cmd.Commands() {
+		withExitCodes(subcmd)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("exit codes", func() {
+
+	It("annotates errors with exit codes", func() {
+		Expect(exitCode(nil)).To(BeZero())
+		Expect(withExitCode(exitIO, nil)).To(Succeed())
+
+		err := withExitCode(exitRegistry, errors.New("D'OH!"))
+		Expect(err).To(MatchError("D'OH!"))
+		Expect(exitCode(err)).To(Equal(exitRegistry))
+		Expect(exitCode(fmt.Errorf("wrapped: %w", err))).To(Equal(exitRegistry))
+		Expect(exitCode(withExitCode(exitFailure, err))).To(Equal(exitRegistry))
+
+		Expect(exitCode(errors.New("unknown flag: --foo"))).To(Equal(exitUsage))
+	})
+
+	It("classifies errors by their kind of failure", func() {
+		Expect(withClassifiedExitCode(exitFailure, nil)).To(Succeed())
+
+		_, err := os.Open(filepath.Join(GinkgoT().TempDir(), "nada-nothing-nil"))
+		Expect(exitCode(withClassifiedExitCode(exitFailure,
+			fmt.Errorf("wrapped: %w", err)))).To(Equal(exitIO))
+
+		_, err = net.Dial("tcp", "127.0.0.1:1")
+		Expect(exitCode(withClassifiedExitCode(exitFailure, err))).To(Equal(exitRegistry))
+		Expect(exitCode(withClassifiedExitCode(exitFailure,
+			&transport.Error{StatusCode: http.StatusNotFound}))).To(Equal(exitRegistry))
+
+		Expect(exitCode(withClassifiedExitCode(exitValidation, errors.New("D'OH!")))).
+			To(Equal(exitValidation))
+		Expect(exitCode(withClassifiedExitCode(exitValidation,
+			withExitCode(exitUsage, err)))).To(Equal(exitUsage))
+	})
+
+	// latestTemplate returns a copy of the hellorld app template, but with its
+	// service using a latest image.
+	latestTemplate := func() string {
+		GinkgoHelper()
+		template := GinkgoT().TempDir()
+		Expect(os.CopyFS(template, os.DirFS("../../testdata/app"))).To(Succeed())
+		compose := filepath.Join(template, "hellorld", "docker-compose.yaml")
+		Expect(os.WriteFile(compose, []byte(`services:
+  hellorld:
+    image: busybox:latest
+    mem_limit: 8mb
+`), 0644)).To(Succeed())
+		return template
+	}
+
+	DescribeTable("exiting per failure class",
+		func(code int, args ...string) {
+			for idx, arg := range args {
+				if arg == "LATEST-TEMPLATE" {
+					args[idx] = latestTemplate()
+				}
+			}
+			cmd := newRootCmd()
+			cmd.SetArgs(args)
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			Expect(exitCode(cmd.Execute())).To(Equal(code))
+		},
+		Entry("unknown flag", exitUsage,
+			"-o", "/tmp/nada.app", "--nada-nothing-nil"),
+		Entry("too many arguments", exitUsage,
+			"-o", "/tmp/nada.app", "foo", "bar"),
+		Entry("invalid flag value", exitUsage,
+			"-o", "/tmp/nada.app", "--"+pinDigestsFlag, "testdata/nada-nothing-nil"),
+		Entry("invalid parallelism", exitUsage,
+			"-o", "/tmp/nada.app", "--"+parallelFlag, "0", "testdata/nada-nothing-nil"),
+		Entry("negative package owner", exitUsage,
+			"-o", "/tmp/nada.app", "--"+packageUIDFlag, "-1", "testdata/nada-nothing-nil"),
+		Entry("unreachable daemon", exitRegistry,
+			"-o", "/tmp/nada.app", "-H", "tcp://127.0.0.1:1", "testdata/nada-nothing-nil"),
+		Entry("invalid template", exitValidation,
+			"-o", "/tmp/nada.app", "--"+noBundleFlag, "--"+appVersionFlag, "1.2.3", "LATEST-TEMPLATE"),
+		Entry("unwritable package", exitIO,
+			"-o", "/nada-nothing-nil/nada.app", "--"+noBundleFlag, "--"+appVersionFlag, "1.2.3",
+			"../../testdata/app"),
+		Entry("missing image lockfile", exitIO,
+			"-o", "/tmp/nada.app", "--"+noBundleFlag, "--"+appVersionFlag, "1.2.3",
+			"--"+imageLockFlag, "testdata/nada-nothing-nil.lock", "../../testdata/app"),
+		Entry("missing packages to diff", exitIO,
+			"diff", "testdata/nada-nothing-nil.app", "testdata/nada-nothing-nil.app"),
+		Entry("invalid diff output format", exitUsage,
+			"diff", "--"+diffOutputFlag, "xml", "testdata/nada-nothing-nil.app", "testdata/nada-nothing-nil.app"),
+		Entry("mistyped reseal flag", exitUsage,
+			"reseal", "--gizp", "testdata/nada-nothing-nil.app"),
+		Entry("mistyped diff flag", exitUsage,
+			"diff", "--outptu", "json", "testdata/nada-nothing-nil.app", "testdata/nada-nothing-nil.app"),
+		Entry("mistyped rules flag", exitUsage,
+			"rules", "--jsno"),
+	)
+
+})
@@ -0,0 +1,110 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Log formats supported by the --log-format flag.
+const (
+	autoLogFormat   = "auto"   // “github” inside GitHub Actions, “text” otherwise
+	textLogFormat   = "text"   // plain logrus text
+	githubLogFormat = "github" // warnings and errors as GitHub workflow commands
+)
+
+// resolveLogFormat returns the effective log format for the specified
+// --log-format value, auto-detecting GitHub Actions.
+func resolveLogFormat(format string) (string, error) {
+	switch format {
+	case autoLogFormat:
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			return githubLogFormat, nil
+		}
+		return textLogFormat, nil
+	case textLogFormat, githubLogFormat:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid log format %q, must be %q, %q, or %q",
+		format, autoLogFormat, textLogFormat, githubLogFormat)
+}
+
+// githubFormatter renders warnings and errors as GitHub workflow commands, so
+// that they show up as annotations in workflow runs and pull requests. A
+// “file” field of a log entry becomes the file the annotation refers to. All
+// other log entries are rendered by the wrapped text formatter.
+type githubFormatter struct {
+	text log.Formatter
+}
+
+var _ log.Formatter = (*githubFormatter)(nil)
+
+// Format renders the specified log entry.
+func (f *githubFormatter) Format(entry *log.Entry) ([]byte, error) {
+	var command string
+	switch entry.Level {
+	case log.WarnLevel:
+		command = "warning"
+	case log.ErrorLevel, log.FatalLevel, log.PanicLevel:
+		command = "error"
+	default:
+		return f.text.Format(entry)
+	}
+	var b bytes.Buffer
+	b.WriteString("::" + command)
+	if file, ok := entry.Data["file"].(string); ok && file != "" {
+		b.WriteString(" file=" + githubEscapeProperty(file))
+	}
+	b.WriteString("::" + githubEscapeData(entry.Message) + "\n")
+	return b.Bytes(), nil
+}
+
+// githubEscapeData escapes the message of a workflow command.
+func githubEscapeData(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+	).Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command.
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	).Replace(s)
+}
+
+// logFinalError logs the specified error that tiap is going to fail with,
+// referring to the file the error is about, if known.
+func logFinalError(err error) {
+	entry := log.NewEntry(log.StandardLogger())
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		entry = entry.WithField("file", pathErr.Path)
+	}
+	entry.Error(err.Error())
+}
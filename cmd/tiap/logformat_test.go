@@ -0,0 +1,85 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("GitHub log format", func() {
+
+	format := func(entry *log.Entry) string {
+		GinkgoHelper()
+		f := &githubFormatter{text: &log.TextFormatter{DisableTimestamp: true}}
+		return string(Successful(f.Format(entry)))
+	}
+
+	entry := func(level log.Level, msg string, fields ...log.Fields) *log.Entry {
+		e := log.NewEntry(log.StandardLogger())
+		for _, f := range fields {
+			e = e.WithFields(f)
+		}
+		e.Level = level
+		e.Message = msg
+		return e
+	}
+
+	It("auto-detects GitHub Actions", func() {
+		GinkgoT().Setenv("GITHUB_ACTIONS", "")
+		Expect(resolveLogFormat(autoLogFormat)).To(Equal(textLogFormat))
+		GinkgoT().Setenv("GITHUB_ACTIONS", "true")
+		Expect(resolveLogFormat(autoLogFormat)).To(Equal(githubLogFormat))
+		Expect(resolveLogFormat(textLogFormat)).To(Equal(textLogFormat))
+		Expect(resolveLogFormat("json")).Error().To(MatchError(
+			ContainSubstring(`invalid log format "json"`)))
+	})
+
+	It("renders warnings and errors as workflow commands", func() {
+		Expect(format(entry(log.WarnLevel, "⚠  foo"))).To(Equal("::warning::⚠  foo\n"))
+		Expect(format(entry(log.ErrorLevel, "100% bar\nbaz"))).To(
+			Equal("::error::100%25 bar%0Abaz\n"))
+		Expect(format(entry(log.WarnLevel, "foo", log.Fields{"file": "a:b,c.yaml"}))).To(
+			Equal("::warning file=a%3Ab%2Cc.yaml::foo\n"))
+	})
+
+	It("renders other log entries as text", func() {
+		Expect(format(entry(log.InfoLevel, "hellorld"))).To(
+			Equal("level=info msg=hellorld\n"))
+	})
+
+	It("refers final errors to their files", func() {
+		var buff bytes.Buffer
+		logger := log.StandardLogger()
+		out, formatter := logger.Out, logger.Formatter
+		DeferCleanup(func() { logger.SetOutput(out); logger.SetFormatter(formatter) })
+		logger.SetOutput(&buff)
+		logger.SetFormatter(&githubFormatter{text: formatter})
+
+		logFinalError(fmt.Errorf("cannot frobnicate, reason: %w",
+			&fs.PathError{Op: "open", Path: "/foo/bar", Err: os.ErrNotExist}))
+		Expect(buff.String()).To(Equal(
+			"::error file=/foo/bar::cannot frobnicate, reason: open /foo/bar: file does not exist\n"))
+	})
+
+})
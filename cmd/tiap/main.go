@@ -14,14 +14,22 @@
 
 package main
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 func main() {
+	rootCmd := newRootCmd()
+	if err := applyDefaultFlags(rootCmd, os.Getenv(optsEnvVar)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitUsage)
+	}
 	// This is cobra boilerplate documentation, except for the missing call to
 	// fmt.Println(err) which in the original boilerplate is just plain wrong:
 	// it renders the error message twice, see also:
 	// https://github.com/spf13/cobra/issues/304
-	if err := newRootCmd().Execute(); err != nil {
-		os.Exit(1)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(exitCode(err))
 	}
 }
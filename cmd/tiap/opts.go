@@ -0,0 +1,54 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// optsEnvVar names the environment variable containing default flags.
+const optsEnvVar = "TIAP_OPTS"
+
+// applyDefaultFlags sets the default flags from the “opts” string (taken from
+// the TIAP_OPTS environment variable) on the flags of the specified root
+// command, before executing it. As cobra later parses the command line flags
+// into the same flag set, explicitly specified command line flags always take
+// precedence over the default flags. The default flags are separated by
+// whitespace and must not contain any positional args, so that they cannot
+// accidentally specify the template. As the default flags never become part of
+// the command line args, subcommands never see them.
+func applyDefaultFlags(rootCmd *cobra.Command, opts string) error {
+	defaults := strings.Fields(opts)
+	if len(defaults) == 0 {
+		return nil
+	}
+	rootCmd.InitDefaultHelpFlag()
+	rootCmd.InitDefaultVersionFlag()
+	flags := rootCmd.Flags()
+	if err := flags.Parse(defaults); err != nil {
+		return fmt.Errorf("invalid %s, reason: %w", optsEnvVar, err)
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("invalid %s, must not contain positional args, but found %q",
+			optsEnvVar, flags.Args())
+	}
+	if flags.Changed("help") || flags.Changed("version") {
+		return fmt.Errorf("invalid %s, must not contain help or version flags", optsEnvVar)
+	}
+	return nil
+}
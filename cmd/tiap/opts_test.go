@@ -0,0 +1,78 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("default flags", func() {
+
+	It("ignores empty default flags", func() {
+		cmd := newRootCmd()
+		Expect(applyDefaultFlags(cmd, "  ")).To(Succeed())
+		Expect(cmd.ParseFlags([]string{"-o", "foo.app", "template"})).To(Succeed())
+		Expect(cmd.Flags().Args()).To(HaveExactElements("template"))
+	})
+
+	It("lets explicit flags override default flags", func() {
+		cmd := newRootCmd()
+		Expect(applyDefaultFlags(cmd, "--platform arm64 --pull-always")).To(Succeed())
+		Expect(cmd.ParseFlags([]string{
+			"--platform=amd64", "--pull-always=false", "-o", "foo.app", "template"})).To(Succeed())
+		Expect(cmd.Flags().GetString(platformFlag)).To(Equal("amd64"))
+		Expect(cmd.Flags().GetBool(pullAlwaysFlag)).To(BeFalse())
+		Expect(cmd.Flags().Args()).To(HaveExactElements("template"))
+	})
+
+	It("keeps default flags not overridden", func() {
+		cmd := newRootCmd()
+		Expect(applyDefaultFlags(cmd, "--platform=arm64 --debug")).To(Succeed())
+		Expect(cmd.ParseFlags([]string{"-o", "foo.app", "template"})).To(Succeed())
+		Expect(cmd.Flags().GetString(platformFlag)).To(Equal("arm64"))
+		Expect(cmd.Flags().GetBool(debugFlag)).To(BeTrue())
+	})
+
+	It("doesn't pass default flags to subcommands", func() {
+		out := logrus.StandardLogger().Out
+		DeferCleanup(func() { logrus.SetOutput(out) })
+		logrus.SetOutput(GinkgoWriter)
+
+		cmd := newRootCmd()
+		Expect(applyDefaultFlags(cmd, "--gzip --platform arm64")).To(Succeed())
+		cmd.SetArgs([]string{"reseal", filepath.Join(GinkgoT().TempDir(), "nada-nothing-nil.app")})
+		cmd.SetOut(GinkgoWriter)
+		cmd.SetErr(GinkgoWriter)
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring("nada-nothing-nil.app")))
+	})
+
+	DescribeTable("rejecting invalid default flags",
+		func(opts string, errmsg string) {
+			Expect(applyDefaultFlags(newRootCmd(), opts)).To(
+				MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "--nada-nothing-nil", "unknown flag"),
+		Entry(nil, "--debug template", "must not contain positional args"),
+		Entry(nil, "--debug -- template", "must not contain positional args"),
+		Entry(nil, "--platform", "needs an argument"),
+		Entry(nil, "--help", "must not contain help or version flags"),
+	)
+
+})
@@ -0,0 +1,38 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/thediveo/tiap"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logProgress renders image pull progress as log lines, so that the CLI
+// doesn't go quiet during long pulls. The final image sizes are already logged
+// by the tiap package itself.
+func logProgress(p tiap.PullProgress) {
+	switch p.State {
+	case tiap.PullStarted:
+		log.Info(fmt.Sprintf("   ⏬  pulling 🖼  image %q...", p.Ref))
+	case tiap.PullTransferring:
+		log.Info(fmt.Sprintf("   ⏳  🖼  image %q: %s written after %s",
+			p.Ref, units.HumanSize(float64(p.Bytes)), p.Duration.Round(time.Second)))
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thediveo/tiap"
+)
+
+// newResealCmd returns a new “reseal” command that recomputes the digests of
+// an existing app package, such as after modifying it out-of-band.
+func newResealCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reseal PACKAGE.app[.gz]",
+		Short: "recompute digests.json of an app package after modifying it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withExitCode(exitIO, tiap.ResealPackage(args[0]))
+		},
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thediveo/tiap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("reseal", func() {
+
+	BeforeEach(func() {
+		out := logrus.StandardLogger().Out
+		DeferCleanup(func() { logrus.SetOutput(out) })
+		logrus.SetOutput(GinkgoWriter)
+	})
+
+	run := func(args ...string) error {
+		GinkgoHelper()
+		cmd := newRootCmd()
+		cmd.SetArgs(append([]string{"reseal"}, args...))
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return cmd.Execute()
+	}
+
+	It("reseals an app package", func() {
+		app := Successful(tiap.NewApp("../../testdata/app"))
+		defer app.Done()
+		Expect(app.SetDetails("1.0.0", "", "")).To(Succeed())
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(app.Package(out)).To(Succeed())
+
+		Expect(run(out)).To(Succeed())
+	})
+
+	It("reseals a gzip'ed app package", func() {
+		app := Successful(tiap.NewApp("../../testdata/app"))
+		defer app.Done()
+		Expect(app.SetDetails("1.0.0", "", "")).To(Succeed())
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app.gz")
+		Expect(app.Package(out, tiap.WithGzip())).To(Succeed())
+
+		Expect(run(out)).To(Succeed())
+		Expect(Successful(os.ReadFile(out))[:2]).To(Equal([]byte{0x1f, 0x8b}))
+	})
+
+	It("reports failures", func() {
+		err := run("testdata/nada-nothing-nil.app")
+		Expect(err).To(MatchError(ContainSubstring("cannot read IE app package")))
+		Expect(exitCode(err)).To(Equal(exitIO))
+		Expect(exitCode(run())).To(Equal(exitUsage))
+	})
+
+})
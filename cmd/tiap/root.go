@@ -17,33 +17,95 @@ package main
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/containerd/platforms"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/moby/moby/client"
 	ispecsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/thediveo/tiap"
 	"golang.org/x/exp/slices"
 	"golang.org/x/sys/unix"
+	"golang.org/x/time/rate"
 )
 
 const (
-	outnameFlag      = "out"
-	appVersionFlag   = "app-version"
-	releaseNotesFlag = "release-notes"
-	platformFlag     = "platform"
-	pullAlwaysFlag   = "pull-always"
-	dockerHostFlag   = "host"
-	debugFlag        = "debug"
+	outnameFlag         = "out"
+	appVersionFlag      = "app-version"
+	releaseNotesFlag    = "release-notes"
+	platformFlag        = "platform"
+	pullAlwaysFlag      = "pull-always"
+	dockerHostFlag      = "host"
+	debugFlag           = "debug"
+	registryRateFlag    = "registry-rate"
+	logTimeFormatFlag   = "log-time-format"
+	noLogTimeFlag       = "no-log-time"
+	logFormatFlag       = "log-format"
+	lintFlag            = "lint"
+	composeJSONFlag     = "emit-compose-json"
+	checkPortsFlag      = "check-ports"
+	keepTempFlag        = "keep-temp"
+	resumeFlag          = "resume"
+	qualifyImagesFlag   = "qualify-images"
+	imageDigestsFlag    = "image-digests"
+	strictYAMLFlag      = "strict-yaml"
+	summaryOnlyFlag     = "summary-only"
+	addFileFlag         = "add-file"
+	forceFlag           = "force"
+	maxFilesFlag        = "max-files"
+	packageUIDFlag      = "package-uid"
+	packageGIDFlag      = "package-gid"
+	gzipFlag            = "gzip"
+	sbomFlag            = "sbom"
+	deviceProfileFlag   = "device-profile"
+	warnMovingFlag      = "warn-moving-tags"
+	rejectMovingFlag    = "reject-moving-tags"
+	movingTagsFlag      = "moving-tags"
+	placeholdersFlag    = "check-placeholders"
+	placeholderFlag     = "placeholder-fields"
+	pruneEmptyFlag      = "prune-empty-detail"
+	validatorFlag       = "validator"
+	imageLockFlag       = "image-lock"
+	skipDaemonCheckFlag = "skip-daemon-check"
+	notesTemplateFlag   = "release-notes-template"
+	pipelineFlag        = "pipeline-digests"
+	gitTimeoutFlag      = "git-timeout"
+	inputsDigestFlag    = "inputs-digest"
+	mirrorToFlag        = "mirror-to"
+	digestAlgoFlag      = "digest-algorithm"
+	symlinksFlag        = "symlinks"
+	normalizePermsFlag  = "normalize-permissions"
+	stagePathFlag       = "stage-path"
+	archFlag            = "arch"
+	compressImagesFlag  = "compress-images"
+	watchFlag           = "watch"
+	strictPermsFlag     = "strict-perms"
+	notesFromGitFlag    = "release-notes-from-git"
+	verifyArchFlag      = "verify-saved-arch"
+	profileFlag         = "profile"
+	noBundleFlag        = "no-bundle-images"
+	pinDigestsFlag      = "pin-digests"
+	notesRawFlag        = "release-notes-raw"
+	allowLatestFlag     = "allow-latest"
+	parallelFlag        = "parallel"
+	pullByDepsFlag      = "pull-by-dependencies"
+	pullRetriesFlag     = "pull-retries"
+	pullRetryDelayFlag  = "pull-retry-delay"
+	registryFlag        = "registry"
+	registryUserFlag    = "registry-user"
+	registryPassFlag    = "registry-password"
 )
 
 func successfully[R any](r R, err error) R {
@@ -53,13 +115,6 @@ func successfully[R any](r R, err error) R {
 	return r
 }
 
-func unerringly[R any](r R, err error) R {
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	return r
-}
-
 // thisPlatform returns a platform specification consisting of only the
 // architecture of the OS we're currently running on. We don't need the OS as
 // Industrial Edge supports Linux only.
@@ -86,6 +141,202 @@ func denormalize(p ispecsv1.Platform) ispecsv1.Platform {
 	return p
 }
 
+// parsePlatform parses the specified platform. As “detail.json” can represent
+// only a single IE App architecture, parsePlatform rejects multiple
+// comma-separated platforms. However, it tolerates redundant entries, such as
+// “linux/amd64,amd64”, warning about them. The platforms “host” and “native”
+// refer to the platform of the build host.
+func parsePlatform(spec string) (ispecsv1.Platform, error) {
+	var unique []ispecsv1.Platform
+	for _, entry := range strings.Split(spec, ",") {
+		platform, err := parseSinglePlatform(strings.TrimSpace(entry))
+		if err != nil {
+			return ispecsv1.Platform{}, err
+		}
+		if slices.ContainsFunc(unique, func(p ispecsv1.Platform) bool {
+			return platformKey(p) == platformKey(platform)
+		}) {
+			log.Warn(fmt.Sprintf("⚠  ignoring redundant platform %q", entry))
+			continue
+		}
+		unique = append(unique, platform)
+	}
+	if len(unique) > 1 {
+		return ispecsv1.Platform{}, fmt.Errorf(
+			"multiple platforms %q not supported, as detail.json supports only a single architecture; build a separate app per platform",
+			spec)
+	}
+	return unique[0], nil
+}
+
+// parseSinglePlatform parses and normalizes the specified single platform,
+// taking the “host” and “native” aliases into account.
+func parseSinglePlatform(spec string) (ispecsv1.Platform, error) {
+	switch spec {
+	case "host", "native":
+		platform := thisPlatform()
+		platform.OS = "linux"
+		return platform, nil
+	}
+	platform, err := platforms.Parse(spec)
+	if err != nil {
+		return ispecsv1.Platform{}, fmt.Errorf("invalid platform %q, reason: %w", spec, err)
+	}
+	return platforms.Normalize(platform), nil
+}
+
+// platformKey returns the normalized form of the specified platform for
+// detecting equivalent platforms. As Industrial Edge supports only Linux, and
+// platforms without an explicit OS default to the build host's OS, the OS is
+// always taken to be Linux.
+func platformKey(platform ispecsv1.Platform) string {
+	platform.OS = "linux"
+	return platforms.Format(platforms.Normalize(platform))
+}
+
+// sbomName returns the name of the SBOM sidecar file in the specified format
+// for the named app package file.
+func sbomName(outname string, format string) string {
+	outname = strings.TrimSuffix(outname, ".gz")
+	return strings.TrimSuffix(outname, filepath.Ext(outname)) + tiap.SBOMExtensions[format]
+}
+
+// outputFiles returns the names of the app package file and all its potential
+// sidecar files, so that they can be excluded from staging and watching in
+// case they get written into the app template directory.
+func outputFiles(outname string) []string {
+	files := []string{outname}
+	for format := range tiap.SBOMExtensions {
+		files = append(files, sbomName(outname, format))
+	}
+	return files
+}
+
+// writeSBOM writes an SBOM in the specified format as a sidecar file next to
+// the app package file, such as “hellorld.cdx.json” for “hellorld.app” as well
+// as “hellorld.app.gz”.
+func writeSBOM(app *tiap.App, format string, platform string, outname string) error {
+	f, err := os.Create(sbomName(outname, format))
+	if err != nil {
+		return fmt.Errorf("cannot create SBOM file, reason: %w", err)
+	}
+	defer f.Close()
+	if err := app.WriteSBOM(f, format, platform); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// parseReleaseNotes returns the release notes from the specified flag value.
+// Unless raw, the value is interpreted as a double-quoted Go string literal,
+// but without the quotes and additionally allowing literal newlines.
+func parseReleaseNotes(notes string, raw bool) (string, error) {
+	if raw {
+		return notes, nil
+	}
+	rn := strings.Replace(notes, "\n", "\\n", -1)
+	releaseNotes, err := strconv.Unquote(`"` + rn + `"`)
+	if err != nil {
+		return "", fmt.Errorf("release notes %q: %w", notes, err)
+	}
+	return releaseNotes, nil
+}
+
+// parseAddFile parses an additional file specification in the form of
+// “SRC:DESTPATH”. As the destination path is package-relative, it never
+// contains colons, so the source path might.
+func parseAddFile(spec string) (src string, dest string, err error) {
+	idx := strings.LastIndex(spec, ":")
+	if idx <= 0 || idx == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid additional file %q, must be SRC:DESTPATH", spec)
+	}
+	return spec[:idx], spec[idx+1:], nil
+}
+
+// nonOutputFlags lists the flags not affecting the contents of the app
+// package produced, but only logging, diagnostics, checks, and how images get
+// pulled. The additional files get digested by their contents instead of
+// their source paths.
+var nonOutputFlags = []string{
+	addFileFlag, outnameFlag, pullAlwaysFlag, dockerHostFlag, debugFlag, registryRateFlag,
+	logTimeFormatFlag, noLogTimeFlag, logFormatFlag, lintFlag, checkPortsFlag,
+	keepTempFlag, resumeFlag, strictYAMLFlag, summaryOnlyFlag, maxFilesFlag,
+	warnMovingFlag, rejectMovingFlag, movingTagsFlag, placeholdersFlag,
+	placeholderFlag, validatorFlag, imageLockFlag, skipDaemonCheckFlag,
+	gitTimeoutFlag, inputsDigestFlag, mirrorToFlag, watchFlag, strictPermsFlag,
+	verifyArchFlag, allowLatestFlag, parallelFlag, pullByDepsFlag,
+	pullRetriesFlag, pullRetryDelayFlag, registryFlag, registryUserFlag,
+	registryPassFlag,
+}
+
+// inputsDigestFlags returns the values of all explicitly set flags that
+// (might) affect the contents of the app package produced, keyed by
+// “flag:NAME”. Flags are considered to affect the output unless listed in
+// nonOutputFlags, so that newly added flags err on the side of rebuilding.
+func inputsDigestFlags(flags *pflag.FlagSet) map[string]string {
+	params := map[string]string{}
+	flags.Visit(func(flag *pflag.Flag) {
+		if slices.Contains(nonOutputFlags, flag.Name) {
+			return
+		}
+		params["flag:"+flag.Name] = flag.Value.String()
+	})
+	return params
+}
+
+// parseDigestAlgorithms parses digest algorithm overrides in the form of
+// “PATH=ALGORITHM”, returning them as a map of paths to algorithms.
+func parseDigestAlgorithms(specs []string) (map[string]string, error) {
+	algorithms := map[string]string{}
+	for _, spec := range specs {
+		path, algorithm, ok := strings.Cut(spec, "=")
+		if !ok || path == "" || algorithm == "" {
+			return nil, fmt.Errorf("invalid digest algorithm override %q, must be PATH=ALGORITHM", spec)
+		}
+		algorithms[path] = strings.ToLower(algorithm)
+	}
+	return algorithms, nil
+}
+
+// parseRegistryRate parses a registry rate limit in the form of “N/PERIOD”,
+// such as “10/1m” or “1/s”, returning a rate limiter allowing bursts of up to
+// N requests. An empty rate limit specification means no rate limiter.
+func parseRegistryRate(spec string) (*rate.Limiter, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	count, per, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid registry rate %q, expected N/PERIOD", spec)
+	}
+	n, err := strconv.ParseUint(count, 10, 31)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid registry rate count %q", count)
+	}
+	// allow “s”, “m”, and “h” without a leading number as shorthands for a
+	// single second, minute, or hour.
+	if per != "" && strings.IndexAny(per[:1], "0123456789") < 0 {
+		per = "1" + per
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("invalid registry rate period %q", per)
+	}
+	return rate.NewLimiter(rate.Every(period/time.Duration(n)), int(n)), nil
+}
+
+// newLogFormatter returns the log formatter to use, given the time format and
+// whether to omit time stamps altogether. When the time format hasn't been
+// explicitly set, logrus' default of logging only the elapsed seconds on
+// terminals is kept.
+func newLogFormatter(timeFormat string, explicitFormat bool, noTime bool) log.Formatter {
+	return &log.TextFormatter{
+		TimestampFormat:  timeFormat,
+		FullTimestamp:    explicitFormat,
+		DisableTimestamp: noTime,
+	}
+}
+
 // buildInfo returns the value of the specified key into the BuildSettings.
 func buildInfo(info *debug.BuildInfo, key string) string {
 	idx := slices.IndexFunc(info.Settings,
@@ -98,13 +349,68 @@ func buildInfo(info *debug.BuildInfo, key string) string {
 	return info.Settings[idx].Value
 }
 
+// packageName returns the name of the app package file to write, adding the
+// “.app” extension if there's no extension yet. For gzip'ed app packages,
+// packageName adds the “.app.gz” extension instead, or “.gz” to “.app”.
+func packageName(outname string, gzipped bool) string {
+	switch ext := filepath.Ext(outname); {
+	case ext == "" && gzipped:
+		return outname + ".app.gz"
+	case ext == "":
+		return outname + ".app"
+	case ext == ".app" && gzipped:
+		return outname + ".gz"
+	}
+	return outname
+}
+
+// templateArg returns the app template argument, defaulting to the current
+// working directory if not specified.
+func templateArg(args []string) string {
+	if len(args) == 0 {
+		return "."
+	}
+	return args[0]
+}
+
 func newRootCmd() (rootCmd *cobra.Command) {
+	// In watch mode, the image cache directory shared by successive builds.
+	var imageCacheDir string
 	rootCmd = &cobra.Command{
-		Use:     "tiap -o FILE [flags] APP-TEMPLATE-DIR",
+		Use:     "tiap -o FILE [flags] [APP-TEMPLATE-DIR|GIT-URL[#REF[:SUBDIR]]]",
 		Short:   "tiap isn't app publisher, but packages Industrial Edge .app files anyway",
 		Version: `":latest"`, // sorry :p
-		Args:    cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			ctx := cmd.Context()
+			start := time.Now()
+			summaryOnly := successfully(rootCmd.Flags().GetBool(summaryOnlyFlag))
+			if summaryOnly {
+				// only warnings and errors, unless debug logging is enabled
+				// below.
+				logrus.SetLevel(log.WarnLevel)
+			}
+			log.SetFormatter(newLogFormatter(
+				successfully(rootCmd.Flags().GetString(logTimeFormatFlag)),
+				rootCmd.Flags().Changed(logTimeFormatFlag),
+				successfully(rootCmd.Flags().GetBool(noLogTimeFlag))))
+			logFormat, err := resolveLogFormat(
+				successfully(rootCmd.Flags().GetString(logFormatFlag)))
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
+			if logFormat == githubLogFormat {
+				log.SetFormatter(&githubFormatter{text: log.StandardLogger().Formatter})
+				// Report the final error as a workflow command, too, instead
+				// of cobra's plain “Error: ...”.
+				rootCmd.SilenceErrors = true
+				defer func() {
+					if err != nil {
+						logFinalError(err)
+					}
+				}()
+			}
+
 			log.Info("🗩  tiap ... isn't app publisher")
 			log.Info(fmt.Sprintf("   %s", rootCmd.Version))
 			log.Info("⚖  Apache 2.0 License")
@@ -114,37 +420,219 @@ func newRootCmd() (rootCmd *cobra.Command) {
 			}
 			log.Debug("🐛 debug logging enabled")
 
+			tiap.StrictParsing = successfully(rootCmd.Flags().GetBool(strictYAMLFlag))
+			pullRetries := successfully(rootCmd.Flags().GetInt(pullRetriesFlag))
+			pullRetryDelay := successfully(rootCmd.Flags().GetDuration(pullRetryDelayFlag))
+			parallel := successfully(rootCmd.Flags().GetInt(parallelFlag))
+			if rootCmd.Flags().Changed(parallelFlag) && parallel < 1 {
+				return withExitCode(exitUsage, fmt.Errorf("--%s must be at least 1", parallelFlag))
+			}
+			tiap.MaxFiles = successfully(rootCmd.Flags().GetInt(maxFilesFlag))
+			packageUID := successfully(rootCmd.Flags().GetInt(packageUIDFlag))
+			if packageUID < 0 {
+				return withExitCode(exitUsage, fmt.Errorf("--%s must not be negative", packageUIDFlag))
+			}
+			packageGID := successfully(rootCmd.Flags().GetInt(packageGIDFlag))
+			if packageGID < 0 {
+				return withExitCode(exitUsage, fmt.Errorf("--%s must not be negative", packageGIDFlag))
+			}
+			packageOpts := []tiap.PackageOption{tiap.WithUID(packageUID), tiap.WithGID(packageGID)}
+			gzipped := successfully(rootCmd.Flags().GetBool(gzipFlag))
+			if gzipped {
+				packageOpts = append(packageOpts, tiap.WithGzip())
+			}
+			digestAlgorithms, err := parseDigestAlgorithms(
+				successfully(rootCmd.Flags().GetStringArray(digestAlgoFlag)))
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
+			tiap.DigestAlgorithms = digestAlgorithms
+			tiap.StageSymlinks = successfully(rootCmd.Flags().GetString(symlinksFlag))
+			tiap.StagePreservePermissions = !successfully(rootCmd.Flags().GetBool(normalizePermsFlag))
+			tiap.StagePaths = successfully(rootCmd.Flags().GetStringArray(stagePathFlag))
+			// Never stage a previously written app package and its sidecars,
+			// such as when writing them into the app template directory.
+			absOutname, err := filepath.Abs(packageName(
+				successfully(rootCmd.Flags().GetString(outnameFlag)), gzipped))
+			if err != nil {
+				return withExitCode(exitIO, err)
+			}
+			tiap.StageExcludes = outputFiles(absOutname)
+
+			profileName := successfully(rootCmd.Flags().GetString(deviceProfileFlag))
+			profile, ok := tiap.DeviceProfiles[profileName]
+			if profileName != "" && !ok {
+				return withExitCode(exitUsage, fmt.Errorf("unknown device profile %q, must be \"small\" or \"large\"",
+					profileName))
+			}
+
+			sbomFormat := successfully(rootCmd.Flags().GetString(sbomFlag))
+			if _, ok := tiap.SBOMExtensions[sbomFormat]; sbomFormat != "" && !ok {
+				return withExitCode(exitUsage, fmt.Errorf("unsupported SBOM format %q, must be %q or %q",
+					sbomFormat, tiap.SBOMCycloneDX, tiap.SBOMSPDX))
+			}
+
+			for _, rule := range effectiveRules(rootCmd) {
+				log.Debugf("🐛 rule %s", rule)
+			}
+
+			noBundle := successfully(rootCmd.Flags().GetBool(noBundleFlag))
+			if successfully(rootCmd.Flags().GetBool(pinDigestsFlag)) && !noBundle {
+				return withExitCode(exitUsage, fmt.Errorf("--%s requires --%s", pinDigestsFlag, noBundleFlag))
+			}
+
+			// When using the Docker daemon, make sure early on that we can
+			// actually talk to it, before doing any cloning and staging work.
+			// Without bundling images, there's no need for the daemon.
+			pullAlways := successfully(rootCmd.Flags().GetBool(pullAlwaysFlag))
+			var moby *client.Client
+			if !pullAlways && !noBundle {
+				var err error
+				moby, err = newDockerClient(
+					successfully(rootCmd.Flags().GetString(dockerHostFlag)))
+				if err != nil {
+					return withExitCode(exitUsage, err)
+				}
+				defer moby.Close()
+				if !successfully(rootCmd.Flags().GetBool(skipDaemonCheckFlag)) {
+					if err := pingDaemon(ctx, moby, pullRetries, pullRetryDelay); err != nil {
+						return withExitCode(exitRegistry, err)
+					}
+				}
+			}
+
+			// If the app template is to be taken from a git repository, then
+			// clone it first so we can later describe it.
+			templateDir := templateArg(args)
+			describeDir := ""
+			gitsrc, err := tiap.ParseGitSource(templateDir)
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
+			if gitsrc != nil {
+				// "git describe" and release notes from git need the history
+				// and tags, not just a shallow clone.
+				gitsrc.History = successfully(rootCmd.Flags().GetString(appVersionFlag)) == "" ||
+					rootCmd.Flags().Changed(notesFromGitFlag)
+				cloneDir, err := gitsrc.Clone(ctx)
+				if err != nil {
+					return withExitCode(exitRegistry, err)
+				}
+				defer func() {
+					os.RemoveAll(cloneDir)
+					log.Info(fmt.Sprintf("🧹  removed git clone folder %q", cloneDir))
+				}()
+				templateDir = filepath.Join(cloneDir, gitsrc.Subdir)
+				describeDir = cloneDir
+			}
+
 			appSemver := successfully(rootCmd.Flags().GetString(appVersionFlag))
 			if appSemver == "" {
-				out, err := exec.Command("git", "describe").CombinedOutput()
+				var err error
+				appSemver, err = gitDescribe(ctx, describeDir,
+					successfully(rootCmd.Flags().GetDuration(gitTimeoutFlag)))
 				if err != nil {
-					log.Errorf("git describe: %s", out)
-					return fmt.Errorf("git describe failed: %s", out)
+					log.Error(err.Error())
+					return err
 				}
-				appSemver = strings.Trim(string(out), "\r\n")
 			}
 			appSemver = strings.TrimPrefix(appSemver, "v")
 			if _, err := semver.StrictNewVersion(appSemver); err != nil {
-				return fmt.Errorf("invalid app semver %q, reason: %w",
-					appSemver, err)
+				return withExitCode(exitValidation, fmt.Errorf("invalid app semver %q, reason: %w",
+					appSemver, err))
 			}
 
-			rn := strings.Replace(
+			releaseNotes, err := parseReleaseNotes(
 				successfully(rootCmd.Flags().GetString(releaseNotesFlag)),
-				"\n", "\\n", -1)
-			releaseNotes, err := strconv.Unquote(`"` + rn + `"`)
+				successfully(rootCmd.Flags().GetBool(notesRawFlag)))
 			if err != nil {
-				log.Fatalf("release notes %q: %s", successfully(rootCmd.Flags().GetString(releaseNotesFlag)), err.Error())
+				return withExitCode(exitUsage, err)
+			}
+			if rootCmd.Flags().Changed(notesFromGitFlag) {
+				releaseNotes, err = gitReleaseNotes(ctx, describeDir,
+					successfully(rootCmd.Flags().GetString(notesFromGitFlag)),
+					successfully(rootCmd.Flags().GetDuration(gitTimeoutFlag)))
+				if err != nil {
+					log.Error(err.Error())
+					return err
+				}
 			}
 
-			app, err := tiap.NewApp(args[0])
+			var app *tiap.App
+			if stage := successfully(rootCmd.Flags().GetString(resumeFlag)); stage != "" {
+				app, err = tiap.ResumeApp(templateDir, stage)
+			} else {
+				app, err = tiap.NewApp(templateDir)
+			}
 			if err != nil {
 				return err
 			}
 			defer app.Done()
+			if successfully(rootCmd.Flags().GetBool(keepTempFlag)) {
+				app.KeepStage()
+			}
+			if successfully(rootCmd.Flags().GetBool(allowLatestFlag)) {
+				log.Warn("⚠  allowing latest images, app package won't be reproducible")
+				app.AllowLatest()
+			}
+
+			// Like "docker compose", drop all services guarded by profiles
+			// unless one of their profiles has been activated.
+			if err := app.SelectProfiles(
+				successfully(rootCmd.Flags().GetStringSlice(profileFlag))); err != nil {
+				return withExitCode(exitValidation, err)
+			}
+
+			// Report all problems with services and their images at once,
+			// instead of failing only later one by one while resolving.
+			if err := app.Validate(); err != nil {
+				return withExitCode(exitValidation, fmt.Errorf("invalid composer project: %w", err))
+			}
+
+			if successfully(rootCmd.Flags().GetBool(lintFlag)) {
+				log.Info("🔍  linting composer project...")
+				if err := app.Lint(); err != nil {
+					return withExitCode(exitValidation, err)
+				}
+			}
+
+			if successfully(rootCmd.Flags().GetBool(checkPortsFlag)) {
+				log.Info("🔍  checking for conflicting published ports...")
+				if err := app.CheckPorts(); err != nil {
+					return withExitCode(exitValidation, err)
+				}
+			}
+
+			if successfully(rootCmd.Flags().GetBool(placeholdersFlag)) {
+				log.Info("🔍  checking detail.json placeholders...")
+				if err := app.CheckPlaceholders(
+					successfully(rootCmd.Flags().GetStringSlice(placeholderFlag))); err != nil {
+					return withExitCode(exitValidation, err)
+				}
+			}
+
+			warnMoving := successfully(rootCmd.Flags().GetBool(warnMovingFlag))
+			rejectMoving := successfully(rootCmd.Flags().GetBool(rejectMovingFlag))
+			if warnMoving || rejectMoving {
+				log.Info("🔍  checking for moving image tags...")
+				moving, err := app.MovingTags(
+					successfully(rootCmd.Flags().GetStringSlice(movingTagsFlag)))
+				if err != nil {
+					return withExitCode(exitValidation, err)
+				}
+				for _, m := range moving {
+					log.Warn(fmt.Sprintf("⚠  %s, consider pinning by digest", m))
+				}
+				if rejectMoving && len(moving) > 0 {
+					return withExitCode(exitValidation,
+						fmt.Errorf("%d services use moving image tags", len(moving)))
+				}
+			}
 
-			platform := unerringly(
-				platforms.Parse(successfully(rootCmd.Flags().GetString(platformFlag))))
+			platform, err := parsePlatform(successfully(rootCmd.Flags().GetString(platformFlag)))
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
 			if platform.OS != "linux" && platform.OS != runtime.GOOS {
 				// warn when the platform OS was (explicitly) set to something
 				// different than linux; we try to not warn in case tiap is run
@@ -158,48 +646,246 @@ func newRootCmd() (rootCmd *cobra.Command) {
 
 			appArch := denormalize(platform).Architecture
 			log.Infof("🚊  denormalized IE App architecture: %q", appArch)
+			if arch := successfully(rootCmd.Flags().GetString(archFlag)); arch != "" && arch != appArch {
+				log.Info(fmt.Sprintf("🚊  overriding derived IE App architecture %q with %q", appArch, arch))
+				appArch = arch
+			}
+			if err := tiap.CheckIEAppArch(appArch); err != nil {
+				return withExitCode(exitValidation, err)
+			}
 
 			err = app.SetDetails(appSemver, releaseNotes, appArch)
 			if err != nil {
-				return err
+				return withExitCode(exitIO, err)
+			}
+			if successfully(rootCmd.Flags().GetBool(pruneEmptyFlag)) {
+				if err := app.PruneEmptyDetails(); err != nil {
+					return withExitCode(exitIO, err)
+				}
 			}
 
-			pullAlways := successfully(rootCmd.Flags().GetBool(pullAlwaysFlag))
-			var moby *client.Client
-			if !pullAlways {
-				log.Debugf("🐛 creating Docker/Moby client")
-				dockerHost := successfully(rootCmd.Flags().GetString(dockerHostFlag))
-				opts := []client.Opt{
-					client.WithAPIVersionNegotiation(),
-				}
-				if dockerHost != "" {
-					opts = append(opts, client.WithHost(dockerHost))
-				} else {
-					opts = append(opts, client.WithHostFromEnv())
-				}
-				moby, err = client.NewClientWithOpts(opts...)
+			pullOpts := []tiap.PullOption{
+				tiap.WithProgress(logProgress),
+				tiap.WithMirror(successfully(rootCmd.Flags().GetString(mirrorToFlag))),
+				tiap.WithRetries(pullRetries, pullRetryDelay),
+			}
+			if successfully(rootCmd.Flags().GetBool(pullByDepsFlag)) {
+				pullOpts = append(pullOpts, tiap.WithDependencyOrder())
+			}
+			if imageCacheDir != "" {
+				pullOpts = append(pullOpts, tiap.WithImageCache(imageCacheDir))
+			}
+			if rootCmd.Flags().Changed(parallelFlag) {
+				pullOpts = append(pullOpts, tiap.WithConcurrency(parallel))
+			}
+			if successfully(rootCmd.Flags().GetBool(compressImagesFlag)) {
+				pullOpts = append(pullOpts, tiap.WithCompression())
+			}
+			// Only ask the registries for the digests of resumed, cached, and
+			// daemon images when these digests end up somewhere.
+			if successfully(rootCmd.Flags().GetBool(imageDigestsFlag)) ||
+				successfully(rootCmd.Flags().GetBool(inputsDigestFlag)) ||
+				sbomFormat != "" {
+				pullOpts = append(pullOpts, tiap.WithRegistryDigests())
+			}
+
+			if registry := successfully(rootCmd.Flags().GetString(registryFlag)); registry != "" {
+				if _, err := name.NewRegistry(registry); err != nil {
+					return withExitCode(exitUsage, fmt.Errorf("invalid --%s %q, reason: %w",
+						registryFlag, registry, err))
+				}
+				pullOpts = append(pullOpts, tiap.WithBasicAuth(registry,
+					successfully(rootCmd.Flags().GetString(registryUserFlag)),
+					successfully(rootCmd.Flags().GetString(registryPassFlag))))
+				log.Info(fmt.Sprintf("🔑  using explicit credentials for registry %q", registry))
+			}
+
+			tiap.RegistryLimiter, err = parseRegistryRate(
+				successfully(rootCmd.Flags().GetString(registryRateFlag)))
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
+
+			if successfully(rootCmd.Flags().GetBool(qualifyImagesFlag)) {
+				if err := app.QualifyImages(); err != nil {
+					return err
+				}
+			}
+
+			// Check the images against the lockfile before pulling them, so we
+			// don't pull and mirror images nobody has reviewed.
+			if lockname := successfully(rootCmd.Flags().GetString(imageLockFlag)); lockname != "" {
+				lock, err := tiap.LoadImageLock(lockname)
 				if err != nil {
-					return fmt.Errorf("cannot contact Docker daemon, reason: %w", err)
+					return withClassifiedExitCode(exitUsage, err)
 				}
-				defer moby.Close()
-				log.Debugf("🐛 Docker/Moby client created")
+				if err := app.CheckImageLock(ctx, lock, pullOpts...); err != nil {
+					return withClassifiedExitCode(exitValidation, fmt.Errorf("image lock violated: %w", err))
+				}
+				log.Info("🔒  all image digests match the lockfile")
+			}
+
+			// Optionally digest the files already staged while pulling the
+			// images, instead of digesting everything only when packaging.
+			var precompute sync.WaitGroup
+			if successfully(rootCmd.Flags().GetBool(pipelineFlag)) {
+				precompute.Add(1)
+				go func() {
+					defer precompute.Done()
+					if err := app.PrecomputeDigests(); err != nil {
+						log.Warn(fmt.Sprintf("⚠  %s", err))
+					}
+				}()
+				defer precompute.Wait() // ...before the stage gets removed.
 			}
 
-			err = app.PullAndWriteCompose(
-				context.Background(),
-				platforms.Format(platform),
-				moby)
+			if noBundle {
+				err = app.WriteComposeWithoutImages(
+					ctx,
+					successfully(rootCmd.Flags().GetBool(pinDigestsFlag)),
+					pullOpts...)
+			} else {
+				err = app.PullAndWriteCompose(
+					ctx,
+					platforms.Format(platform),
+					moby,
+					pullOpts...)
+			}
 			if err != nil {
-				return err
+				return withClassifiedExitCode(exitValidation, err)
+			}
+
+			if successfully(rootCmd.Flags().GetBool(verifyArchFlag)) {
+				if err := app.VerifySavedImages(platforms.Format(platform)); err != nil {
+					return withExitCode(exitValidation, fmt.Errorf("saved images don't match platform: %w", err))
+				}
+				log.Info("🖥  all saved images match the platform")
+			}
+
+			if successfully(rootCmd.Flags().GetBool(notesTemplateFlag)) {
+				if err := app.ExpandReleaseNotes(); err != nil {
+					return err
+				}
 			}
 
-			outname := successfully(rootCmd.Flags().GetString(outnameFlag))
-			if filepath.Ext(outname) == "" {
-				outname = outname + ".app"
+			if successfully(rootCmd.Flags().GetBool(imageDigestsFlag)) {
+				if err := app.WriteImageDigests(); err != nil {
+					return err
+				}
+			}
+
+			if successfully(rootCmd.Flags().GetBool(composeJSONFlag)) {
+				if err := app.WriteComposeJSON(); err != nil {
+					return err
+				}
+			}
+
+			force := successfully(rootCmd.Flags().GetBool(forceFlag))
+			for _, addFile := range successfully(rootCmd.Flags().GetStringArray(addFileFlag)) {
+				src, dest, err := parseAddFile(addFile)
+				if err != nil {
+					return withExitCode(exitUsage, err)
+				}
+				if err := app.AddFile(src, dest, force); err != nil {
+					return withExitCode(exitIO, err)
+				}
+			}
+
+			if successfully(rootCmd.Flags().GetBool(inputsDigestFlag)) {
+				params := inputsDigestFlags(rootCmd.Flags())
+				params["tiap"] = rootCmd.Version
+				params["version"] = appSemver
+				params["releaseNotes"] = releaseNotes
+				params["platform"] = platforms.Format(platform)
+				params["arch"] = appArch
+				if err := app.WriteInputsDigest(params); err != nil {
+					return err
+				}
+			}
+
+			if validator := successfully(rootCmd.Flags().GetString(validatorFlag)); validator != "" {
+				if err := app.RunValidator(ctx, validator); err != nil {
+					return withExitCode(exitValidation, err)
+				}
+			}
+
+			if err := app.CheckPermissions(); err != nil {
+				if successfully(rootCmd.Flags().GetBool(strictPermsFlag)) {
+					return withExitCode(exitValidation, err)
+				}
+				log.Warn(fmt.Sprintf("⚠  %s", err))
+			}
+
+			outname := packageName(successfully(rootCmd.Flags().GetString(outnameFlag)), gzipped)
+			precompute.Wait()
+			if err := app.Package(outname, packageOpts...); err != nil {
+				return withExitCode(exitIO, err)
+			}
+			if profileName != "" {
+				log.Info(fmt.Sprintf("📏  checking app package against %q device profile", profileName))
+				if err := profile.Check(outname); err != nil {
+					os.Remove(outname)
+					return withExitCode(exitValidation, err)
+				}
+			}
+			if sbomFormat != "" {
+				if err := writeSBOM(app, sbomFormat, platforms.Format(platform), outname); err != nil {
+					return withExitCode(exitIO, err)
+				}
 			}
-			return app.Package(outname)
+			if !summaryOnly {
+				return nil
+			}
+			s, err := newSummary(appSemver, appArch, outname,
+				len(app.SavedImages()), time.Since(start))
+			if err != nil {
+				return err
+			}
+			return s.write(cmd.OutOrStdout())
 		},
 	}
+
+	// In watch mode, rebuild the app package whenever the app template
+	// changes, taking the images pulled before from an image cache.
+	build := rootCmd.RunE
+	rootCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if !successfully(rootCmd.Flags().GetBool(watchFlag)) {
+			return build(cmd, args)
+		}
+		templateDir := templateArg(args)
+		if gitsrc, err := tiap.ParseGitSource(templateDir); err != nil || gitsrc != nil {
+			return withExitCode(exitUsage, fmt.Errorf("--%s requires a local app template directory", watchFlag))
+		}
+		templateDir, err := filepath.Abs(templateDir)
+		if err != nil {
+			return withExitCode(exitIO, err)
+		}
+		outname, err := filepath.Abs(packageName(
+			successfully(rootCmd.Flags().GetString(outnameFlag)),
+			successfully(rootCmd.Flags().GetBool(gzipFlag))))
+		if err != nil {
+			return withExitCode(exitIO, err)
+		}
+		cacheDir, err := os.MkdirTemp("", "tiap-image-cache-*")
+		if err != nil {
+			return withExitCode(exitIO, fmt.Errorf("cannot create image cache directory, reason: %w", err))
+		}
+		defer os.RemoveAll(cacheDir)
+		imageCacheDir = cacheDir
+		defer func() { imageCacheDir = "" }()
+		// Pass the watch context on to the builds, so that interrupting
+		// watching also cancels any build in progress, such as pulling.
+		return withExitCode(exitIO, watchBuilds(cmd.Context(), templateDir, outputFiles(outname),
+			func(ctx context.Context) error {
+				cmd.SetContext(ctx)
+				return build(cmd, args)
+			}))
+	}
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(newRulesCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newResealCmd())
+
 	rootCmd.Flags().StringP(outnameFlag, "o", "",
 		"mandatory: name of app package file to write")
 	if err := rootCmd.MarkFlagRequired(outnameFlag); err != nil {
@@ -209,12 +895,48 @@ func newRootCmd() (rootCmd *cobra.Command) {
 	rootCmd.Flags().String(appVersionFlag, "",
 		"app semantic version, defaults to git describe")
 
+	rootCmd.Flags().Duration(gitTimeoutFlag, 10*time.Second,
+		"give up on \"git describe\" for the app version after this duration")
+
 	rootCmd.Flags().String(releaseNotesFlag, "",
 		"release notes (interpreted as double-quoted Go string literal; use \\n, \\\", …)")
 
+	rootCmd.Flags().Bool(notesRawFlag, false,
+		"take release notes verbatim, without interpreting them as a Go string literal")
+
+	rootCmd.Flags().String(notesFromGitFlag, "",
+		"release notes from the commit subjects in git `RANGE`, defaulting to the previous tag..HEAD")
+	rootCmd.Flags().Lookup(notesFromGitFlag).NoOptDefVal = defaultNotesRange
+	rootCmd.MarkFlagsMutuallyExclusive(releaseNotesFlag, notesFromGitFlag)
+	rootCmd.MarkFlagsMutuallyExclusive(notesRawFlag, notesFromGitFlag)
+
+	rootCmd.Flags().Bool(notesTemplateFlag, false,
+		"expand release notes as a Go template, such as {{.Images}} for the list of shipped images")
+
 	p := thisPlatform()
 	rootCmd.Flags().StringP(platformFlag, "p", "linux/"+p.Architecture,
-		"platform to build app for")
+		"platform to build app for, or \"host\" for the build host's platform")
+
+	rootCmd.Flags().String(archFlag, "",
+		"override the IE App `ARCH` \"x86-64\" or \"arm64\" derived from the platform for detail.json")
+
+	rootCmd.Flags().Bool(compressImagesFlag, false,
+		"save gzip-compressed image tar-balls, if your Industrial Edge accepts them")
+
+	rootCmd.Flags().Bool(verifyArchFlag, false,
+		"read back saved images and check that they match the platform")
+
+	rootCmd.Flags().Bool(pipelineFlag, false,
+		"digest template files while pulling images, instead of only when packaging")
+
+	rootCmd.Flags().Bool(skipDaemonCheckFlag, false,
+		"don't check that the Docker daemon is reachable before starting work")
+
+	rootCmd.Flags().Bool(noBundleFlag, false,
+		"don't bundle images, for deployments pulling them from their registries")
+
+	rootCmd.Flags().Bool(pinDigestsFlag, false,
+		"pin image references to their current digests (requires --no-bundle-images)")
 
 	rootCmd.Flags().Bool(pullAlwaysFlag, false,
 		"always pull image from remote registry, never use local images")
@@ -222,9 +944,155 @@ func newRootCmd() (rootCmd *cobra.Command) {
 	rootCmd.Flags().StringP(dockerHostFlag, "H", "",
 		"Docker daemon socket to connect to (only if non-default and using local images)")
 
+	rootCmd.Flags().StringSlice(profileFlag, nil,
+		"package only services without profiles or in any of these active profiles")
+
+	rootCmd.Flags().Int(parallelFlag, 0,
+		"pull and save up to `N` images in parallel (default number of CPUs, but at most 4)")
+
+	rootCmd.Flags().Bool(pullByDepsFlag, false,
+		"pull images in depends_on order of their services instead of alphabetically")
+
+	rootCmd.Flags().Int(pullRetriesFlag, tiap.DefaultPullRetries,
+		"retry transient image pull and Docker daemon failures up to `N` times")
+
+	rootCmd.Flags().Duration(pullRetryDelayFlag, tiap.DefaultPullRetryDelay,
+		"initial delay before retrying, doubling with each further retry")
+
+	rootCmd.Flags().Bool(qualifyImagesFlag, false,
+		"write fully-qualified image references, including registry")
+
+	rootCmd.Flags().Bool(keepTempFlag, false,
+		"keep temporary staging directory, such as for resuming later")
+
+	rootCmd.Flags().String(resumeFlag, "",
+		"resume an interrupted run using the kept staging directory `DIR`")
+
+	rootCmd.Flags().StringArray(addFileFlag, nil,
+		"add external file SRC to the package at DESTPATH (repeatable), as \"SRC:DESTPATH\"")
+
+	rootCmd.Flags().Bool(forceFlag, false,
+		"let additional files overwrite existing package files")
+
+	rootCmd.Flags().String(symlinksFlag, tiap.SymlinksPreserve,
+		"stage symbolic links in the app template as \"preserve\", \"follow\", or \"skip\"")
+
+	rootCmd.Flags().Bool(strictPermsFlag, false,
+		"fail instead of warning about setuid, setgid, sticky, or world-writable files")
+
+	rootCmd.Flags().Bool(normalizePermsFlag, false,
+		"stage template files with normalized 0644/0755 permissions instead of preserving them")
+
+	rootCmd.Flags().StringArray(stagePathFlag, nil,
+		"stage only template `PATH`, relative to the template root, plus the app details (repeatable)")
+
+	rootCmd.Flags().StringArray(digestAlgoFlag, nil,
+		"digest package file `PATH=ALGORITHM` using sha256, sha384, or sha512 (repeatable)")
+
+	rootCmd.Flags().Int(maxFilesFlag, tiap.MaxFiles,
+		"maximum number of template and package files, 0 for no limit")
+
+	rootCmd.Flags().Int(packageUIDFlag, tiap.DefaultPackageOwnerID,
+		"owner `ID` of all packaged files")
+
+	rootCmd.Flags().Int(packageGIDFlag, tiap.DefaultPackageOwnerID,
+		"group `ID` of all packaged files")
+
+	rootCmd.Flags().Bool(gzipFlag, false,
+		"gzip the whole app package, adding \".gz\" to the \".app\" extension")
+
+	rootCmd.Flags().String(registryRateFlag, "",
+		"limit registry requests to N per PERIOD, such as \"10/1m\"")
+
+	rootCmd.Flags().String(mirrorToFlag, "",
+		"additionally push all images to mirror `REGISTRY`, keeping their repositories and tags")
+
+	rootCmd.Flags().String(registryFlag, "",
+		"use explicit credentials for `REGISTRY`, falling back to the Docker configuration otherwise")
+
+	rootCmd.Flags().String(registryUserFlag, "",
+		"`USERNAME` for the --registry")
+
+	rootCmd.Flags().String(registryPassFlag, "",
+		"`PASSWORD` or token for the --registry")
+
+	rootCmd.Flags().Bool(allowLatestFlag, false,
+		"allow latest images with a warning, for local experimentation only")
+
+	rootCmd.Flags().Bool(strictYAMLFlag, false,
+		"reject multi-document composer projects and duplicate keys in detail.json")
+
+	rootCmd.Flags().Bool(lintFlag, false,
+		"check composer project for common structural mistakes")
+
+	rootCmd.Flags().String(validatorFlag, "",
+		"run external validator `CMD` on the staging directory before packaging")
+
+	rootCmd.Flags().String(imageLockFlag, "",
+		"check registry digests of images against lockfile `FILE`")
+
+	rootCmd.Flags().Bool(checkPortsFlag, false,
+		"check that services don't publish conflicting host ports")
+
+	rootCmd.Flags().Bool(placeholdersFlag, false,
+		"check that the template's detail.json leaves placeholder fields empty")
+
+	rootCmd.Flags().StringSlice(placeholderFlag, tiap.DefaultPlaceholderFields,
+		"detail.json fields that templates must leave empty")
+
+	rootCmd.Flags().Bool(warnMovingFlag, false,
+		"warn about images using moving tags, such as \"stable\"")
+
+	rootCmd.Flags().Bool(rejectMovingFlag, false,
+		"reject images using moving tags, such as \"stable\"")
+
+	rootCmd.Flags().StringSlice(movingTagsFlag, tiap.DefaultMovingTags,
+		"patterns of moving image tags")
+
+	rootCmd.Flags().Bool(pruneEmptyFlag, false,
+		"remove empty string and null fields from detail.json, except those set by tiap")
+
+	rootCmd.Flags().Bool(inputsDigestFlag, false,
+		"add a digest of all build inputs to detail.json, for detecting unchanged inputs")
+
+	rootCmd.Flags().Bool(imageDigestsFlag, false,
+		"add pulled image references and digests to detail.json")
+
+	rootCmd.Flags().Bool(composeJSONFlag, false,
+		"additionally package the composer project as docker-compose.json")
+
+	rootCmd.Flags().Bool(summaryOnlyFlag, false,
+		"log only warnings and errors, and print a JSON summary line on success")
+
+	rootCmd.Flags().String(deviceProfileFlag, "",
+		"fail if the app package exceeds the limits of the device `PROFILE` \"small\" or \"large\"")
+
+	rootCmd.Flags().String(sbomFlag, "",
+		"write an image-level SBOM sidecar file in `FORMAT` \"cyclonedx\" or \"spdx\"")
+
 	rootCmd.Flags().Bool(debugFlag, false,
 		"enable debug logging")
 
+	rootCmd.Flags().String(logTimeFormatFlag, time.RFC3339,
+		"Go time layout for log time stamps")
+
+	rootCmd.Flags().Bool(watchFlag, false,
+		"rebuild the app package whenever the app template changes, until interrupted")
+
+	rootCmd.Flags().Bool(noLogTimeFlag, false,
+		"omit time stamps from log output")
+
+	rootCmd.Flags().String(logFormatFlag, autoLogFormat,
+		"log `FORMAT` \"text\", or \"github\" for GitHub Actions workflow commands; \"auto\" detects GitHub Actions")
+
+	rootCmd.MarkFlagsRequiredTogether(registryFlag, registryUserFlag, registryPassFlag)
+	rootCmd.MarkFlagsMutuallyExclusive(watchFlag, resumeFlag)
+
+	// Without bundled images, there is nothing to check or mirror.
+	for _, bundling := range []string{verifyArchFlag, mirrorToFlag, compressImagesFlag} {
+		rootCmd.MarkFlagsMutuallyExclusive(noBundleFlag, bundling)
+	}
+
 	if info, biok := debug.ReadBuildInfo(); biok {
 		commit := buildInfo(info, "vcs.revision")
 		if commit != "" {
@@ -238,5 +1106,6 @@ func newRootCmd() (rootCmd *cobra.Command) {
 		}
 	}
 
+	withExitCodes(rootCmd)
 	return rootCmd
 }
@@ -0,0 +1,369 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	stdlog "log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/tiap"
+	"golang.org/x/time/rate"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("platforms", func() {
+
+	It("parses a single platform", func() {
+		p := Successful(parsePlatform("linux/arm64"))
+		Expect(p.OS).To(Equal("linux"))
+		Expect(p.Architecture).To(Equal("arm64"))
+	})
+
+	It("resolves the host platform", func() {
+		for _, spec := range []string{"host", "native"} {
+			p := Successful(parsePlatform(spec))
+			Expect(p.OS).To(Equal("linux"))
+			Expect(p.Architecture).To(Equal(thisPlatform().Architecture))
+		}
+	})
+
+	It("rejects multiple platforms", func() {
+		Expect(parsePlatform("linux/arm64,linux/amd64")).Error().To(
+			MatchError(ContainSubstring("multiple platforms")))
+	})
+
+	DescribeTable("tolerating redundant platforms",
+		func(spec string, arch string) {
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			DeferCleanup(func() { log.SetOutput(os.Stderr) })
+			p := Successful(parsePlatform(spec))
+			Expect(p.Architecture).To(Equal(arch))
+			Expect(logged.String()).To(ContainSubstring("ignoring redundant platform"))
+		},
+		Entry(nil, "linux/amd64,linux/amd64", "amd64"),
+		Entry(nil, "linux/amd64,amd64", "amd64"),
+		Entry(nil, "linux/amd64, x86_64", "amd64"),
+		Entry(nil, "arm64,linux/arm64/v8,aarch64", "arm64"),
+	)
+
+	It("rejects multiple equivalent and different platforms", func() {
+		Expect(parsePlatform("amd64,linux/amd64,arm64")).Error().To(
+			MatchError(ContainSubstring("multiple platforms")))
+	})
+
+	It("rejects invalid platforms", func() {
+		Expect(parsePlatform("linux/arm64/v8/foo/bar")).Error().To(
+			MatchError(ContainSubstring("invalid platform")))
+	})
+
+})
+
+var _ = Describe("template argument", func() {
+
+	It("defaults to the current directory", func() {
+		cmd := newRootCmd()
+		Expect(cmd.Args(cmd, nil)).To(Succeed())
+		Expect(templateArg(nil)).To(Equal("."))
+		Expect(templateArg([]string{"foo"})).To(Equal("foo"))
+	})
+
+	It("rejects more than one template", func() {
+		cmd := newRootCmd()
+		Expect(cmd.Args(cmd, []string{"foo", "bar"})).NotTo(Succeed())
+	})
+
+})
+
+var _ = Describe("release notes", func() {
+
+	DescribeTable("interpreting release notes",
+		func(notes string, raw bool, expected string) {
+			Expect(parseReleaseNotes(notes, raw)).To(Equal(expected))
+		},
+		Entry(nil, `foo\nbar`, false, "foo\nbar"),
+		Entry(nil, "foo\nbar", false, "foo\nbar"),
+		Entry(nil, `say \"hellorld\"`, false, `say "hellorld"`),
+		Entry(nil, `foo\nbar`, true, `foo\nbar`),
+		Entry(nil, `C:\Users\hellorld`, true, `C:\Users\hellorld`),
+		Entry(nil, `^\d+"$`, true, `^\d+"$`),
+	)
+
+	It("rejects invalid escapes unless raw", func() {
+		Expect(parseReleaseNotes(`C:\Users\hellorld`, false)).Error().To(
+			MatchError(ContainSubstring(`release notes "C:\\Users\\hellorld"`)))
+	})
+
+})
+
+var _ = Describe("additional files", func() {
+
+	It("parses SRC:DESTPATH", func() {
+		src, dest, err := parseAddFile("C:/foo:bar/baz.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src).To(Equal("C:/foo"))
+		Expect(dest).To(Equal("bar/baz.txt"))
+	})
+
+	DescribeTable("rejecting invalid specifications",
+		func(spec string) {
+			_, _, err := parseAddFile(spec)
+			Expect(err).To(MatchError(ContainSubstring("must be SRC:DESTPATH")))
+		},
+		Entry(nil, "foo"),
+		Entry(nil, ":foo"),
+		Entry(nil, "foo:"),
+	)
+
+})
+
+var _ = Describe("inputs digest flags", func() {
+
+	It("picks only explicitly set flags affecting the output", func() {
+		cmd := newRootCmd()
+		Expect(cmd.ParseFlags([]string{
+			"--" + qualifyImagesFlag, "--" + archFlag, "arm64",
+			"--" + debugFlag, "--" + registryPassFlag, "s3cr3t",
+			"--" + addFileFlag, "foo:bar",
+		})).To(Succeed())
+		Expect(inputsDigestFlags(cmd.Flags())).To(Equal(map[string]string{
+			"flag:" + qualifyImagesFlag: "true",
+			"flag:" + archFlag:          "arm64",
+		}))
+	})
+
+})
+
+var _ = Describe("log formatters", func() {
+
+	DescribeTable("formatting log entries",
+		func(timeFormat string, explicitFormat bool, noTime bool, expected string) {
+			formatter := newLogFormatter(timeFormat, explicitFormat, noTime)
+			Expect(formatter).To(HaveField("FullTimestamp", explicitFormat))
+			Expect(formatter).To(HaveField("DisableTimestamp", noTime))
+			entry := log.NewEntry(log.StandardLogger())
+			entry.Time = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+			entry.Level = log.InfoLevel
+			entry.Message = "hellorld"
+			Expect(string(Successful(formatter.Format(entry)))).To(Equal(expected))
+		},
+		Entry("default timestamps", time.RFC3339, false, false,
+			"time=\"2023-01-02T03:04:05Z\" level=info msg=hellorld\n"),
+		Entry("explicit time format", time.Kitchen, true, false,
+			"time=\"3:04AM\" level=info msg=hellorld\n"),
+		Entry("no timestamps", time.RFC3339, false, true,
+			"level=info msg=hellorld\n"),
+		Entry("no timestamps despite explicit time format", time.Kitchen, true, true,
+			"level=info msg=hellorld\n"),
+	)
+
+})
+
+var _ = Describe("registry rates", func() {
+
+	It("doesn't limit by default", func() {
+		Expect(parseRegistryRate("")).To(BeNil())
+	})
+
+	DescribeTable("parsing rates",
+		func(spec string, limit rate.Limit, burst int) {
+			limiter := Successful(parseRegistryRate(spec))
+			Expect(limiter.Limit()).To(BeNumerically("~", limit, 1e-9))
+			Expect(limiter.Burst()).To(Equal(burst))
+		},
+		Entry(nil, "100/6h", rate.Every(6*time.Hour/100), 100),
+		Entry(nil, "10/m", rate.Every(6*time.Second), 10),
+		Entry(nil, "1/s", rate.Limit(1), 1),
+		Entry(nil, "4/2s", rate.Limit(2), 4),
+	)
+
+	DescribeTable("rejecting invalid rates",
+		func(spec string, errmsg string) {
+			Expect(parseRegistryRate(spec)).Error().To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "100", "expected N/PERIOD"),
+		Entry(nil, "0/s", "invalid registry rate count"),
+		Entry(nil, "-1/s", "invalid registry rate count"),
+		Entry(nil, "foo/s", "invalid registry rate count"),
+		Entry(nil, "10/", "invalid registry rate period"),
+		Entry(nil, "10/fortnight", "invalid registry rate period"),
+		Entry(nil, "10/-1s", "invalid registry rate period"),
+	)
+
+})
+
+var _ = Describe("digest algorithm overrides", func() {
+
+	It("parses overrides", func() {
+		Expect(parseDigestAlgorithms(nil)).To(BeEmpty())
+		Expect(parseDigestAlgorithms([]string{
+			"hellorld/docker-compose.yml=SHA512", "detail.json=sha384",
+		})).To(Equal(map[string]string{
+			"hellorld/docker-compose.yml": "sha512",
+			"detail.json":                 "sha384",
+		}))
+	})
+
+	DescribeTable("rejecting invalid overrides",
+		func(spec string) {
+			Expect(parseDigestAlgorithms([]string{spec})).Error().To(
+				MatchError(ContainSubstring("must be PATH=ALGORITHM")))
+		},
+		Entry(nil, "foo"),
+		Entry(nil, "=sha512"),
+		Entry(nil, "foo="),
+	)
+
+})
+
+var _ = Describe("slim packages", func() {
+
+	DescribeTable("rejecting flags requiring bundled images",
+		func(errmsg string, args ...string) {
+			cmd := newRootCmd()
+			cmd.SetArgs(append([]string{"-o", "/tmp/nada.app"}, args...))
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			Expect(cmd.Execute()).To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "requires --"+noBundleFlag, "--"+pinDigestsFlag, "testdata/nada-nothing-nil"),
+		Entry(nil, "were all set", "--"+noBundleFlag, "--"+verifyArchFlag, "testdata/nada-nothing-nil"),
+	)
+
+})
+
+var _ = Describe("registry credentials", func() {
+
+	It("requires registry, user, and password together", func() {
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{"-o", "/tmp/nada.app",
+			"--" + registryFlag, "ghcr.io", "--" + registryUserFlag, "foo",
+			"testdata/nada-nothing-nil"})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring(
+			"missing [" + registryPassFlag + "]")))
+	})
+
+})
+
+var _ = Describe("gzip'ed packages", func() {
+
+	DescribeTable("naming app packages",
+		func(outname string, gzipped bool, expected string) {
+			Expect(packageName(outname, gzipped)).To(Equal(expected))
+		},
+		Entry(nil, "hellorld", false, "hellorld.app"),
+		Entry(nil, "hellorld", true, "hellorld.app.gz"),
+		Entry(nil, "hellorld.app", true, "hellorld.app.gz"),
+		Entry(nil, "hellorld.tgz", true, "hellorld.tgz"),
+	)
+
+	It("writes a gzip'ed app package", func() {
+		out := log.StandardLogger().Out
+		DeferCleanup(func() { log.SetOutput(out) })
+		log.SetOutput(GinkgoWriter)
+
+		outname := filepath.Join(GinkgoT().TempDir(), "hellorld")
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{"-o", outname, "--" + gzipFlag,
+			"--" + noBundleFlag, "--" + appVersionFlag, "1.2.3", "../../testdata/app"})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		Expect(cmd.Execute()).To(Succeed())
+
+		f := Successful(os.Open(outname + ".app.gz"))
+		defer f.Close()
+		zipper := Successful(gzip.NewReader(f))
+		header := Successful(tar.NewReader(zipper).Next())
+		Expect(header.Name).NotTo(BeEmpty())
+	})
+
+	It("checks gzip'ed app packages against device profiles", func() {
+		out := log.StandardLogger().Out
+		DeferCleanup(func() { log.SetOutput(out) })
+		log.SetOutput(GinkgoWriter)
+		oldProfiles := tiap.DeviceProfiles
+		DeferCleanup(func() { tiap.DeviceProfiles = oldProfiles })
+
+		outname := filepath.Join(GinkgoT().TempDir(), "hellorld")
+		run := func(profile string) error {
+			cmd := newRootCmd()
+			cmd.SetArgs([]string{"-o", outname, "--" + gzipFlag, "--" + deviceProfileFlag, profile,
+				"--" + noBundleFlag, "--" + appVersionFlag, "1.2.3", "../../testdata/app"})
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return cmd.Execute()
+		}
+		Expect(run("small")).To(Succeed())
+		Expect(outname + ".app.gz").To(BeARegularFile())
+
+		tiap.DeviceProfiles = map[string]tiap.DeviceProfile{
+			"tiny": {MaxSize: 1 << 20, MaxFiles: 1},
+		}
+		Expect(run("tiny")).To(MatchError(ContainSubstring("exceeds device profile")))
+		Expect(outname + ".app.gz").NotTo(BeAnExistingFile())
+	})
+
+})
+
+var _ = Describe("image lockfiles", func() {
+
+	It("checks lockfiles when qualifying images", Serial, func(ctx context.Context) {
+		out := log.StandardLogger().Out
+		DeferCleanup(func() { log.SetOutput(out) })
+		log.SetOutput(GinkgoWriter)
+
+		srv := httptest.NewServer(registry.New(registry.Logger(stdlog.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		host := strings.TrimPrefix(srv.URL, "http://")
+		oldDefaultRegistry := tiap.DefaultRegistry
+		DeferCleanup(func() { tiap.DefaultRegistry = oldDefaultRegistry })
+		tiap.DefaultRegistry = host
+
+		image := Successful(random.Image(1024, 1))
+		Expect(remote.Write(Successful(name.ParseReference(host+"/busybox:stable")), image)).To(Succeed())
+		lockname := filepath.Join(GinkgoT().TempDir(), "images.lock")
+		Expect(os.WriteFile(lockname,
+			[]byte("busybox:stable: "+Successful(image.Digest()).String()+"\n"), 0644)).To(Succeed())
+
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{"-o", filepath.Join(GinkgoT().TempDir(), "hellorld.app"),
+			"--" + noBundleFlag, "--" + appVersionFlag, "1.2.3",
+			"--" + qualifyImagesFlag, "--" + imageLockFlag, lockname,
+			"../../testdata/app"})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		Expect(cmd.ExecuteContext(ctx)).To(Succeed())
+	})
+
+})
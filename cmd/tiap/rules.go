@@ -0,0 +1,164 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/tiap"
+)
+
+const jsonFlag = "json"
+
+// newRulesCmd returns a new “rules” command that explains the validation
+// rules tiap enforces.
+func newRulesCmd() *cobra.Command {
+	rulesCmd := &cobra.Command{
+		Use:   "rules [--json]",
+		Short: "explain the validation rules tiap enforces and how to opt in or out",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if successfully(cmd.Flags().GetBool(jsonFlag)) {
+				return writeRulesJSON(cmd.OutOrStdout(), tiap.Rules)
+			}
+			return writeRules(cmd.OutOrStdout(), tiap.Rules)
+		},
+	}
+	rulesCmd.Flags().Bool(jsonFlag, false, "output rules in JSON format")
+	return rulesCmd
+}
+
+// writeRules writes the specified rules in plain text format.
+func writeRules(w io.Writer, rules []tiap.Rule) error {
+	for idx, rule := range rules {
+		if idx > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		enforced := "opt-in"
+		if rule.Default {
+			enforced = "always"
+		}
+		_, err := fmt.Fprintf(w, "%s (%s)\n   checks:    %s\n   rationale: %s\n",
+			rule.Name, enforced, rule.Check, rule.Rationale)
+		if err != nil {
+			return err
+		}
+		if rule.Control != "" {
+			if _, err := fmt.Fprintf(w, "   control:   %s\n", rule.Control); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeRulesJSON writes the specified rules in JSON format.
+func writeRulesJSON(w io.Writer, rules []tiap.Rule) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rules)
+}
+
+// ruleState describes whether a particular rule is enabled for the current
+// invocation, together with any rule parameters.
+type ruleState struct {
+	Name    string
+	Enabled bool
+	Params  string
+}
+
+// String returns a textual report of the rule state.
+func (r ruleState) String() string {
+	state := "disabled"
+	if r.Enabled {
+		state = "enabled"
+	}
+	if r.Params == "" {
+		return r.Name + ": " + state
+	}
+	return r.Name + ": " + state + " (" + r.Params + ")"
+}
+
+// effectiveRules returns the states of the validation rules as resolved from
+// the flags of the specified (root) command, in the order of tiap.Rules.
+func effectiveRules(cmd *cobra.Command) []ruleState {
+	flags := cmd.Flags()
+	states := make([]ruleState, 0, len(tiap.Rules))
+	for _, rule := range tiap.Rules {
+		state := ruleState{Name: rule.Name, Enabled: rule.Default}
+		switch rule.Name {
+		case "no-latest-tag", "explicit-tag":
+			state.Enabled = !successfully(flags.GetBool(allowLatestFlag))
+		case "mem-limit":
+			state.Params = "unless opted out by the composer project"
+		case "max-files":
+			maxFiles := successfully(flags.GetInt(maxFilesFlag))
+			state.Enabled = maxFiles > 0
+			if state.Enabled {
+				state.Params = fmt.Sprintf("max. %d files", maxFiles)
+			}
+		case "strict-parsing":
+			state.Enabled = successfully(flags.GetBool(strictYAMLFlag))
+		case "lint":
+			state.Enabled = successfully(flags.GetBool(lintFlag))
+		case "port-conflicts":
+			state.Enabled = successfully(flags.GetBool(checkPortsFlag))
+		case "moving-tags":
+			reject := successfully(flags.GetBool(rejectMovingFlag))
+			state.Enabled = reject || successfully(flags.GetBool(warnMovingFlag))
+			if state.Enabled {
+				action := "warn"
+				if reject {
+					action = "reject"
+				}
+				state.Params = action + ", patterns: " +
+					strings.Join(successfully(flags.GetStringSlice(movingTagsFlag)), ", ")
+			}
+		case "placeholders":
+			state.Enabled = successfully(flags.GetBool(placeholdersFlag))
+			if state.Enabled {
+				state.Params = "fields: " +
+					strings.Join(successfully(flags.GetStringSlice(placeholderFlag)), ", ")
+			}
+		case "device-profile":
+			profile := successfully(flags.GetString(deviceProfileFlag))
+			state.Enabled = profile != ""
+			if state.Enabled {
+				state.Params = "profile: " + profile
+			}
+		case "permissions":
+			state.Params = "warn"
+			if successfully(flags.GetBool(strictPermsFlag)) {
+				state.Params = "fail"
+			}
+		case "image-lock":
+			lockname := successfully(flags.GetString(imageLockFlag))
+			state.Enabled = lockname != ""
+			if state.Enabled {
+				state.Params = "lockfile: " + lockname
+			}
+		case "saved-platform":
+			state.Enabled = successfully(flags.GetBool(verifyArchFlag))
+		}
+		states = append(states, state)
+	}
+	return states
+}
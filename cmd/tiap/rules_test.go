@@ -0,0 +1,98 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/thediveo/tiap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rules", func() {
+
+	run := func(args ...string) string {
+		GinkgoHelper()
+		var out bytes.Buffer
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&out)
+		Expect(cmd.Execute()).To(Succeed())
+		return out.String()
+	}
+
+	It("explains the rules", func() {
+		out := run("rules")
+		for _, rule := range tiap.Rules {
+			Expect(out).To(ContainSubstring(rule.Name))
+			Expect(out).To(ContainSubstring(rule.Rationale))
+		}
+		Expect(out).To(ContainSubstring("no-latest-tag (always)\n   checks:    "))
+		Expect(out).To(ContainSubstring("lint (opt-in)\n"))
+		Expect(out).To(ContainSubstring("   control:   opt in using --lint\n"))
+	})
+
+	It("explains the rules in JSON", func() {
+		var rules []tiap.Rule
+		Expect(json.Unmarshal([]byte(run("rules", "--json")), &rules)).To(Succeed())
+		Expect(rules).To(Equal(tiap.Rules))
+	})
+
+	It("reports the effective rules", func() {
+		states := func(args ...string) map[string]string {
+			GinkgoHelper()
+			cmd := newRootCmd()
+			Expect(cmd.ParseFlags(args)).To(Succeed())
+			states := map[string]string{}
+			for _, rule := range effectiveRules(cmd) {
+				states[rule.Name] = rule.String()
+			}
+			Expect(states).To(HaveLen(len(tiap.Rules)))
+			return states
+		}
+
+		Expect(states()).To(SatisfyAll(
+			HaveKeyWithValue("no-latest-tag", "no-latest-tag: enabled"),
+			HaveKeyWithValue("max-files", "max-files: enabled (max. 10000 files)"),
+			HaveKeyWithValue("lint", "lint: disabled"),
+			HaveKeyWithValue("moving-tags", "moving-tags: disabled"),
+			HaveKeyWithValue("device-profile", "device-profile: disabled"),
+		))
+		Expect(states(
+			"--max-files=0", "--lint",
+			"--reject-moving-tags", "--moving-tags=edge,rc*",
+			"--device-profile=small",
+		)).To(SatisfyAll(
+			HaveKeyWithValue("max-files", "max-files: disabled"),
+			HaveKeyWithValue("lint", "lint: enabled"),
+			HaveKeyWithValue("moving-tags", "moving-tags: enabled (reject, patterns: edge, rc*)"),
+			HaveKeyWithValue("device-profile", "device-profile: enabled (profile: small)"),
+		))
+	})
+
+	It("ignores default flags", func() {
+		var out bytes.Buffer
+		cmd := newRootCmd()
+		Expect(applyDefaultFlags(cmd, "--platform arm64 --debug")).To(Succeed())
+		cmd.SetArgs([]string{"rules"})
+		cmd.SetOut(&out)
+		Expect(cmd.Execute()).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("no-latest-tag"))
+	})
+
+})
@@ -0,0 +1,59 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// summary describes a successfully packaged app in a single line of JSON, for
+// use in dashboards and scripts.
+type summary struct {
+	Version  string `json:"version"`
+	Arch     string `json:"arch"`
+	Output   string `json:"output"`
+	Size     int64  `json:"size"`
+	Images   int    `json:"images"`
+	Duration string `json:"duration"`
+}
+
+// newSummary returns the summary of a successfully packaged app, determining
+// the size of the app package file at the specified output path.
+func newSummary(version, arch, output string, images int, duration time.Duration) (summary, error) {
+	info, err := os.Stat(output)
+	if err != nil {
+		return summary{}, fmt.Errorf("cannot determine app package size, reason: %w", err)
+	}
+	return summary{
+		Version:  version,
+		Arch:     arch,
+		Output:   output,
+		Size:     info.Size(),
+		Images:   images,
+		Duration: duration.Round(time.Millisecond).String(),
+	}, nil
+}
+
+// write writes the summary as a single line of JSON to the specified writer.
+func (s summary) write(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		return fmt.Errorf("cannot write summary, reason: %w", err)
+	}
+	return nil
+}
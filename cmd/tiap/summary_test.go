@@ -0,0 +1,57 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("summary", func() {
+
+	It("summarizes a packaged app as a single JSON line", func() {
+		out := filepath.Join(GinkgoT().TempDir(), "foo.app")
+		Expect(os.WriteFile(out, []byte("hellorld"), 0666)).To(Succeed())
+
+		s := Successful(newSummary("1.2.3", "arm64", out, 2, 1234567*time.Microsecond))
+		var buff bytes.Buffer
+		Expect(s.write(&buff)).To(Succeed())
+		Expect(bytes.Count(buff.Bytes(), []byte("\n"))).To(Equal(1))
+
+		var m map[string]any
+		Expect(json.Unmarshal(buff.Bytes(), &m)).To(Succeed())
+		Expect(m).To(Equal(map[string]any{
+			"version":  "1.2.3",
+			"arch":     "arm64",
+			"output":   out,
+			"size":     float64(8),
+			"images":   float64(2),
+			"duration": "1.235s",
+		}))
+	})
+
+	It("reports a missing app package", func() {
+		Expect(newSummary("1.2.3", "arm64", "/nada-nothing-nil.app", 0, 0)).Error().To(
+			MatchError(ContainSubstring("cannot determine app package size")))
+	})
+
+})
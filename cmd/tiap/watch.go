@@ -0,0 +1,154 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Polling interval and debounce period when watching app templates for
+// changes.
+const (
+	watchInterval = 500 * time.Millisecond
+	watchDebounce = time.Second
+)
+
+// fileState describes the state of a file in an app template that is relevant
+// for noticing changes.
+type fileState struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// templateSnapshot returns the states of all files and directories in the
+// specified template directory, except for paths starting with any of the
+// specified paths to ignore, as well as any “.git” directories.
+func templateSnapshot(dir string, ignore []string) (map[string]fileState, error) {
+	snapshot := map[string]fileState{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, ign := range ignore {
+			if strings.HasPrefix(path, ign) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		snapshot[path] = fileState{
+			size:    info.Size(),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch app template, reason: %w", err)
+	}
+	return snapshot, nil
+}
+
+// watchTemplate calls the build function once and then polls the specified
+// template directory in the specified interval, calling the build function
+// again after changes. watchTemplate debounces rapid successive changes by
+// waiting for the template to not change anymore for the specified debounce
+// period before rebuilding. It returns only after the context gets cancelled,
+// or when the template cannot be read.
+func watchTemplate(
+	ctx context.Context,
+	dir string,
+	ignore []string,
+	interval time.Duration,
+	debounce time.Duration,
+	build func(),
+) error {
+	last, err := templateSnapshot(dir, ignore)
+	if err != nil {
+		return err
+	}
+	build()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var changed time.Time // when the template last changed, if it changed.
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := templateSnapshot(dir, ignore)
+		if err != nil {
+			return err
+		}
+		if !maps.Equal(current, last) {
+			last = current
+			changed = time.Now()
+			continue
+		}
+		if changed.IsZero() || time.Since(changed) < debounce {
+			continue
+		}
+		changed = time.Time{}
+		log.Info(fmt.Sprintf("👀  app template %q changed, rebuilding...", dir))
+		build()
+	}
+}
+
+// watchBuilds builds the app package from the specified template directory
+// and then rebuilds it whenever the template changes, until interrupted. The
+// paths to ignore are typically the app package file itself and its sidecar
+// files, in case they get written into the template directory. Failing builds
+// are only logged, so that the template can be fixed while watching. The
+// build function gets passed a context that is cancelled when interrupted.
+func watchBuilds(ctx context.Context, dir string, ignore []string, build func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := watchTemplate(ctx, dir, ignore, watchInterval, watchDebounce, func() {
+		start := time.Now()
+		if err := build(ctx); err != nil {
+			log.Error(fmt.Sprintf("❌  build failed after %s: %s",
+				time.Since(start).Round(time.Millisecond), err))
+		} else {
+			log.Info(fmt.Sprintf("✅  build succeeded in %s",
+				time.Since(start).Round(time.Millisecond)))
+		}
+		log.Info(fmt.Sprintf("👀  watching app template %q for changes, press Ctrl-C to stop...", dir))
+	})
+	if err == nil {
+		log.Info("👋  stopped watching")
+	}
+	return err
+}
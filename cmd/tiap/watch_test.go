@@ -0,0 +1,155 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/onsi/gomega/gbytes"
+	"github.com/otiai10/copy"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("watching app templates", func() {
+
+	It("snapshots templates, ignoring paths", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "detail.json"), []byte("{}"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "foo.app"), nil, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "foo.app.sbom.json"), nil, 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, ".git", "refs"), 0755)).To(Succeed())
+
+		snapshot := Successful(templateSnapshot(dir, []string{filepath.Join(dir, "foo.app")}))
+		Expect(snapshot).To(HaveKey(filepath.Join(dir, "detail.json")))
+		Expect(snapshot).NotTo(HaveKey(filepath.Join(dir, "foo.app")))
+		Expect(snapshot).NotTo(HaveKey(filepath.Join(dir, "foo.app.sbom.json")))
+		Expect(snapshot).NotTo(HaveKey(filepath.Join(dir, ".git")))
+	})
+
+	It("rebuilds once after rapid successive changes", func(ctx context.Context) {
+		dir := GinkgoT().TempDir()
+		detail := filepath.Join(dir, "detail.json")
+		Expect(os.WriteFile(detail, []byte("{}"), 0644)).To(Succeed())
+
+		var builds atomic.Int32
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			done <- watchTemplate(ctx, dir, nil,
+				10*time.Millisecond, 200*time.Millisecond,
+				func() { builds.Add(1) })
+		}()
+		Eventually(builds.Load).Should(Equal(int32(1)))
+
+		for i := range 5 {
+			Expect(os.WriteFile(detail, []byte{'{', byte('0' + i), '}'}, 0644)).To(Succeed())
+			time.Sleep(20 * time.Millisecond)
+		}
+		Consistently(builds.Load).WithTimeout(100 * time.Millisecond).Should(Equal(int32(1)))
+		Eventually(builds.Load).Should(Equal(int32(2)))
+		Consistently(builds.Load).WithTimeout(300 * time.Millisecond).Should(Equal(int32(2)))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("cancels builds in progress when stopping to watch", func(ctx context.Context) {
+		out := logrus.StandardLogger().Out
+		DeferCleanup(func() { logrus.SetOutput(out) })
+		logrus.SetOutput(GinkgoWriter)
+		dir := GinkgoT().TempDir()
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		cancelled := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			done <- watchBuilds(ctx, dir, nil, func(ctx context.Context) error {
+				cancel()
+				<-ctx.Done()
+				close(cancelled)
+				return ctx.Err()
+			})
+		}()
+		Eventually(cancelled).Should(BeClosed())
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("doesn't rebuild because of its own output inside the template", func(ctx context.Context) {
+		out := logrus.StandardLogger().Out
+		DeferCleanup(func() { logrus.SetOutput(out) })
+		logged := gbytes.NewBuffer()
+		logrus.SetOutput(io.MultiWriter(logged, GinkgoWriter))
+
+		template := GinkgoT().TempDir()
+		Expect(copy.Copy("../../testdata/app", template)).To(Succeed())
+		outname := filepath.Join(template, "hellorld.app")
+		args := []string{"-o", outname, "--" + noBundleFlag, "--" + appVersionFlag, "1.2.3",
+			"--" + sbomFlag, "cyclonedx", template}
+
+		// a previous build leaves its app package and SBOM in the template.
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		Expect(cmd.ExecuteContext(ctx)).To(Succeed())
+		Expect(filepath.Join(template, "hellorld.cdx.json")).To(BeARegularFile())
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			cmd := newRootCmd()
+			cmd.SetArgs(append([]string{"--" + watchFlag}, args...))
+			done <- cmd.ExecuteContext(ctx)
+		}()
+		Eventually(logged).Should(gbytes.Say("build succeeded"))
+		Consistently(logged).WithTimeout(3 * watchDebounce).ShouldNot(gbytes.Say("build succeeded"))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+
+		f := Successful(os.Open(outname))
+		defer f.Close()
+		tarrd := tar.NewReader(f)
+		for {
+			header, err := tarrd.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).NotTo(Or(Equal("hellorld.app"), Equal("hellorld.cdx.json")))
+		}
+	})
+
+	It("rejects watching git templates", func() {
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{"-o", "/tmp/nada.app", "--" + watchFlag,
+			"https://example.org/hellorld.git"})
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring(
+			"requires a local app template directory")))
+	})
+
+})
@@ -0,0 +1,99 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SelectProfiles removes all services from the composer project that are
+// guarded by a “profiles” list not containing any of the specified active
+// profiles, so that these services neither get their images pulled nor end
+// up in the saved composer project. Services without a “profiles” element
+// are always kept. Without calling SelectProfiles, all services are kept,
+// regardless of their profiles.
+//
+// SelectProfiles fails if a kept service depends on a removed service,
+// leaving the composer project unchanged.
+func (p *ComposerProject) SelectProfiles(active []string) error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	removed := map[string]nada{}
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		config, err := lookupMap(services, serviceName)
+		if err != nil {
+			return fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+		}
+		element, ok := config["profiles"]
+		if !ok {
+			continue
+		}
+		profiles, ok := element.([]any)
+		if !ok {
+			return fmt.Errorf("profiles in service %q is not a list", serviceName)
+		}
+		if slices.ContainsFunc(profiles, func(profile any) bool {
+			s, ok := profile.(string)
+			return ok && slices.Contains(active, s)
+		}) {
+			continue
+		}
+		log.Info(fmt.Sprintf("   🛎  service %q not in active profiles, skipping", serviceName))
+		removed[serviceName] = nada{}
+	}
+	// Check all dependencies before removing any service, so that the
+	// composer project stays untouched in case of errors.
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		if _, ok := removed[serviceName]; ok {
+			continue
+		}
+		config, _ := lookupMap(services, serviceName)
+		for _, dependency := range dependencies(config) {
+			if _, ok := removed[dependency]; ok {
+				return fmt.Errorf("service %q depends on service %q not in active profiles",
+					serviceName, dependency)
+			}
+		}
+	}
+	for serviceName := range removed {
+		delete(services, serviceName)
+	}
+	return nil
+}
+
+// dependencies returns the names of the services the specified service
+// configuration depends on, using either the short list or the long map
+// syntax of “depends_on”.
+func dependencies(config map[string]any) []string {
+	switch dependsOn := config["depends_on"].(type) {
+	case []any:
+		var names []string
+		for _, name := range dependsOn {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	case map[string]any:
+		return slices.Sorted(maps.Keys(dependsOn))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"bytes"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("composer project profiles", func() {
+
+	project := func() *ComposerProject {
+		return testProject(map[string]map[string]any{
+			"app": {"image": "busybox:stable", "mem_limit": "10mb"},
+			"debug": {
+				"image": "alpine:edge", "mem_limit": "10mb",
+				"profiles": []any{"debug", "dev"},
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("keeps all services unless selecting profiles", func() {
+		p := project()
+		Expect(p.Images()).To(HaveLen(2))
+	})
+
+	It("keeps services in an active profile", func() {
+		p := project()
+		Expect(p.SelectProfiles([]string{"dev"})).To(Succeed())
+		Expect(p.Images()).To(And(
+			HaveKeyWithValue("app", "busybox:stable"),
+			HaveKeyWithValue("debug", "alpine:edge"),
+		))
+	})
+
+	It("removes all services with profiles when no profile is active", func() {
+		p := project()
+		Expect(p.SelectProfiles(nil)).To(Succeed())
+		Expect(p.Images()).To(And(
+			HaveLen(1),
+			HaveKeyWithValue("app", "busybox:stable"),
+		))
+	})
+
+	It("removes services not in any active profile", func() {
+		p := project()
+		Expect(p.SelectProfiles([]string{"migration"})).To(Succeed())
+		Expect(p.Images()).To(And(
+			HaveLen(1),
+			HaveKeyWithValue("app", "busybox:stable"),
+		))
+		var saved bytes.Buffer
+		Expect(p.Save(&saved)).To(Succeed())
+		Expect(saved.String()).NotTo(ContainSubstring("debug"))
+	})
+
+	It("rejects dependencies on removed services", func() {
+		p := project()
+		services := Successful(lookupMap(p.yaml, "services"))
+		services["app"].(map[string]any)["depends_on"] = map[string]any{
+			"debug": map[string]any{"condition": "service_started"},
+		}
+		Expect(p.SelectProfiles(nil)).To(MatchError(
+			`service "app" depends on service "debug" not in active profiles`))
+		Expect(p.Images()).To(HaveKey("debug"))
+
+		p = project()
+		services = Successful(lookupMap(p.yaml, "services"))
+		services["app"].(map[string]any)["depends_on"] = []any{"debug"}
+		Expect(p.SelectProfiles(nil)).To(MatchError(ContainSubstring(`depends on service "debug"`)))
+	})
+
+	It("rejects invalid profiles", func() {
+		Expect((&ComposerProject{}).SelectProfiles(nil)).To(MatchError(
+			ContainSubstring("no services found")))
+		p := project()
+		services := Successful(lookupMap(p.yaml, "services"))
+		services["debug"].(map[string]any)["profiles"] = "debug"
+		Expect(p.SelectProfiles(nil)).To(MatchError(`profiles in service "debug" is not a list`))
+	})
+
+})
@@ -16,19 +16,26 @@ package tiap
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"maps"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/distribution/reference"
 	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/daemon"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
 
@@ -41,36 +48,142 @@ var composerFiles = []string{
 
 // ComposerProject represents a loaded Docker composer project.
 type ComposerProject struct {
-	yaml map[string]any
+	yaml             map[string]any
+	savedImages      []SavedImage
+	compressedImages bool     // saved images are gzip-compressed tar-balls.
+	optionalMemLimit bool     // services don't need to declare mem_limit.
+	allowLatest      bool     // permit "latest" images with only a warning.
+	extraImages      []string // additional images not referenced by services.
+}
+
+// tiapExtension is the top-level composer project extension element for
+// tiap-specific project settings. As it is meaningless to Industrial Edge, it
+// gets removed from the composer project when loading it.
+const tiapExtension = "x-tiap"
+
+// extraImagesExtension is the top-level composer project extension element
+// listing additional images to be packaged that aren't referenced by any
+// service, such as one-time migration images. As it is meaningless to
+// Industrial Edge, it gets removed from the composer project when loading it.
+const extraImagesExtension = "x-tiap-extra-images"
+
+// SavedImage describes a container image that has been pulled and saved.
+type SavedImage struct {
+	Ref    string `json:"image"`  // image reference as used in the project
+	Digest string `json:"digest"` // registry digest the image reference resolves to, see WithRegistryDigests
+	ID     string `json:"id"`     // image ID, that is, the config digest
 }
 
 // LoadComposerProject looks in the specified “dir” for a Docker composer
 // project file and loads it. This takes the several official variations of
 // composer project file names into account. However, contrary to Docker's
 // composer, it doesn't look into parent directories for project files and it
-// doesn't take overrides into account.
+// doesn't take overrides into account; use LoadComposerProjectWithOverrides
+// for this.
 func LoadComposerProject(dir string) (*ComposerProject, error) {
+	name, err := findComposerFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewComposerProject(name)
+}
+
+// findComposerFile returns the path of the composer project file in the
+// specified directory.
+func findComposerFile(dir string) (string, error) {
 	for _, projectFilename := range composerFiles {
 		name := filepath.Join(dir, projectFilename)
 		if _, err := os.Stat(name); err == nil {
-			return NewComposerProject(name)
+			return name, nil
 		}
 	}
-	return nil, fmt.Errorf("no composer project file found in directory %s", dir)
+	return "", fmt.Errorf("no composer project file found in directory %s", dir)
 }
 
 // NewComposerProject reads the specified YAML file containing a (Docker)
-// composer project and returns a ComposerProject object for it.
+// composer project and returns a ComposerProject object for it. Any composer
+// project files referenced in a top-level “include” element get loaded and
+// merged into the project, see also [resolveIncludes].
 func NewComposerProject(path string) (*ComposerProject, error) {
+	projectYAML, err := loadComposerYAML(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	p := &ComposerProject{yaml: projectYAML}
+	if err := p.applyExtension(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadComposerYAML reads the specified YAML file containing a (Docker)
+// composer project, resolving its includes. The “including” parameter lists
+// the absolute paths of the composer project files currently being included,
+// in order to detect cyclic includes.
+func loadComposerYAML(path string, including []string) (map[string]any, error) {
 	yamltext, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read composer project, reason: %w", err)
 	}
-	p := &ComposerProject{}
-	if err := yaml.Unmarshal(yamltext, &p.yaml); err != nil {
+	var projectYAML map[string]any
+	if err := yaml.Unmarshal(yamltext, &projectYAML); err != nil {
 		return nil, fmt.Errorf("malformed composer project, reason: %w", err)
 	}
-	return p, nil
+	if StrictParsing {
+		if err := checkSingleYAMLDocument(yamltext); err != nil {
+			return nil, fmt.Errorf("malformed composer project, reason: %w", err)
+		}
+	}
+	if err := resolveIncludes(projectYAML, path, including); err != nil {
+		return nil, err
+	}
+	return projectYAML, nil
+}
+
+// applyExtension applies the settings from the project's tiapExtension
+// element, if any, and then removes the element from the project. Currently,
+// the only setting is “require-mem-limit”, which when false disables the
+// mem_limit check for all services. In addition, applyExtension picks up
+// the extra images listed in the extraImagesExtension element, if any, also
+// removing it.
+func (p *ComposerProject) applyExtension() error {
+	if element, ok := p.yaml[extraImagesExtension]; ok {
+		delete(p.yaml, extraImagesExtension)
+		list, ok := element.([]any)
+		if !ok {
+			return fmt.Errorf("%s in composer project is not a list", extraImagesExtension)
+		}
+		for _, imageRef := range list {
+			s, ok := imageRef.(string)
+			if !ok {
+				return fmt.Errorf("invalid %s image reference %v in composer project",
+					extraImagesExtension, imageRef)
+			}
+			p.extraImages = append(p.extraImages, s)
+		}
+	}
+	element, ok := p.yaml[tiapExtension]
+	if !ok {
+		return nil
+	}
+	delete(p.yaml, tiapExtension)
+	settings, ok := element.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s in composer project is not an associative array", tiapExtension)
+	}
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		switch key {
+		case "require-mem-limit":
+			require, ok := settings[key].(bool)
+			if !ok {
+				return fmt.Errorf("%s.%s in composer project is not a boolean", tiapExtension, key)
+			}
+			p.optionalMemLimit = !require
+		default:
+			return fmt.Errorf("unknown %s setting %q in composer project", tiapExtension, key)
+		}
+	}
+	return nil
 }
 
 // ServiceImages maps service names in Docker composer projects to their image
@@ -78,7 +191,12 @@ func NewComposerProject(path string) (*ComposerProject, error) {
 type ServiceImages map[string]string
 
 // Images returns the mapping between services defined in this composer project
-// and the container images they reference.
+// and the container images they reference. Images also checks the extra
+// images of the project, if any, but doesn't return them, as they aren't
+// referenced by any service. It warns about services referencing the same
+// repository using different tags or digests. Finally, it checks the container
+// names to be unique, see [ComposerProject.CheckContainerNames]. Images stops
+// at the first problem; use [ComposerProject.Validate] to get all problems.
 func (p *ComposerProject) Images() (ServiceImages, error) {
 	svcimgs := ServiceImages{}
 
@@ -86,59 +204,309 @@ func (p *ComposerProject) Images() (ServiceImages, error) {
 	if err != nil {
 		return nil, fmt.Errorf("no services found, reason: %w", err)
 	}
-	for serviceName := range services {
+	// Iterate over the services in a stable order, so that logs as well as
+	// errors are reproducible.
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		imageRef, err := p.checkService(services, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		log.Info(fmt.Sprintf("   🛎  service %q wants 🖼  image %q", serviceName, imageRef))
+		if config, _ := lookupMap(services, serviceName); config["build"] != nil {
+			log.Warn(fmt.Sprintf("⚠  service %q has build: in addition to image:, ignoring build: and using the prebuilt image",
+				serviceName))
+		}
+		svcimgs[serviceName] = imageRef
+	}
+
+	for _, conflict := range imageConflicts(svcimgs) {
+		log.Warn(fmt.Sprintf("⚠  %s", conflict))
+	}
+
+	for _, imageRef := range p.extraImages {
+		log.Info(fmt.Sprintf("   🛎  extra 🖼  image %q", imageRef))
+		if err := p.checkImageRef(extraImagesExtension, imageRef); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.CheckContainerNames(); err != nil {
+		return nil, err
+	}
+
+	return svcimgs, nil
+}
+
+// Validate checks all services of this composer project, as well as its extra
+// images and container names, in the same way as Images does. However, instead
+// of stopping at the first problem, Validate returns a single error joining
+// all problems found, such as all services lacking a mem_limit declaration,
+// so callers can inspect the individual problems using errors.Is and
+// errors.As.
+func (p *ComposerProject) Validate() error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	var problems []error
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		if _, err := p.checkService(services, serviceName); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	for _, imageRef := range p.extraImages {
+		if err := p.checkImageRef(extraImagesExtension, imageRef); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if err := p.CheckContainerNames(); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+// checkService checks the image reference and memory limit of the named
+// service, returning the service's image reference. Services only having a
+// “build” element instead of an image reference are rejected, as app packages
+// must ship prebuilt images.
+func (p *ComposerProject) checkService(services map[string]any, serviceName string) (string, error) {
+	config, err := lookupMap(services, serviceName)
+	if err != nil {
+		return "", fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+	}
+	if _, hasImage := config["image"]; !hasImage && config["build"] != nil {
+		return "", fmt.Errorf("service %q uses build: but IE app packages require prebuilt image: references",
+			serviceName)
+	}
+	imageRef, err := lookupString(config, "image")
+	if err != nil {
+		return "", fmt.Errorf("invalid image element in service %q, reason: %w", serviceName, err)
+	}
+	if err := p.checkImageRef(fmt.Sprintf("service %q", serviceName), imageRef); err != nil {
+		return "", err
+	}
+	if _, ok := config["mem_limit"]; !ok && p.optionalMemLimit {
+		return imageRef, nil
+	}
+	memLimit, err := lookupString(config, "mem_limit")
+	if err != nil {
+		return "", fmt.Errorf("service %q lacks mem_limit declaration", serviceName)
+	}
+	if _, err := units.FromHumanSize(memLimit); err != nil {
+		return "", fmt.Errorf("service %q has invalid mem_limit %q, reason: %w",
+			serviceName, memLimit, err)
+	}
+	return imageRef, nil
+}
+
+// imageConflicts returns descriptions of the repositories referenced by
+// multiple services using different tags or digests, as the app package then
+// contains inconsistent versions of the “same” image. The descriptions are
+// sorted by repository name.
+func imageConflicts(svcimgs ServiceImages) []string {
+	repos := map[string][]string{} // repository -> services
+	for _, serviceName := range slices.Sorted(maps.Keys(svcimgs)) {
+		named, err := reference.ParseNormalizedNamed(svcimgs[serviceName])
+		if err != nil {
+			continue
+		}
+		repos[named.Name()] = append(repos[named.Name()], serviceName)
+	}
+	var conflicts []string
+	for _, repo := range slices.Sorted(maps.Keys(repos)) {
+		services := repos[repo]
+		refs := map[string]nada{}
+		for _, serviceName := range services {
+			named, _ := reference.ParseNormalizedNamed(svcimgs[serviceName])
+			refs[named.String()] = nada{}
+		}
+		if len(refs) < 2 {
+			continue
+		}
+		uses := make([]string, 0, len(services))
+		for _, serviceName := range services {
+			uses = append(uses, fmt.Sprintf("service %q uses %q", serviceName, svcimgs[serviceName]))
+		}
+		conflicts = append(conflicts, fmt.Sprintf(
+			"repository %q referenced with different tags or digests: %s",
+			repo, strings.Join(uses, ", ")))
+	}
+	return conflicts
+}
+
+// AllowLatest permits image references using the “latest” tag, whether
+// explicitly or implicitly, logging a warning instead of rejecting them. This
+// is meant only for local experimentation, as the resulting app packages
+// aren't reproducible.
+func (p *ComposerProject) AllowLatest() {
+	p.allowLatest = true
+}
+
+// checkImageRef checks the specified image reference to be valid and to
+// explicitly specify a tag other than “latest” or a digest. The “referrer”
+// describes where the image reference comes from for use in error messages,
+// such as “service "foo"”. When “latest” images have been allowed using
+// AllowLatest, they only get a warning.
+func (p *ComposerProject) checkImageRef(referrer string, imageRef string) error {
+	ir, err := reference.Parse(imageRef)
+	if err != nil {
+		return fmt.Errorf("%s with invalid image reference %q, reason: %w",
+			referrer, imageRef, err)
+	}
+	tagged, isTagged := ir.(reference.Tagged)
+	if isTagged && tagged.Tag() == "latest" {
+		return p.latestImage(fmt.Errorf("%s attempts to use latest tag", referrer))
+	}
+	if _, isDigested := ir.(reference.Digested); !isTagged && !isDigested {
+		return p.latestImage(fmt.Errorf("%s image %q has no explicit tag (implies :latest)",
+			referrer, imageRef))
+	}
+	return nil
+}
+
+// latestImage returns the specified error about an image using the “latest”
+// tag, unless “latest” images have been allowed using AllowLatest; then, it
+// logs a warning instead and returns nil.
+func (p *ComposerProject) latestImage(err error) error {
+	if !p.allowLatest {
+		return err
+	}
+	log.Warn(fmt.Sprintf("⚠  %s, allowed only for experimentation", err))
+	return nil
+}
+
+// QualifyImages rewrites the image references of all services into their
+// fully-qualified form, including an explicit registry, such as
+// “docker.io/library/busybox:stable” instead of just “busybox:stable”. Images
+// without an explicit registry are considered to come from DefaultRegistry.
+func (p *ComposerProject) QualifyImages() error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
 		config, err := lookupMap(services, serviceName)
 		if err != nil {
-			return nil, fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+			return fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
 		}
 		imageRef, err := lookupString(config, "image")
 		if err != nil {
-			return nil, fmt.Errorf("invalid image element in service %q, reason: %w", serviceName, err)
+			return fmt.Errorf("invalid image element in service %q, reason: %w", serviceName, err)
 		}
-		log.Info(fmt.Sprintf("   🛎  service %q wants 🖼  image %q", serviceName, imageRef))
-		ir, err := reference.Parse(imageRef)
+		qualifiedRef, err := qualifyImageRef(imageRef)
 		if err != nil {
-			return nil, fmt.Errorf("service %q with invalid image reference %q, reason: %w",
+			return fmt.Errorf("service %q with invalid image reference %q, reason: %w",
 				serviceName, imageRef, err)
 		}
-		if tagged, ok := ir.(reference.Tagged); ok && tagged.Tag() == "latest" {
-			return nil, fmt.Errorf("service %q attempts to use latest tag", serviceName)
+		if qualifiedRef != imageRef {
+			log.Info(fmt.Sprintf("   🛎  service %q 🖼  image %q qualified as %q",
+				serviceName, imageRef, qualifiedRef))
 		}
-		svcimgs[serviceName] = imageRef
-		memLimit, err := lookupString(config, "mem_limit")
+		config["image"] = qualifiedRef
+	}
+	return nil
+}
+
+// qualifyImageRef returns the fully-qualified form of the specified image
+// reference. As the Docker Hub registry is known as “index.docker.io” to
+// go-containerregistry, we use the more common “docker.io” instead.
+func qualifyImageRef(imageRef string) (string, error) {
+	ref, err := name.ParseReference(imageRef, name.WithDefaultRegistry(DefaultRegistry))
+	if err != nil {
+		return "", err
+	}
+	qualifiedRef := ref.Name()
+	if rest, ok := strings.CutPrefix(qualifiedRef, name.DefaultRegistry+"/"); ok {
+		qualifiedRef = "docker.io/" + rest
+	}
+	return qualifiedRef, nil
+}
+
+// RewriteImages rewrites the image references of all services by passing them
+// to the specified rewrite function, such as for switching to an internal
+// registry of an air-gapped installation. Rewritten references must still
+// explicitly specify a tag other than “latest” or a digest. As the services
+// afterwards reference the rewritten images, call RewriteImages only after
+// pulling the images from their original sources. RewriteImages either
+// rewrites all image references or, in case of any error, none at all.
+func (p *ComposerProject) RewriteImages(rewrite func(ref string) (string, error)) error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	// Only apply the rewritten image references after all of them have been
+	// successfully determined, so that we never leave the composer project
+	// half rewritten.
+	rewrites := map[string]string{}
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		config, err := lookupMap(services, serviceName)
+		if err != nil {
+			return fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+		}
+		imageRef, err := lookupString(config, "image")
+		if err != nil {
+			return fmt.Errorf("invalid image element in service %q, reason: %w", serviceName, err)
+		}
+		if _, err := reference.Parse(imageRef); err != nil {
+			return fmt.Errorf("service %q with invalid image reference %q, reason: %w",
+				serviceName, imageRef, err)
+		}
+		rewrittenRef, err := rewrite(imageRef)
 		if err != nil {
-			return nil, fmt.Errorf("service %q lacks mem_limit declaration", serviceName)
+			return fmt.Errorf("cannot rewrite image reference %q of service %q, reason: %w",
+				imageRef, serviceName, err)
 		}
-		if _, err := units.FromHumanSize(memLimit); err != nil {
-			return nil, fmt.Errorf("service %q has invalid mem_limit %q, reason: %w",
-				serviceName, memLimit, err)
+		if err := p.checkImageRef(fmt.Sprintf("service %q rewritten", serviceName), rewrittenRef); err != nil {
+			return err
 		}
+		rewrites[serviceName] = rewrittenRef
 	}
-
-	return svcimgs, nil
+	for _, serviceName := range slices.Sorted(maps.Keys(rewrites)) {
+		config, _ := lookupMap(services, serviceName)
+		if imageRef := config["image"]; rewrites[serviceName] != imageRef {
+			log.Info(fmt.Sprintf("   🛎  service %q 🖼  image %q rewritten as %q",
+				serviceName, imageRef, rewrites[serviceName]))
+		}
+		config["image"] = rewrites[serviceName]
+	}
+	return nil
 }
 
 type nada struct{} // not "any"
 
 // PullImages takes a service-to-image reference mapping and pulls and saves the
-// required container images. The caller is responsible to supply the correct
-// "root" directory path inside which to place the images in a “image/”
-// subdirectory. That is, the root path needs to reference the arbitrarily named
+// required container images, as well as any extra images of the project,
+// skipping images already saved before or found in the image cache, see
+// WithImageCache. The caller is responsible to supply the correct "root"
+// directory path inside which to place the images in a “image/” subdirectory.
+// That is, the root path needs to reference the arbitrarily named
 // “repository” folder.
+//
+// PullImages pulls up to as many images in parallel as set using
+// WithConcurrency, defaulting to the number of CPUs, but at most 4. When
+// pulling an
+// image fails, PullImages cancels the other pulls still in progress and
+// returns the first error.
+//
+// Pass WithProgress in order to receive the progress of pulling and saving each
+// image.
 func (p *ComposerProject) PullImages(
 	ctx context.Context,
 	serviceimgs ServiceImages,
 	platform string,
 	root string,
 	optclient daemon.Client,
+	opts ...PullOption,
 ) error {
+	options := pullOptions(opts)
 	// As multiple services might reference the same container image and we must
-	// pull an image only once we first determine the unique image references.
-	uniqueImageRefs := map[string]nada{}
-	for _, imageRef := range serviceimgs {
-		uniqueImageRefs[imageRef] = nada{}
+	// pull an image only once we first determine the unique image references,
+	// as well as the order in which to pull them.
+	imageRefs, err := p.pullOrder(serviceimgs, options.ByDependencies)
+	if err != nil {
+		return fmt.Errorf("cannot determine image pull order, reason: %w", err)
 	}
-	log.Debugf("🐛 fetching and tar-ball'ing %d images...", len(uniqueImageRefs))
+	log.Debugf("🐛 fetching and tar-ball'ing %d images...", len(imageRefs))
 	// Prepare the images subdirectory where we will place the downloaded
 	// container images and then pull ... pull ... PULL!
 	imagesDir := filepath.Join(root, "images")
@@ -147,17 +515,141 @@ func (p *ComposerProject) PullImages(
 	}
 
 	start := time.Now()
-	for _, imageRef := range slices.Sorted(maps.Keys(uniqueImageRefs)) {
-		_, err := SaveImageToFile(ctx, imageRef, platform, imagesDir, optclient)
-		if err != nil {
-			return fmt.Errorf("cannot pull and save image %q, reason: %w", imageRef, err)
-		}
+	p.savedImages = nil
+	savedImages := make([]SavedImage, len(imageRefs))
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = min(runtime.NumCPU(), 4)
 	}
+	log.Debugf("🐛 pulling up to %d images in parallel", concurrency)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for idx, imageRef := range imageRefs {
+		g.Go(func() error {
+			saved, err := pullAndSaveImage(gctx, imageRef, platform, imagesDir, optclient, options)
+			if err != nil {
+				return err
+			}
+			savedImages[idx] = saved
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	slices.SortFunc(savedImages, func(a, b SavedImage) int {
+		return strings.Compare(a.Ref, b.Ref)
+	})
+	p.savedImages = savedImages
+	p.compressedImages = options.Compress
 	duration := time.Duration(math.Ceil(time.Since(start).Seconds())) * time.Second
 	log.Debugf("🐛 all images fetched and saved in %s", duration)
 	return nil
 }
 
+// savedImageDigest returns the digest of an image that hasn't been freshly
+// pulled from its registry. For images referenced by digest this simply is the
+// referenced digest. Otherwise, only when asked to via WithRegistryDigests,
+// savedImageDigest asks the registry what the image reference resolves to, so
+// that the digest doesn't change when resuming or using the image cache or the
+// local daemon. In all other cases, as well as when the registry cannot be
+// reached, savedImageDigest falls back to the digest of the local image.
+func savedImageDigest(ctx context.Context, ref name.Reference, image ociv1.Image, options PullOptions) (string, error) {
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+	if options.RegistryDigests {
+		var digest string
+		err := retry(ctx, options, fmt.Sprintf("resolving digest of image %q", ref.String()), func(ctx context.Context) (err error) {
+			digest, err = registryDigest(ctx, ref, options)
+			return err
+		})
+		if err == nil {
+			return digest, nil
+		}
+		log.Warn(fmt.Sprintf("⚠  cannot resolve registry digest of image %q, using local digest instead, reason: %s",
+			ref.String(), err))
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		return "", err
+	}
+	return digest.String(), nil
+}
+
+// pullAndSaveImage pulls and saves the referenced image into the specified
+// images directory, unless it has already been saved before, returning the
+// details of the saved image. The digest of a freshly pulled image is the
+// digest the image reference resolves to in its registry; see savedImageDigest
+// for images taken from the images directory or the local daemon. When
+// mirroring, see WithMirror, pullAndSaveImage additionally pushes the image to
+// the mirror registry, regardless of whether the image has been freshly pulled
+// or not.
+func pullAndSaveImage(
+	ctx context.Context,
+	imageRef string,
+	platform string,
+	imagesDir string,
+	optclient daemon.Client,
+	options PullOptions,
+) (SavedImage, error) {
+	var digest string
+	pulled := false
+	image := savedImage(imageRef, platform, imagesDir, options.Compress)
+	if image != nil {
+		log.Info(fmt.Sprintf("   ♻  🖼  image %q already saved, skipping", imageRef))
+		options.Progress.report(imageRef, PullSkipped, 0, time.Now())
+	} else if image, digest = cachedImage(options.CacheDir, imageRef, platform, imagesDir, options.Compress); image != nil {
+		log.Info(fmt.Sprintf("   ♻  🖼  image %q taken from image cache, skipping", imageRef))
+		options.Progress.report(imageRef, PullSkipped, 0, time.Now())
+	} else {
+		err := retry(ctx, options, fmt.Sprintf("pulling image %q", imageRef), func(ctx context.Context) (err error) {
+			_, image, digest, err = saveImageToFile(ctx, imageRef, platform, imagesDir, optclient, options)
+			return err
+		})
+		if err != nil {
+			return SavedImage{}, fmt.Errorf("cannot pull and save image %q, reason: %w", imageRef, err)
+		}
+		pulled = true
+	}
+	ref, err := name.ParseReference(imageRef, name.WithDefaultRegistry(DefaultRegistry))
+	if err != nil {
+		return SavedImage{}, fmt.Errorf("invalid image reference %q: %w", imageRef, err)
+	}
+	if digest == "" {
+		digest, err = savedImageDigest(ctx, ref, image, options)
+		if err != nil {
+			return SavedImage{}, fmt.Errorf("cannot determine digest of image %q, reason: %w", imageRef, err)
+		}
+	}
+	if pulled {
+		cacheImage(options.CacheDir, imageRef, imagesDir, options.Compress, digest)
+	}
+	if options.Mirror != "" {
+		err = retry(ctx, options, fmt.Sprintf("mirroring image %q", imageRef), func(ctx context.Context) error {
+			return mirrorImage(ctx, options.Mirror, ref, image, options)
+		})
+		if err != nil {
+			return SavedImage{}, err
+		}
+	}
+	id, err := image.ConfigName()
+	if err != nil {
+		return SavedImage{}, fmt.Errorf("cannot determine ID of image %q, reason: %w", imageRef, err)
+	}
+	return SavedImage{
+		Ref:    imageRef,
+		Digest: digest,
+		ID:     id.String(),
+	}, nil
+}
+
+// SavedImages returns the images pulled and saved by the most recent call to
+// PullImages, sorted by their image references.
+func (p *ComposerProject) SavedImages() []SavedImage {
+	return slices.Clone(p.savedImages)
+}
+
 // Save writes the loaded composer project to the specified io.Writer, returning
 // an error in case of failure.
 func (p *ComposerProject) Save(w io.Writer) error {
@@ -173,6 +665,22 @@ func (p *ComposerProject) Save(w io.Writer) error {
 	return nil
 }
 
+// SaveJSON writes the loaded composer project in JSON format to the specified
+// io.Writer, returning an error in case of failure. Object keys are emitted in
+// sorted order, so the JSON output is canonical.
+func (p *ComposerProject) SaveJSON(w io.Writer) error {
+	log.Debugf("🐛 saving composer project as JSON...")
+	b, err := json.Marshal(p.yaml)
+	if err != nil {
+		return fmt.Errorf("cannot JSONize composer project, reason: %w", err)
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		return fmt.Errorf("cannot write composer project JSON, reason: %w", err)
+	}
+	return nil
+}
+
 func lookupMap(yaml map[string]any, key string) (map[string]any, error) {
 	element := yaml[key]
 	if element == nil {
@@ -17,12 +17,18 @@ package tiap
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/distribution/reference"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
 	. "github.com/thediveo/success"
+	"gopkg.in/yaml.v3"
 )
 
 var _ = Describe("IE app composer projects", Ordered, func() {
@@ -38,6 +44,40 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 		))
 	})
 
+	It("processes services in a stable order", func() {
+		GrabLog(logrus.InfoLevel)
+		services := map[string]any{}
+		for idx := range 20 {
+			services[fmt.Sprintf("svc%02d", idx)] = map[string]any{
+				"image":     fmt.Sprintf("busybox:%d", idx),
+				"mem_limit": "8M",
+			}
+		}
+		p := &ComposerProject{yaml: map[string]any{"services": services}}
+		run := func() (string, string) {
+			logs := &bytes.Buffer{}
+			logrus.SetOutput(logs)
+			defer logrus.SetOutput(GinkgoWriter)
+			Expect(p.Images()).Error().NotTo(HaveOccurred())
+			saved := &bytes.Buffer{}
+			Expect(p.Save(saved)).To(Succeed())
+			return logs.String(), saved.String()
+		}
+		logs, saved := run()
+		Expect(strings.Index(logs, "svc00")).To(BeNumerically("<", strings.Index(logs, "svc19")))
+		for range 5 {
+			l, s := run()
+			Expect(l).To(Equal(logs))
+			Expect(s).To(Equal(saved))
+		}
+
+		services["svc07"] = 42
+		services["svc13"] = 42
+		for range 5 {
+			Expect(p.Images()).Error().To(MatchError(ContainSubstring(`invalid service "svc07"`)))
+		}
+	})
+
 	It("automatically loads composer files .yml and .yaml", func() {
 		Expect(LoadComposerProject("testdata/composer/empty")).Error().To(
 			MatchError(ContainSubstring("no composer project file")))
@@ -45,6 +85,56 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 		Expect(LoadComposerProject("testdata/composer/hellorld")).Error().NotTo(HaveOccurred())
 	})
 
+	It("optionally doesn't require mem_limit", func() {
+		GrabLog(logrus.InfoLevel)
+		p := Successful(LoadComposerProject("testdata/composer/nomemlimit"))
+		Expect(p.yaml).NotTo(HaveKey(tiapExtension))
+		Expect(p.Images()).To(HaveLen(2))
+
+		var buff bytes.Buffer
+		Expect(p.Save(&buff)).To(Succeed())
+		Expect(buff.String()).NotTo(ContainSubstring("x-tiap"))
+
+		p.yaml["services"].(map[string]any)["bar"].(map[string]any)["mem_limit"] = "8 zettabananas"
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("invalid mem_limit")))
+
+		delete(p.yaml["services"].(map[string]any)["bar"].(map[string]any), "mem_limit")
+		p.yaml["services"].(map[string]any)["foo"].(map[string]any)["image"] = "busybox:latest"
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("attempts to use latest tag")))
+	})
+
+	DescribeTable("rejecting invalid tiap extensions",
+		func(extension any, errmsg string) {
+			p := &ComposerProject{yaml: map[string]any{tiapExtension: extension}}
+			Expect(p.applyExtension()).To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "foo", "not an associative array"),
+		Entry(nil, map[string]any{"require-mem-limit": "no"}, "not a boolean"),
+		Entry(nil, map[string]any{"foo": true}, `unknown x-tiap setting "foo"`),
+	)
+
+	It("rejects untagged image references", func() {
+		GrabLog(logrus.InfoLevel)
+		p := &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": "busybox", "mem_limit": "10mb"},
+			},
+		}}
+		Expect(p.Images()).Error().To(MatchError(
+			`service "foo" image "busybox" has no explicit tag (implies :latest)`))
+	})
+
+	It("accepts digest-only image references", func() {
+		GrabLog(logrus.InfoLevel)
+		imageRef := "busybox@sha256:" + strings.Repeat("0", 64)
+		p := &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": imageRef, "mem_limit": "10mb"},
+			},
+		}}
+		Expect(p.Images()).To(HaveKeyWithValue("foo", imageRef))
+	})
+
 	It("rejects latest image references in projects", func() {
 		GrabLog(logrus.InfoLevel)
 		p := Successful(LoadComposerProject("testdata/composer/latest"))
@@ -70,6 +160,179 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 		Expect(imgs["bar"]).To(Equal(imgs["baz"]))
 	})
 
+	It("checks extra images", func() {
+		GrabLog(logrus.InfoLevel)
+		p := Successful(LoadComposerProject("testdata/composer/extra"))
+		Expect(p.yaml).NotTo(HaveKey(extraImagesExtension))
+		Expect(p.extraImages).To(ConsistOf("alpine:edge"))
+		Expect(p.Images()).To(Equal(ServiceImages{"foo": "busybox:stable"}))
+
+		var buff bytes.Buffer
+		Expect(p.Save(&buff)).To(Succeed())
+		Expect(buff.String()).NotTo(ContainSubstring(extraImagesExtension))
+
+		p.extraImages = []string{"alpine:latest"}
+		Expect(p.Images()).Error().To(MatchError("x-tiap-extra-images attempts to use latest tag"))
+		p.extraImages = []string{"alpine"}
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("has no explicit tag")))
+	})
+
+	DescribeTable("rejecting invalid extra images",
+		func(extraImages any, errmsg string) {
+			p := &ComposerProject{yaml: map[string]any{extraImagesExtension: extraImages}}
+			Expect(p.applyExtension()).To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "alpine:edge", "is not a list"),
+		Entry(nil, []any{42}, "invalid x-tiap-extra-images image reference 42"),
+	)
+
+	It("pulls and saves extra images", slowSpec, func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		tmpDirPath := Successful(os.MkdirTemp("", "tiap-test-*"))
+		defer os.RemoveAll(tmpDirPath)
+
+		p := Successful(LoadComposerProject("testdata/composer/extra"))
+		Expect(pullLimiter.Wait(ctx)).To(Succeed())
+		imgs := Successful(p.Images())
+		Expect(p.PullImages(ctx, imgs, canaryPlatform, tmpDirPath, nil)).To(Succeed())
+		Expect(p.SavedImages()).To(ConsistOf(
+			HaveField("Ref", "alpine:edge"),
+			HaveField("Ref", "busybox:stable"),
+		))
+		Expect(filepath.Join(tmpDirPath, "images", imageFilename("alpine:edge", false))).To(BeARegularFile())
+	})
+
+	It("warns about conflicting references to the same repository", func() {
+		Expect(imageConflicts(ServiceImages{
+			"foo": "busybox:stable",
+			"bar": "docker.io/library/busybox:stable",
+			"baz": "alpine:edge",
+		})).To(BeEmpty())
+		digest := "sha256:" + strings.Repeat("0", 64)
+		Expect(imageConflicts(ServiceImages{
+			"foo": "busybox:stable",
+			"bar": "docker.io/library/busybox:1.36",
+			"baz": "busybox@" + digest,
+			"qux": "alpine:edge",
+		})).To(ConsistOf(
+			`repository "docker.io/library/busybox" referenced with different tags or digests: ` +
+				`service "bar" uses "docker.io/library/busybox:1.36", ` +
+				`service "baz" uses "busybox@` + digest + `", ` +
+				`service "foo" uses "busybox:stable"`))
+
+		var logged bytes.Buffer
+		GrabLog(logrus.InfoLevel)
+		logrus.SetOutput(&logged)
+		p := &ComposerProject{yaml: map[string]any{"services": map[string]any{
+			"foo": map[string]any{"image": "busybox:stable", "mem_limit": "10mb"},
+			"bar": map[string]any{"image": "busybox:1.36", "mem_limit": "10mb"},
+		}}}
+		Expect(p.Images()).Error().NotTo(HaveOccurred())
+		Expect(logged.String()).To(ContainSubstring("level=warning"))
+		Expect(logged.String()).To(ContainSubstring("referenced with different tags or digests"))
+	})
+
+	It("rejects build-only services", func() {
+		GrabLog(logrus.InfoLevel)
+		p := &ComposerProject{yaml: map[string]any{"services": map[string]any{
+			"foo": map[string]any{"build": ".", "mem_limit": "10mb"},
+		}}}
+		Expect(p.Images()).Error().To(MatchError(
+			`service "foo" uses build: but IE app packages require prebuilt image: references`))
+		Expect(p.Validate()).To(MatchError(ContainSubstring("require prebuilt image")))
+	})
+
+	It("warns about services with both build and image", func() {
+		var logged bytes.Buffer
+		GrabLog(logrus.InfoLevel)
+		logrus.SetOutput(&logged)
+		p := &ComposerProject{yaml: map[string]any{"services": map[string]any{
+			"foo": map[string]any{
+				"build":     map[string]any{"context": "."},
+				"image":     "busybox:stable",
+				"mem_limit": "10mb",
+			},
+		}}}
+		Expect(p.Images()).To(HaveKeyWithValue("foo", "busybox:stable"))
+		Expect(logged.String()).To(ContainSubstring("level=warning"))
+		Expect(logged.String()).To(ContainSubstring(`service \"foo\" has build: in addition to image:`))
+	})
+
+	It("qualifies image references", func() {
+		GrabLog(logrus.InfoLevel)
+		p := &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": "busybox:stable"},
+				"bar": map[string]any{"image": "ghcr.io/thediveo/bar:1.2.3"},
+				"baz": map[string]any{"image": "thediveo/baz"},
+			},
+		}}
+		Expect(p.QualifyImages()).To(Succeed())
+		imgs := p.yaml["services"].(map[string]any)
+		Expect(imgs).To(And(
+			HaveKeyWithValue("foo", HaveKeyWithValue("image", "docker.io/library/busybox:stable")),
+			HaveKeyWithValue("bar", HaveKeyWithValue("image", "ghcr.io/thediveo/bar:1.2.3")),
+			HaveKeyWithValue("baz", HaveKeyWithValue("image", "docker.io/thediveo/baz:latest")),
+		))
+	})
+
+	It("rewrites image references", func() {
+		GrabLog(logrus.InfoLevel)
+		p := &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": "docker.io/library/foo:1.0", "mem_limit": "10mb"},
+				"bar": map[string]any{"image": "ghcr.io/thediveo/bar:1.2.3", "mem_limit": "10mb"},
+			},
+		}}
+		toInternal := func(ref string) (string, error) {
+			named, err := reference.ParseNormalizedNamed(ref)
+			if err != nil {
+				return "", err
+			}
+			path := reference.Path(named)
+			path = path[strings.LastIndex(path, "/")+1:]
+			return "my-internal-registry/" + path + ":" + named.(reference.Tagged).Tag(), nil
+		}
+		Expect(p.RewriteImages(toInternal)).To(Succeed())
+		Expect(p.Images()).To(And(
+			HaveKeyWithValue("foo", "my-internal-registry/foo:1.0"),
+			HaveKeyWithValue("bar", "my-internal-registry/bar:1.2.3"),
+		))
+
+		Expect(p.RewriteImages(func(ref string) (string, error) {
+			return "my-internal-registry/foo:latest", nil
+		})).To(MatchError(ContainSubstring("attempts to use latest tag")))
+		Expect(p.RewriteImages(func(ref string) (string, error) {
+			return ":@", nil
+		})).To(MatchError(ContainSubstring("invalid image reference")))
+		Expect(p.RewriteImages(func(ref string) (string, error) {
+			return "", errors.New("D'OH!")
+		})).To(MatchError(ContainSubstring("D'OH!")))
+
+		By("leaving all images unchanged when failing for some")
+		Expect(p.RewriteImages(func(ref string) (string, error) {
+			if strings.Contains(ref, "foo") {
+				return "", errors.New("D'OH!")
+			}
+			return "example.org/bar:6.6.6", nil
+		})).To(MatchError(ContainSubstring("D'OH!")))
+		Expect(p.Images()).To(And(
+			HaveKeyWithValue("foo", "my-internal-registry/foo:1.0"),
+			HaveKeyWithValue("bar", "my-internal-registry/bar:1.2.3"),
+		))
+	})
+
+	It("saves project as JSON", func() {
+		p := Successful(NewComposerProject("testdata/composer/hellorld/docker-compose.yml"))
+		w := &bytes.Buffer{}
+		Expect(p.SaveJSON(w)).To(Succeed())
+		// As JSON is YAML, we can unmarshal the JSON using the YAML
+		// unmarshaller and then compare with the original project data.
+		var fromJSON map[string]any
+		Expect(yaml.Unmarshal(w.Bytes(), &fromJSON)).To(Succeed())
+		Expect(fromJSON).To(Equal(p.yaml))
+	})
+
 	When("things go south", func() {
 
 		It("reports project marshalling failures", func() {
@@ -86,6 +349,15 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 				ContainSubstring("cannot write composer project")))
 		})
 
+		It("reports project JSON marshalling and saving failures", func() {
+			cp := &ComposerProject{yaml: map[string]any{"bonkers": make(chan int)}}
+			Expect(cp.SaveJSON(&bytes.Buffer{})).To(MatchError(
+				ContainSubstring("cannot JSONize composer project")))
+			cp = &ComposerProject{yaml: map[string]any{"services": "none"}}
+			Expect(cp.SaveJSON(&badWriter{})).To(MatchError(
+				ContainSubstring("cannot write composer project JSON")))
+		})
+
 		It("reports an error when key not found", func() {
 			Expect(lookupMap(map[string]any{}, "foo")).Error().To(HaveOccurred())
 		})
@@ -133,6 +405,17 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 			Expect(p.Images()).Error().To(HaveOccurred())
 		})
 
+		It("reports invalid services when qualifying image references", func() {
+			p := &ComposerProject{}
+			Expect(p.QualifyImages()).To(MatchError(ContainSubstring("no services found")))
+			for _, svc := range []any{42, map[string]any{}, map[string]any{"image": ":@"}} {
+				p := &ComposerProject{yaml: map[string]any{
+					"services": map[string]any{"foo": svc},
+				}}
+				Expect(p.QualifyImages()).To(MatchError(ContainSubstring(`service "foo"`)))
+			}
+		})
+
 		It("reports missing or incorrect service memory limit", func() {
 			GrabLog(logrus.InfoLevel)
 			p := &ComposerProject{yaml: map[string]any{
@@ -155,6 +438,39 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 			Expect(p.Images()).Error().To(MatchError(ContainSubstring("invalid mem_limit")))
 		})
 
+		It("reports all service problems at once", func() {
+			GrabLog(logrus.InfoLevel)
+			p := &ComposerProject{
+				yaml: map[string]any{
+					"services": map[string]any{
+						"foo": map[string]any{"image": "busybox:earliest"},
+						"bar": map[string]any{"image": "busybox:earliest", "mem_limit": "11ft8"},
+						"baz": map[string]any{"image": "busybox:latest", "mem_limit": "10mb"},
+						"qux": map[string]any{"image": ":@", "mem_limit": "10mb"},
+						"ok":  map[string]any{"image": "busybox:earliest", "mem_limit": "10mb"},
+					},
+				},
+				extraImages: []string{"alpine"},
+			}
+			err := p.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(strings.Split(err.Error(), "\n")).To(ConsistOf(
+				HavePrefix(`service "bar" has invalid mem_limit "11ft8"`),
+				Equal(`service "baz" attempts to use latest tag`),
+				Equal(`service "foo" lacks mem_limit declaration`),
+				HavePrefix(`service "qux" with invalid image reference ":@"`),
+				Equal(`x-tiap-extra-images image "alpine" has no explicit tag (implies :latest)`),
+			))
+
+			Expect((&ComposerProject{}).Validate()).To(MatchError(ContainSubstring("no services found")))
+			delete(p.yaml["services"].(map[string]any), "bar")
+			delete(p.yaml["services"].(map[string]any), "baz")
+			delete(p.yaml["services"].(map[string]any), "foo")
+			delete(p.yaml["services"].(map[string]any), "qux")
+			p.extraImages = nil
+			Expect(p.Validate()).To(Succeed())
+		})
+
 		It("reports reading problems", func() {
 			Expect(NewComposerProject("/")).Error().To(HaveOccurred())
 			Expect(NewComposerProject("composer_test.go")).Error().To(HaveOccurred())
@@ -163,3 +479,35 @@ var _ = Describe("IE app composer projects", Ordered, func() {
 	})
 
 })
+
+var _ = Describe("allowing latest images", func() {
+
+	project := func() *ComposerProject {
+		return testProject(map[string]map[string]any{
+			"foo": {"image": "busybox:latest", "mem_limit": "10mb"},
+			"bar": {"image": "busybox", "mem_limit": "10mb"},
+		})
+	}
+
+	It("rejects latest images by default", func() {
+		GrabLog(logrus.InfoLevel)
+		Expect(project().Images()).Error().To(MatchError(`service "bar" image "busybox" has no explicit tag (implies :latest)`))
+		Expect(project().Validate()).To(MatchError(ContainSubstring(`service "foo" attempts to use latest tag`)))
+	})
+
+	It("permits latest images with a warning", func() {
+		var logged bytes.Buffer
+		GrabLog(logrus.InfoLevel)
+		logrus.SetOutput(&logged)
+		p := project()
+		p.AllowLatest()
+		Expect(p.Images()).To(And(
+			HaveKeyWithValue("foo", "busybox:latest"),
+			HaveKeyWithValue("bar", "busybox"),
+		))
+		Expect(logged.String()).To(ContainSubstring("level=warning"))
+		Expect(logged.String()).To(ContainSubstring(`service \"foo\" attempts to use latest tag`))
+		Expect(logged.String()).To(ContainSubstring(`service \"bar\" image \"busybox\" has no explicit tag`))
+	})
+
+})
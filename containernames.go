@@ -0,0 +1,61 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// CheckContainerNames checks that no two services declare the same explicit
+// “container_name”, returning an error listing all conflicts found. As
+// container names must be unique per host, such duplicates would otherwise
+// only surface when deploying the app.
+func (p *ComposerProject) CheckContainerNames() error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	owners := map[string]string{} // container name -> first service using it
+	var conflicts []string
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		config, err := lookupMap(services, serviceName)
+		if err != nil {
+			return fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+		}
+		if _, ok := config["container_name"]; !ok {
+			continue
+		}
+		containerName, err := lookupString(config, "container_name")
+		if err != nil {
+			return fmt.Errorf("invalid container_name in service %q, reason: %w",
+				serviceName, err)
+		}
+		if owner, ok := owners[containerName]; ok {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"services %q and %q both use container_name %q",
+				owner, serviceName, containerName))
+			continue
+		}
+		owners[containerName] = serviceName
+	}
+	if len(conflicts) > 0 {
+		return errors.New(strings.Join(conflicts, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("container names", func() {
+
+	It("accepts unique container names", func() {
+		Expect(testProjectWith("container_name", map[string]any{
+			"foo": "foo",
+			"bar": "bar",
+			"baz": nil,
+			"qux": nil,
+		}).CheckContainerNames()).To(Succeed())
+		Expect(Successful(LoadComposerProject("testdata/app/hellorld")).CheckContainerNames()).
+			To(Succeed())
+	})
+
+	It("reports duplicate container names", func() {
+		Expect(testProjectWith("container_name", map[string]any{
+			"foo": "hellorld",
+			"bar": "hellorld",
+			"baz": "hellorld",
+			"qux": "qux",
+		}).CheckContainerNames()).To(MatchError(
+			`services "bar" and "baz" both use container_name "hellorld"; ` +
+				`services "bar" and "foo" both use container_name "hellorld"`))
+	})
+
+	It("reports invalid services and container names", func() {
+		Expect((&ComposerProject{}).CheckContainerNames()).Error().To(HaveOccurred())
+		Expect((&ComposerProject{yaml: map[string]any{
+			"services": map[string]any{"foo": 42},
+		}}).CheckContainerNames()).To(MatchError(ContainSubstring("invalid service")))
+		Expect(testProjectWith("container_name", map[string]any{"foo": 42}).CheckContainerNames()).To(
+			MatchError(ContainSubstring("invalid container_name")))
+	})
+
+	It("rejects duplicate container names when determining images", func() {
+		p := testProjectWith("container_name", map[string]any{"foo": "hellorld", "bar": "hellorld"})
+		for _, config := range p.yaml["services"].(map[string]any) {
+			config.(map[string]any)["image"] = "busybox:stable"
+			config.(map[string]any)["mem_limit"] = "10mb"
+		}
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("both use container_name")))
+	})
+
+})
@@ -0,0 +1,192 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of changes between app packages.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change describes an added, removed, or changed entry between two app
+// packages, such as a detail.json field, an image, or a service.
+type Change struct {
+	Name string `json:"name"`          // name of the changed entry
+	Kind string `json:"kind"`          // ChangeAdded, ChangeRemoved, or ChangeChanged
+	Old  any    `json:"old,omitempty"` // old value, unless added
+	New  any    `json:"new,omitempty"` // new value, unless removed
+}
+
+// PackageDiff lists the changes between two app packages, with the changes
+// in each category sorted by name.
+type PackageDiff struct {
+	Details  []Change `json:"details"`  // changed detail.json fields
+	Images   []Change `json:"images"`   // changed images, by their file digests
+	Services []Change `json:"services"` // changed compose services
+}
+
+// Empty returns true if there are no changes at all.
+func (d *PackageDiff) Empty() bool {
+	return len(d.Details) == 0 && len(d.Images) == 0 && len(d.Services) == 0
+}
+
+// appPackage is the information read from an app package for diffing.
+type appPackage struct {
+	details  map[string]any
+	images   map[string]any // image reference or file name -> file digest
+	services map[string]any
+}
+
+// DiffPackages compares the app package files at the specified paths,
+// returning the changes in detail.json fields, in the bundled images (by
+// their file digests), and in the compose services. DiffPackages works
+// solely on the package files, so it neither needs a Docker daemon nor
+// network access.
+func DiffPackages(oldPath string, newPath string) (*PackageDiff, error) {
+	oldPkg, err := readPackage(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newPkg, err := readPackage(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return &PackageDiff{
+		Details:  diffMaps(oldPkg.details, newPkg.details),
+		Images:   diffMaps(oldPkg.images, newPkg.images),
+		Services: diffMaps(oldPkg.services, newPkg.services),
+	}, nil
+}
+
+// diffMaps returns the changes between the old and new maps, sorted by key.
+func diffMaps(oldMap map[string]any, newMap map[string]any) []Change {
+	changes := []Change{}
+	keys := map[string]any{}
+	maps.Copy(keys, oldMap)
+	maps.Copy(keys, newMap)
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		oldValue, inOld := oldMap[key]
+		newValue, inNew := newMap[key]
+		switch {
+		case !inOld:
+			changes = append(changes, Change{Name: key, Kind: ChangeAdded, New: newValue})
+		case !inNew:
+			changes = append(changes, Change{Name: key, Kind: ChangeRemoved, Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, Change{Name: key, Kind: ChangeChanged, Old: oldValue, New: newValue})
+		}
+	}
+	return changes
+}
+
+// readPackage reads the details, image file digests, and compose services
+// from the app package file at the specified path.
+func readPackage(pkgPath string) (*appPackage, error) {
+	tarrer, err := openPackage(pkgPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read IE app package, reason: %w", err)
+	}
+	defer tarrer.Close()
+	var detailJSON, digestsJSON, composeYAML []byte
+	for {
+		header, err := tarrer.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read IE app package %q, reason: %w", pkgPath, err)
+		}
+		var contents *[]byte
+		switch {
+		case header.Name == DetailsFile:
+			contents = &detailJSON
+		case header.Name == "digests.json":
+			contents = &digestsJSON
+		case path.Base(header.Name) == "docker-compose.yml":
+			contents = &composeYAML
+		default:
+			continue
+		}
+		if *contents, err = io.ReadAll(tarrer); err != nil {
+			return nil, fmt.Errorf("cannot read IE app package %q, reason: %w", pkgPath, err)
+		}
+	}
+	if detailJSON == nil || digestsJSON == nil || composeYAML == nil {
+		return nil, fmt.Errorf("%q is not an IE app package: missing %s, digests.json, or docker-compose.yml",
+			pkgPath, DetailsFile)
+	}
+
+	pkg := &appPackage{images: map[string]any{}}
+	if err := json.Unmarshal(detailJSON, &pkg.details); err != nil {
+		return nil, fmt.Errorf("malformed %s in %q, reason: %w", DetailsFile, pkgPath, err)
+	}
+	var compose map[string]any
+	if err := yaml.Unmarshal(composeYAML, &compose); err != nil {
+		return nil, fmt.Errorf("malformed docker-compose.yml in %q, reason: %w", pkgPath, err)
+	}
+	pkg.services, err = lookupMap(compose, "services")
+	if err != nil {
+		return nil, fmt.Errorf("no services found in %q, reason: %w", pkgPath, err)
+	}
+	var digests struct {
+		Version string            `json:"version"`
+		Files   map[string]string `json:"files"`
+	}
+	if err := json.Unmarshal(digestsJSON, &digests); err != nil {
+		return nil, fmt.Errorf("malformed digests.json in %q, reason: %w", pkgPath, err)
+	}
+
+	// Image files are named after the SHA256 of their image references, so
+	// map the image files back to the image references used by services, as
+	// far as possible.
+	refs := map[string]string{}
+	for _, config := range pkg.services {
+		if config, ok := config.(map[string]any); ok {
+			if ref, err := lookupString(config, "image"); err == nil {
+				refs[imageFileID(ref)] = ref
+			}
+		}
+	}
+	for name, digest := range digests.Files {
+		dir, filename := path.Split(name)
+		id, ok := strings.CutSuffix(strings.TrimSuffix(filename, ".gz"), ".tar")
+		if path.Base(dir) != "images" || !ok {
+			continue
+		}
+		if digests.Version == "1" {
+			digest = "sha256:" + digest
+		}
+		if ref, ok := refs[id]; ok {
+			name = ref
+		}
+		pkg.images[name] = digest
+	}
+	return pkg, nil
+}
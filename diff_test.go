@@ -0,0 +1,129 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("diffing app packages", func() {
+
+	// build packages the test app template with the specified version,
+	// letting the specified function modify the stage before packaging.
+	build := func(version string, modify func(a *App)) string {
+		GinkgoHelper()
+		a := Successful(NewApp("testdata/app"))
+		defer a.Done()
+		Expect(a.SetDetails(version, "notes", "")).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(a.tmpDir, a.repo, "images"), 0777)).To(Succeed())
+		if modify != nil {
+			modify(a)
+		}
+		Expect(a.WriteCompose()).To(Succeed())
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out)).To(Succeed())
+		return out
+	}
+
+	// addImage adds a fake image file for the specified image reference.
+	addImage := func(a *App, ref string, contents string) {
+		GinkgoHelper()
+		Expect(os.WriteFile(filepath.Join(a.tmpDir, a.repo, "images", imageFilename(ref, false)),
+			[]byte(contents), 0666)).To(Succeed())
+	}
+
+	service := func(a *App, name string) map[string]any {
+		return a.project.yaml["services"].(map[string]any)[name].(map[string]any)
+	}
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("finds no differences between identical packages", func() {
+		pkg := build("1.0.0", func(a *App) { addImage(a, "busybox:stable", "busybox") })
+		diff := Successful(DiffPackages(pkg, pkg))
+		Expect(diff.Empty()).To(BeTrue())
+	})
+
+	It("diffs gzip'ed packages", func() {
+		pkg := build("1.0.0", func(a *App) { addImage(a, "busybox:stable", "busybox") })
+		a := Successful(NewApp("testdata/app"))
+		defer a.Done()
+		Expect(a.SetDetails("1.0.0", "notes", "")).To(Succeed())
+		Expect(a.WriteCompose()).To(Succeed())
+		gzPkg := filepath.Join(GinkgoT().TempDir(), "hellorld.app.gz")
+		Expect(a.Package(gzPkg, WithGzip())).To(Succeed())
+		diff := Successful(DiffPackages(pkg, gzPkg))
+		Expect(diff.Empty()).To(BeFalse())
+		Expect(Successful(DiffPackages(gzPkg, gzPkg)).Empty()).To(BeTrue())
+	})
+
+	It("reports added, removed, and changed entries", func() {
+		oldPkg := build("1.0.0", func(a *App) {
+			addImage(a, "busybox:stable", "busybox")
+			addImage(a, "example.org/orphan:1.0", "orphan")
+		})
+		newPkg := build("1.1.0", func(a *App) {
+			service(a, "hellorld")["mem_limit"] = "42mb"
+			service(a, "hellorld")["image"] = "busybox:1.36"
+			a.project.yaml["services"].(map[string]any)["sidekick"] = map[string]any{
+				"image": "alpine:3.18",
+			}
+			addImage(a, "busybox:1.36", "busybox 1.36")
+			addImage(a, "alpine:3.18", "alpine")
+		})
+		diff := Successful(DiffPackages(oldPkg, newPkg))
+		Expect(diff.Empty()).To(BeFalse())
+
+		Expect(diff.Details).To(ContainElement(And(
+			HaveField("Name", "versionNumber"),
+			HaveField("Kind", ChangeChanged),
+			HaveField("Old", "1.0.0"),
+			HaveField("New", "1.1.0"))))
+		Expect(diff.Details).NotTo(ContainElement(HaveField("Name", "title")))
+
+		Expect(diff.Images).To(ConsistOf(
+			And(HaveField("Name", "alpine:3.18"), HaveField("Kind", ChangeAdded),
+				HaveField("New", HavePrefix("sha256:"))),
+			And(HaveField("Name", "busybox:1.36"), HaveField("Kind", ChangeAdded)),
+			And(HaveField("Name", "busybox:stable"), HaveField("Kind", ChangeRemoved)),
+			And(HaveField("Name", HaveSuffix(imageFilename("example.org/orphan:1.0", false))),
+				HaveField("Kind", ChangeRemoved)),
+		))
+
+		Expect(diff.Services).To(ConsistOf(
+			And(HaveField("Name", "hellorld"), HaveField("Kind", ChangeChanged),
+				HaveField("New", HaveKeyWithValue("mem_limit", "42mb"))),
+			And(HaveField("Name", "sidekick"), HaveField("Kind", ChangeAdded)),
+		))
+	})
+
+	It("reports invalid packages", func() {
+		pkg := build("1.0.0", nil)
+		Expect(DiffPackages("testdata/nada-nothing-nil.app", pkg)).Error().To(
+			MatchError(ContainSubstring("cannot read IE app package")))
+		Expect(DiffPackages(pkg, "testdata/app/detail.json")).Error().To(
+			MatchError(ContainSubstring("cannot read IE app package")))
+	})
+
+})
@@ -15,13 +15,18 @@
 package tiap
 
 import (
+	"bufio"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
+	"slices"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -46,19 +51,11 @@ func fileDigests(rootfs fs.FS) (map[string]string, error) {
 		if dirEntry.IsDir() || path == "digests.json" { // ...safeguard
 			return nil
 		}
-		// Open file and calculate the SHA256 digest over its contents.
-		f, err := rootfs.Open(path)
+		digest, err := fileDigest(rootfs, path)
 		if err != nil {
-			return fmt.Errorf("cannot open %s, reason: %w", path, err)
-		}
-		defer f.Close()
-		digester := sha256.New()
-		if _, err := io.Copy(digester, f); err != nil {
-			return fmt.Errorf("cannot determine SHA256 for %s, reason: %w", path, err)
+			return err
 		}
-		digest := hex.EncodeToString(digester.Sum(nil))
 		digests[path] = digest
-		log.Info(fmt.Sprintf("      🧮  digest(ed) %s: %s", path, digest))
 		return nil
 	})
 	if err != nil {
@@ -67,6 +64,49 @@ func fileDigests(rootfs fs.FS) (map[string]string, error) {
 	return digests, nil
 }
 
+// fileDigest opens the specified file and calculates the SHA256 digest over
+// its contents, returning it as a hex string.
+func fileDigest(rootfs fs.FS, path string) (string, error) {
+	return fileDigestWith(rootfs, path, "sha256")
+}
+
+// fileDigestWith opens the specified file and calculates the digest using the
+// specified algorithm over its contents, returning it as a hex string.
+func fileDigestWith(rootfs fs.FS, path string, algorithm string) (string, error) {
+	newHash, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported digest algorithm %q for %s", algorithm, path)
+	}
+	f, err := rootfs.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open %s, reason: %w", path, err)
+	}
+	defer f.Close()
+	digester := newHash()
+	if _, err := io.Copy(digester, f); err != nil {
+		return "", fmt.Errorf("cannot determine %s for %s, reason: %w",
+			strings.ToUpper(algorithm), path, err)
+	}
+	digest := hex.EncodeToString(digester.Sum(nil))
+	log.Info(fmt.Sprintf("      🧮  digest(ed) %s: %s", path, digest))
+	return digest, nil
+}
+
+// digestAlgorithms maps the names of the supported digest algorithms to their
+// hash constructors.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// DigestAlgorithms optionally overrides the digest algorithm for specific
+// package files, mapping package-relative, slash-separated paths to the names
+// of digest algorithms, that is, “sha256”, “sha384”, or “sha512”. If
+// non-empty, Package writes a “digests.json” mixing digest algorithms, see
+// WriteMixedDigests. Otherwise, all files are uniformly digested using SHA256.
+var DigestAlgorithms map[string]string
+
 // WriteDigests determines the file digests inside the “root” directory and its
 // sub directories and then writes the results to the specified io.Writer in
 // “digests.json” format.
@@ -74,11 +114,75 @@ func WriteDigests(w io.Writer, root string) error {
 	return writeDigests(w, os.DirFS(root))
 }
 
+// WriteMixedDigests works like WriteDigests, but digests the files listed in
+// the specified algorithms map using the specified digest algorithms instead
+// of SHA256. As the resulting “digests.json” mixes digest algorithms, it uses
+// version “2” of the format where each digest carries its algorithm as a
+// prefix, such as “sha512:...”. For an empty algorithms map, WriteMixedDigests
+// writes the same uniform SHA256 version “1” format as WriteDigests.
+func WriteMixedDigests(w io.Writer, root string, algorithms map[string]string) error {
+	return writeMixedDigests(w, os.DirFS(root), algorithms)
+}
+
+func writeMixedDigests(w io.Writer, rootfs fs.FS, algorithms map[string]string) error {
+	if len(algorithms) == 0 {
+		return writeDigests(w, rootfs)
+	}
+	for path, algorithm := range algorithms {
+		if _, ok := digestAlgorithms[algorithm]; !ok {
+			return fmt.Errorf("unsupported digest algorithm %q for %s", algorithm, path)
+		}
+		if _, err := fs.Stat(rootfs, path); err != nil {
+			return fmt.Errorf("cannot override digest algorithm for %s, reason: %w", path, err)
+		}
+	}
+	log.Info("   🧮  determining package files digests...")
+	digests := map[string]string{}
+	err := fs.WalkDir(rootfs, ".", func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() || path == "digests.json" { // ...safeguard
+			return nil
+		}
+		algorithm, ok := algorithms[path]
+		if !ok {
+			algorithm = "sha256"
+		}
+		digest, err := fileDigestWith(rootfs, path, algorithm)
+		if err != nil {
+			return err
+		}
+		digests[path] = algorithm + ":" + digest
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(struct {
+		Version string            `json:"version"`
+		Files   map[string]string `json:"files"`
+	}{
+		Version: "2",
+		Files:   digests,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot generate digests JSON, reason: %w", err)
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		return fmt.Errorf("cannot write digests JSON, reason: %w", err)
+	}
+	return nil
+}
+
 func writeDigests(w io.Writer, rootfs fs.FS) error {
 	digests, err := fileDigests(rootfs)
 	if err != nil {
 		return err
 	}
+	// As encoding/json marshals maps with their keys sorted, the file digests
+	// are always written in the same order.
 	b, err := json.Marshal(struct {
 		Version string            `json:"version"`
 		Files   map[string]string `json:"files"`
@@ -95,3 +199,98 @@ func writeDigests(w io.Writer, rootfs fs.FS) error {
 	}
 	return nil
 }
+
+// StreamDigests determines the file digests inside the “root” directory and
+// its sub directories and writes them incrementally to the specified
+// io.Writer in “digests.json” format, while determining them. Contrary to
+// WriteDigests, StreamDigests thus doesn't need to keep all file digests in
+// memory, but it might leave partial output in case of errors. The output is
+// byte-for-byte the same as the output of WriteDigests.
+func StreamDigests(w io.Writer, root string) error {
+	return streamDigests(w, os.DirFS(root), fileDigest)
+}
+
+// streamDigests streams the file digests, using the specified digest function
+// to determine the individual file digests.
+func streamDigests(
+	w io.Writer,
+	rootfs fs.FS,
+	digester func(rootfs fs.FS, path string) (string, error),
+) error {
+	log.Info("   🧮  streaming package files SHA256 digests...")
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(`{"version":"1","files":{`)
+	first := true
+	err := walkSorted(rootfs, ".", func(path string) error {
+		if path == "digests.json" { // ...safeguard
+			return nil
+		}
+		digest, err := digester(rootfs, path)
+		if err != nil {
+			return err
+		}
+		// Use encoding/json for the path, so that escaping is exactly the
+		// same as when marshalling the whole map in one go.
+		key, err := json.Marshal(path)
+		if err != nil {
+			return fmt.Errorf("cannot generate digests JSON, reason: %w", err)
+		}
+		if !first {
+			_ = bw.WriteByte(',')
+		}
+		first = false
+		_, _ = bw.Write(key)
+		_, err = bw.WriteString(`:"` + digest + `"`)
+		if err != nil {
+			return fmt.Errorf("cannot write digests JSON, reason: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = bw.WriteString("}}")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot write digests JSON, reason: %w", err)
+	}
+	return nil
+}
+
+// walkSorted walks the file tree rooted at “dir”, calling fn for each
+// non-directory with its path. Contrary to fs.WalkDir, walkSorted visits the
+// paths in the same (byte-wise) order as sorting all paths would result in,
+// which is the order encoding/json marshals map keys in. For instance, it
+// visits “a.txt” before “a/b”, as “.” sorts before “/”.
+func walkSorted(rootfs fs.FS, dir string, fn func(path string) error) error {
+	entries, err := fs.ReadDir(rootfs, dir)
+	if err != nil {
+		return err
+	}
+	// As all paths below a directory share the directory name followed by a
+	// slash, sorting directory names with a trailing slash against file names
+	// gives the overall path order.
+	key := func(entry fs.DirEntry) string {
+		if entry.IsDir() {
+			return entry.Name() + "/"
+		}
+		return entry.Name()
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(key(a), key(b))
+	})
+	for _, entry := range entries {
+		path := entry.Name()
+		if dir != "." {
+			path = dir + "/" + path
+		}
+		if entry.IsDir() {
+			err = walkSorted(rootfs, path, fn)
+		} else {
+			err = fn(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
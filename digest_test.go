@@ -17,6 +17,7 @@ package tiap
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -52,8 +53,57 @@ var _ = Describe("digesting digests", Ordered, func() {
 }`))
 	})
 
+	It("streams the same digests.json content", func() {
+		root := GinkgoT().TempDir()
+		for _, path := range []string{
+			"a.txt", "a/b", "a/c/d", "a-b", "a0", "<html>&.txt", "ä/ö", "Z", "digests.json",
+		} {
+			path = filepath.Join(root, path)
+			Expect(os.MkdirAll(filepath.Dir(path), 0777)).To(Succeed())
+			Expect(os.WriteFile(path, []byte(path), 0666)).To(Succeed())
+		}
+		for _, root := range []string{"testdata/digests", root} {
+			batch := &bytes.Buffer{}
+			Expect(WriteDigests(batch, root)).To(Succeed())
+			stream := &bytes.Buffer{}
+			Expect(StreamDigests(stream, root)).To(Succeed())
+			Expect(stream.String()).To(Equal(batch.String()))
+		}
+	})
+
+	It("generates digests.json content mixing digest algorithms", func() {
+		w := &bytes.Buffer{}
+		Expect(WriteMixedDigests(w, "testdata/digests", map[string]string{
+			"deetail.json": "sha512",
+		})).To(Succeed())
+		Expect(w.String()).To(MatchJSON(`{
+	"version": "2",
+	"files": {
+		"hellorld/appicon.png": "sha256:e9cccf6536b48527a473cdd88569642cb37759c2611959d838ca1eb1be2db297",
+		"deetail.json": "sha512:e491568669b1e8b9ae2cee872b2c236f242580d8e21896d7c840dd7a92e0df00a646da4c2ac873a6969721642950be863d6d7514c07b8dabea2c4fffce01c48d"
+	}
+}`))
+
+		uniform := &bytes.Buffer{}
+		Expect(WriteDigests(uniform, "testdata/digests")).To(Succeed())
+		w.Reset()
+		Expect(WriteMixedDigests(w, "testdata/digests", nil)).To(Succeed())
+		Expect(w.String()).To(Equal(uniform.String()))
+	})
+
 	When("things go south", func() {
 
+		It("rejects invalid digest algorithm overrides", func() {
+			Expect(WriteMixedDigests(&bytes.Buffer{}, "testdata/digests", map[string]string{
+				"deetail.json": "md5",
+			})).To(MatchError(`unsupported digest algorithm "md5" for deetail.json`))
+			Expect(WriteMixedDigests(&bytes.Buffer{}, "testdata/digests", map[string]string{
+				"nada.json": "sha512",
+			})).To(MatchError(ContainSubstring("cannot override digest algorithm for nada.json")))
+			Expect(fileDigestWith(os.DirFS("testdata/digests"), "deetail.json", "md5")).Error().
+				To(HaveOccurred())
+		})
+
 		It("reports when files cannot be opened", func() {
 			badfs := &badFS{
 				FS:   os.DirFS("testdata/digests"),
@@ -87,6 +137,18 @@ var _ = Describe("digesting digests", Ordered, func() {
 				MatchError(ContainSubstring("cannot write digests")))
 		})
 
+		It("reports streaming errors", func() {
+			Expect(StreamDigests(&badWriter{}, "testdata/digests")).To(
+				MatchError(ContainSubstring("cannot write digests")))
+			for _, fail := range []fsFailureMode{fsFailOpen, fsFailOpenDir} {
+				badfs := &badFS{
+					FS:   os.DirFS("testdata/digests"),
+					fail: fail,
+				}
+				Expect(streamDigests(&bytes.Buffer{}, badfs, fileDigest)).NotTo(Succeed())
+			}
+		})
+
 		It("doesn't write digests when failing to calculate them", func() {
 			badfs := &badFS{
 				FS:   os.DirFS("testdata/digests"),
@@ -0,0 +1,142 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// minCachedDigestSize is the minimum size of files whose digests get
+// precomputed and cached. Smaller files, such as “detail.json” and the
+// composer project file, get rehashed when packaging, as this costs next to
+// nothing. In particular, these are the files tiap rewrites while staging, and
+// on file systems with coarse modification times a rewritten file of the same
+// size would otherwise look unchanged.
+const minCachedDigestSize = 64 * 1024
+
+// cachedDigest is a file digest together with the file information at the time
+// of digesting, so that stale digests of files modified or replaced later can
+// be detected.
+type cachedDigest struct {
+	info   fs.FileInfo
+	digest string
+}
+
+// digestCache caches file digests determined ahead of packaging.
+type digestCache struct {
+	mu      sync.Mutex
+	digests map[string]cachedDigest
+}
+
+// lookup returns the cached digest of the file at the specified path, if the
+// file is still the same file, with the same size and modification time, as
+// when digesting it. Small files never use cached digests, see
+// minCachedDigestSize.
+func (c *digestCache) lookup(path string, info fs.FileInfo) (string, bool) {
+	if info.Size() < minCachedDigestSize {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.digests[path]
+	if !ok ||
+		!os.SameFile(cached.info, info) ||
+		cached.info.Size() != info.Size() ||
+		!cached.info.ModTime().Equal(info.ModTime()) {
+		return "", false
+	}
+	return cached.digest, true
+}
+
+// store caches the digest of the file at the specified path, with the file
+// information taken before digesting the file.
+func (c *digestCache) store(path string, info fs.FileInfo, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.digests[path] = cachedDigest{
+		info:   info,
+		digest: digest,
+	}
+}
+
+// PrecomputeDigests determines the digests of the files already in the
+// stage, except for the container images and small files, so that Package
+// later only needs to digest the files added or changed in the meantime.
+// PrecomputeDigests is safe to be run concurrently with PullAndWriteCompose,
+// in order to pipeline digesting the template files with pulling the images.
+// It must not be run concurrently with Package.
+func (a *App) PrecomputeDigests() error {
+	log.Info("   🧮  precomputing stage files SHA256 digests...")
+	cache := &digestCache{digests: map[string]cachedDigest{}}
+	a.digests = cache
+	rootfs := os.DirFS(a.tmpDir)
+	imagesDir := filepath.ToSlash(filepath.Join(a.repo, "images"))
+	err := fs.WalkDir(rootfs, ".", func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			if path == imagesDir {
+				return fs.SkipDir // ...images are still being pulled.
+			}
+			return nil
+		}
+		if path == "digests.json" {
+			return nil
+		}
+		// Take the file information before digesting, so any modification
+		// while digesting renders the cached digest stale.
+		info, err := fs.Stat(rootfs, path)
+		if err != nil {
+			return err
+		}
+		if info.Size() < minCachedDigestSize {
+			return nil
+		}
+		digest, err := fileDigest(rootfs, path)
+		if err != nil {
+			return err
+		}
+		cache.store(path, info, digest)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot precompute digests, reason: %w", err)
+	}
+	return nil
+}
+
+// fileDigest returns the digest of the file at the specified path in the
+// stage, reusing a precomputed digest if the file hasn't changed since.
+func (a *App) fileDigest(rootfs fs.FS, path string) (string, error) {
+	if a.digests == nil {
+		return fileDigest(rootfs, path)
+	}
+	info, err := fs.Stat(rootfs, path)
+	if err != nil {
+		return "", fmt.Errorf("cannot stat %s, reason: %w", path, err)
+	}
+	if digest, ok := a.digests.lookup(path, info); ok {
+		log.Info(fmt.Sprintf("      🧮  digest(ed) %s: %s (precomputed)", path, digest))
+		return digest, nil
+	}
+	return fileDigest(rootfs, path)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("precomputed digests", func() {
+
+	// packagedDigests returns the digests.json from the specified package.
+	packagedDigests := func(out string) string {
+		GinkgoHelper()
+		f := Successful(os.Open(out))
+		defer f.Close()
+		tr := tar.NewReader(f)
+		for {
+			header := Successful(tr.Next())
+			if header.Name == "digests.json" {
+				return string(Successful(io.ReadAll(tr)))
+			}
+		}
+	}
+
+	// newApp returns a new app with a large file in its stage, so that its
+	// digest gets precomputed.
+	const largeFile = "hellorld/large.bin"
+	newApp := func() *App {
+		GinkgoHelper()
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(os.WriteFile(filepath.Join(a.tmpDir, largeFile),
+			bytes.Repeat([]byte("tiap"), minCachedDigestSize), 0666)).To(Succeed())
+		return a
+	}
+
+	It("packages the same digests as without precomputing", func() {
+		GrabLog(logrus.InfoLevel)
+		a := newApp()
+		Expect(a.SetDetails("1.2.3", "notes", "")).To(Succeed())
+
+		Expect(a.PrecomputeDigests()).To(Succeed())
+		Expect(a.digests.digests).To(HaveKey(largeFile))
+		Expect(a.digests.digests).NotTo(HaveKey("detail.json"))
+
+		// Simulate pulling images and later modifications to the stage, which
+		// must not use stale precomputed digests.
+		imagesDir := filepath.Join(a.tmpDir, a.repo, "images")
+		Expect(os.MkdirAll(imagesDir, 0777)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(imagesDir, "image.tar"), []byte("image"), 0666)).
+			To(Succeed())
+		Expect(a.WriteCompose()).To(Succeed())
+		Expect(a.SetDetails("1.2.3", "other notes, other length", "")).To(Succeed())
+
+		sequential := &bytes.Buffer{}
+		Expect(StreamDigests(sequential, a.tmpDir)).To(Succeed())
+
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out)).To(Succeed())
+		Expect(packagedDigests(out)).To(Equal(sequential.String()))
+	})
+
+	It("ignores stale precomputed digests", func() {
+		GrabLog(logrus.InfoLevel)
+		a := newApp()
+		Expect(a.PrecomputeDigests()).To(Succeed())
+
+		path := largeFile
+		stale := func() {
+			cached := a.digests.digests[path]
+			cached.digest = "stale"
+			a.digests.digests[path] = cached
+		}
+		stale()
+		rootfs := os.DirFS(a.tmpDir)
+		Expect(a.fileDigest(rootfs, path)).To(Equal("stale"))
+
+		Expect(os.WriteFile(filepath.Join(a.tmpDir, path),
+			bytes.Repeat([]byte("TIAP"), minCachedDigestSize), 0666)).To(Succeed())
+		Expect(a.fileDigest(rootfs, path)).To(Equal(Successful(fileDigest(rootfs, path))))
+
+		// A file replaced by another one of the same size and modification
+		// time, such as on file systems with coarse time stamps, is stale
+		// too.
+		Expect(a.PrecomputeDigests()).To(Succeed())
+		stale()
+		fullpath := filepath.Join(a.tmpDir, path)
+		info := Successful(os.Stat(fullpath))
+		Expect(os.WriteFile(fullpath+".new", Successful(os.ReadFile(fullpath)), 0666)).To(Succeed())
+		Expect(os.Chtimes(fullpath+".new", info.ModTime(), info.ModTime())).To(Succeed())
+		Expect(os.Rename(fullpath+".new", fullpath)).To(Succeed())
+		Expect(a.fileDigest(rootfs, path)).NotTo(Equal("stale"))
+	})
+
+	It("always rehashes small files", func() {
+		GrabLog(logrus.InfoLevel)
+		a := newApp()
+		Expect(a.PrecomputeDigests()).To(Succeed())
+		a.digests.digests[DetailsFile] = cachedDigest{
+			info:   Successful(os.Stat(filepath.Join(a.tmpDir, DetailsFile))),
+			digest: "stale",
+		}
+		rootfs := os.DirFS(a.tmpDir)
+		Expect(a.fileDigest(rootfs, DetailsFile)).To(Equal(Successful(fileDigest(rootfs, DetailsFile))))
+	})
+
+})
@@ -19,11 +19,14 @@ follows:
   - $REPO/nginx/nginx.json
 
 Here, $REPO is an almost arbitrary directory name (except for “images”) that is
-considered to be the app's “repository” name.
+considered to be the app's “repository” name. The Docker composer project file
+must be placed inside $REPO; tiap rejects templates with a composer project
+file in the template root.
 
 Please note that tiap doesn't lint the Docker composer project, except for:
-  - rejecting “:latest” image references (yes, we're more strict than IE App
-    Publisher here for a reason),
-  - enforcing “mem_limit” service configuration.
+  - rejecting “:latest” and untagged image references (yes, we're more
+    strict than IE App Publisher here for a reason),
+  - enforcing “mem_limit” service configuration, unless disabled using a
+    top-level “x-tiap: {require-mem-limit: false}” extension.
 */
 package tiap
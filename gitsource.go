@@ -0,0 +1,177 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GitSource references an app template inside a git repository.
+type GitSource struct {
+	URL     string // git repository URL
+	Ref     string // branch, tag, or commit; empty for the default branch
+	Subdir  string // template directory inside the repository; empty for root
+	History bool   // clone the full history with all tags, such as for “git describe”
+}
+
+// gitSchemes lists the URL schemes we accept for git sources. Please note that
+// we deliberately don't accept the “file” and “ext” transports.
+var gitSchemes = []string{"https", "http", "git", "ssh"}
+
+// gitRefRegexp matches acceptable branch, tag, and commit names; it is
+// stricter than git itself in order to keep things sane.
+var gitRefRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/-]*$`)
+
+// ParseGitSource parses the specified template source argument in the form of
+// “URL[#REF[:SUBDIR]]”, where URL must use one of the “https”, “http”, “git”,
+// or “ssh” schemes. If the source argument isn't a URL with one of these
+// schemes, ParseGitSource returns a nil GitSource and a nil error, so the
+// source argument can be taken as a local path instead. Otherwise, it returns
+// the git source or an error if the URL, ref or subdirectory are invalid.
+func ParseGitSource(source string) (*GitSource, error) {
+	scheme, _, ok := strings.Cut(source, "://")
+	if !ok || !slices.Contains(gitSchemes, strings.ToLower(scheme)) {
+		return nil, nil
+	}
+	if strings.IndexFunc(source, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0 {
+		return nil, errors.New("invalid git source URL: contains whitespace or control characters")
+	}
+	repoURL, fragment, _ := strings.Cut(source, "#")
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git source URL, reason: %w", err)
+	}
+	if u.Host == "" || strings.HasPrefix(u.Host, "-") {
+		return nil, fmt.Errorf("invalid git source URL %q: missing or invalid host", u.Redacted())
+	}
+	g := &GitSource{URL: u.String()}
+	g.Ref, g.Subdir, _ = strings.Cut(fragment, ":")
+	if g.Ref != "" && (!gitRefRegexp.MatchString(g.Ref) || strings.Contains(g.Ref, "..")) {
+		return nil, fmt.Errorf("invalid git source ref %q", g.Ref)
+	}
+	if g.Subdir != "" {
+		subdir := path.Clean(g.Subdir)
+		if path.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return nil, fmt.Errorf("invalid git source subdirectory %q", g.Subdir)
+		}
+		if subdir == "." {
+			subdir = ""
+		}
+		g.Subdir = subdir
+	}
+	return g, nil
+}
+
+// Clone shallow-clones the git source into a new temporary directory and
+// returns the path to the clone. The caller is responsible for removing the
+// clone directory when done with it. If the ref is a tag, it is fetched as a
+// tag, so that “git describe” works in the clone. If History is set, Clone
+// instead fetches the full history of the ref together with all tags, so
+// that “git describe” also works for branches and commits, and release notes
+// can be generated from the commits since the previous tag.
+func (g *GitSource) Clone(ctx context.Context) (_ string, err error) {
+	dir, err := os.MkdirTemp("", "tiap-git-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot create temporary git clone directory, reason: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	log.Info(fmt.Sprintf("🐙  cloning %s into %q", g.redacted(), dir))
+	if err := git(ctx, dir, "init", "--quiet"); err != nil {
+		return "", err
+	}
+	if err := git(ctx, dir, "remote", "add", "origin", "--", g.URL); err != nil {
+		return "", err
+	}
+	ref := g.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	fetch := []string{"fetch", "--quiet", "--depth", "1"}
+	if g.History {
+		fetch = []string{"fetch", "--quiet", "--tags"}
+	}
+	// Try to fetch the ref as a tag first, falling back to fetching it as
+	// whatever it is, such as a branch or commit.
+	checkout := "refs/tags/" + ref
+	if tagErr := git(ctx, dir, append(fetch, "origin", checkout+":"+checkout)...); tagErr != nil {
+		if err := git(ctx, dir, append(fetch, "origin", ref)...); err != nil {
+			return "", fmt.Errorf("cannot fetch %q as tag, branch, or commit, reason: %w",
+				ref, errors.Join(tagErr, err))
+		}
+		checkout = "FETCH_HEAD"
+	}
+	if err := git(ctx, dir, "checkout", "--quiet", checkout); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// redacted returns the git source in textual form with any password in the
+// URL redacted.
+func (g *GitSource) redacted() string {
+	s := g.URL
+	if u, err := url.Parse(g.URL); err == nil {
+		s = u.Redacted()
+	}
+	if g.Ref != "" {
+		s += "#" + g.Ref
+	}
+	if g.Subdir != "" {
+		s += ":" + g.Subdir
+	}
+	return s
+}
+
+// GitEnvVar names the environment variable optionally specifying the git
+// binary to use, for unusual environments where git isn't in the PATH.
+const GitEnvVar = "TIAP_GIT"
+
+// GitBinary returns the git binary to use, as specified by the GitEnvVar
+// environment variable, defaulting to “git”.
+func GitBinary() string {
+	if bin := os.Getenv(GitEnvVar); bin != "" {
+		return bin
+	}
+	return "git"
+}
+
+// git runs the git command with the specified args in the specified working
+// directory, never prompting for credentials.
+func git(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, GitBinary(), args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s failed: %s, reason: %w",
+			args[0], strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
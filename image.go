@@ -15,6 +15,7 @@
 package tiap
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -47,72 +48,195 @@ var DefaultRegistry = name.DefaultRegistry
 // daemon is only made when a non-nil client has been passed in. Otherwise,
 // always a pull is attempted only.
 //
+// Pulling authenticates using any explicit credentials passed using WithAuth
+// or WithBasicAuth, falling back to the default keychain. All requests to
+// remote registries are paced by the shared RegistryLimiter, if set.
+//
+// Pass WithProgress in order to receive the progress of pulling and saving the
+// image, and WithCompression in order to save a gzip-compressed image
+// tar-ball.
+//
 // [go-containerregistry]: https://github.com/google/go-containerregistry
 func SaveImageToFile(ctx context.Context,
 	imageref string,
 	platform string,
 	savedir string,
 	optclient daemon.Client,
+	opts ...PullOption,
 ) (filename string, err error) {
+	filename, _, _, err = saveImageToFile(ctx, imageref, platform, savedir, optclient, pullOptions(opts))
+	return
+}
+
+// saveImageToFile works like SaveImageToFile, but additionally returns the
+// saved image, as well as the digest the image reference resolved to in its
+// registry when pulling it. As images taken from the local daemon don't come
+// with their registry digest, the digest then is empty.
+func saveImageToFile(ctx context.Context,
+	imageref string,
+	platform string,
+	savedir string,
+	optclient daemon.Client,
+	options PullOptions,
+) (filename string, image ociv1.Image, digest string, err error) {
 	log.Debugf("🐛 pulling and saving image %s to file...", imageref)
+	began := time.Now()
+	options.Progress.report(imageref, PullStarted, 0, began)
 	imgRef, err := name.ParseReference(
 		imageref, name.WithDefaultRegistry(DefaultRegistry))
 	if err != nil {
-		return "", fmt.Errorf("invalid image reference %q: %w",
+		return "", nil, "", fmt.Errorf("invalid image reference %q: %w",
 			imageref, err)
 	}
 
 	wantPlatform, err := ociv1.ParsePlatform(platform)
 	if err != nil {
-		return "", fmt.Errorf("invalid platform %q: %w",
+		return "", nil, "", fmt.Errorf("invalid platform %q: %w",
 			platform, err)
 	}
 	log.Debugf("🐛 wanted platform: %s", wantPlatform)
 
-	image, err := hasLocalImage(ctx, optclient, imgRef, wantPlatform)
+	image, err = hasLocalImage(ctx, optclient, imgRef, wantPlatform)
 	if err != nil {
-		return "", err
+		return "", nil, "", err
 	}
 	if image == nil {
-		image, err = pullRemoteImage(ctx, imgRef, wantPlatform)
+		image, digest, err = pullRemoteImage(ctx, imgRef, wantPlatform, options)
 		if err != nil {
-			return "", err
+			return "", nil, "", err
 		}
 	}
 
-	// The image save filename is the SHA256 of the imageref(!).
-	digester := sha256.New()
-	_, _ = digester.Write([]byte(imageref))
-	filename = hex.EncodeToString(digester.Sum(nil)) + ".tar"
+	filename = imageFilename(imageref, options.Compress)
 
 	// Write (rather, transfer) the container image data into the file system
-	// path we were told.
+	// path we were told. In order to never leave behind incompletely written
+	// image files under their final name, we first write into a “.partial”
+	// file and only rename it after successful completion.
 	imageSavePathName := filepath.Join(savedir, filename)
-	f, err := os.Create(imageSavePathName)
+	partialPathName := imageSavePathName + ".partial"
+	f, err := os.Create(partialPathName)
 	if err != nil {
-		return "", fmt.Errorf("cannot create image file %q, reason: %w",
+		return "", nil, "", fmt.Errorf("cannot create image file %q, reason: %w",
 			imageSavePathName, err)
 	}
-	defer f.Close()
+	defer func() {
+		f.Close()
+		if err != nil {
+			_ = os.Remove(partialPathName)
+		}
+	}()
 	log.Debugf("🐛 writing image %s to tar-ball...", imageref)
 	start := time.Now()
 	//	if err := legacytarball.Write(imgRef, image, f); err != nil {
-	if err := tarball.Write(imgRef, image, f); err != nil {
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if options.Compress {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	pw := &progressWriter{
+		w:        w,
+		ref:      imageref,
+		progress: options.Progress,
+		start:    began,
+		last:     time.Now(),
+	}
+	if err := tarball.Write(imgRef, image, pw); err != nil {
 		log.Debugf("❌❌❌ writing image to tar-ball failed")
-		return "", fmt.Errorf("cannot write image file %q, reason: %w",
+		return "", nil, "", fmt.Errorf("cannot write image file %q, reason: %w",
 			imageSavePathName, err)
 	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return "", nil, "", fmt.Errorf("cannot write image file %q, reason: %w",
+				imageSavePathName, err)
+		}
+	}
 	totalWritten, err := f.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return "", fmt.Errorf("cannot determine length of written image file %q, reason: %w",
+		return "", nil, "", fmt.Errorf("cannot determine length of written image file %q, reason: %w",
+			imageSavePathName, err)
+	}
+	if err = f.Close(); err != nil {
+		return "", nil, "", fmt.Errorf("cannot write image file %q, reason: %w",
+			imageSavePathName, err)
+	}
+	if err = os.Rename(partialPathName, imageSavePathName); err != nil {
+		return "", nil, "", fmt.Errorf("cannot finalize image file %q, reason: %w",
 			imageSavePathName, err)
 	}
 	duration := time.Duration(math.Ceil(time.Since(start).Seconds())) * time.Second
 	log.Infof("   🖭  written %d bytes of 🖼  image with ID %s in %s",
 		totalWritten, filename[:12], duration)
+	options.Progress.report(imageref, PullSaved, totalWritten, began)
 	return
 }
 
+// imageFilename returns the name of the image file for the specified image
+// reference: the image save filename is the SHA256 of the imageref(!), with a
+// “.tar.gz” extension for compressed image tar-balls, and “.tar” otherwise.
+func imageFilename(imageref string, compressed bool) string {
+	if compressed {
+		return imageFileID(imageref) + ".tar.gz"
+	}
+	return imageFileID(imageref) + ".tar"
+}
+
+// imageFileID returns the name of the image file for the specified image
+// reference without any extension.
+func imageFileID(imageref string) string {
+	digester := sha256.New()
+	_, _ = digester.Write([]byte(imageref))
+	return hex.EncodeToString(digester.Sum(nil))
+}
+
+// imageFromPath returns the image from the image tar-ball at the specified
+// path, transparently decompressing gzip-compressed image tar-balls.
+func imageFromPath(path string) (ociv1.Image, error) {
+	return tarball.Image(func() (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, _, err := decompressed(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}, nil)
+}
+
+// savedImage returns the image from the image file for the referenced image
+// if it already exists in the specified directory “savedir”, either compressed
+// or uncompressed as specified, can be read as an image tar-ball, and the image
+// satisfies the specified platform. Otherwise, it returns nil.
+func savedImage(imageref string, platform string, savedir string, compressed bool) ociv1.Image {
+	wantPlatform, err := ociv1.ParsePlatform(platform)
+	if err != nil {
+		return nil
+	}
+	image, err := imageFromPath(filepath.Join(savedir, imageFilename(imageref, compressed)))
+	if err != nil {
+		return nil
+	}
+	config, err := image.ConfigFile()
+	if err != nil {
+		return nil
+	}
+	if _, err := image.Manifest(); err != nil {
+		return nil
+	}
+	if hasPf := config.Platform(); hasPf == nil || !hasPf.Satisfies(*wantPlatform) {
+		return nil
+	}
+	return image
+}
+
 // hasLocalImage returns the referenced image for the specified platform, if
 // available locally and using the specified daemon client. Otherwise, it
 // returns a nil image and nil error if nothing was found. hasLocalImage also
@@ -157,18 +281,47 @@ func hasLocalImage(
 }
 
 // pullRemoteImage pull the specified image for the specified platform from a
-// (remote) registry.
+// (remote) registry, returning the image as well as the digest the image
+// reference resolved to. For multi-platform images, this is the digest of the
+// image index, not of the platform-specific image manifest.
 func pullRemoteImage(
 	ctx context.Context,
 	imageref name.Reference,
 	wantPlatform *ociv1.Platform,
-) (ociv1.Image, error) {
-	image, err := remote.Image(imageref,
+	options PullOptions,
+) (ociv1.Image, string, error) {
+	desc, err := remote.Get(imageref,
 		remote.WithContext(ctx),
-		remote.WithPlatform(*wantPlatform))
+		remote.WithPlatform(*wantPlatform),
+		options.registryAuth(),
+		registryTransport())
 	if err != nil {
-		return nil, fmt.Errorf("cannot pull image %s, reason: %w",
+		return nil, "", fmt.Errorf("cannot pull image %s, reason: %w",
 			imageref.String(), err)
 	}
-	return image, nil
+	image, err := desc.Image()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot pull image %s, reason: %w",
+			imageref.String(), err)
+	}
+	return image, desc.Digest.String(), nil
+}
+
+// registryDigest returns the digest the specified image reference currently
+// resolves to in its registry, that is, the digest of the image manifest or
+// index. For image references already specifying a digest, registryDigest
+// returns this digest without contacting the registry.
+func registryDigest(ctx context.Context, imageref name.Reference, options PullOptions) (string, error) {
+	if digest, ok := imageref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+	desc, err := remote.Head(imageref,
+		remote.WithContext(ctx),
+		options.registryAuth(),
+		registryTransport())
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve digest of image %s, reason: %w",
+			imageref.String(), err)
+	}
+	return desc.Digest.String(), nil
 }
@@ -15,18 +15,30 @@
 package tiap
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
+	"log"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/docker/docker/api/types/image"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/moby/moby/client"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -183,3 +195,202 @@ var _ = Describe("image pulling and saving", Ordered, func() {
 	})
 
 })
+
+var _ = Describe("saved images", func() {
+
+	const imageref = "example.org/foo/bar:baz"
+
+	var tmpDirPath string
+
+	BeforeEach(func() {
+		tmpDirPath = Successful(os.MkdirTemp("", "tiap-test-*"))
+		DeferCleanup(func() { os.RemoveAll(tmpDirPath) })
+	})
+
+	saveRandomImage := func(imageref string, platform string) {
+		GinkgoHelper()
+		pf := Successful(ociv1.ParsePlatform(platform))
+		img := Successful(random.Image(1024, 1))
+		config := Successful(img.ConfigFile())
+		config.OS = pf.OS
+		config.Architecture = pf.Architecture
+		img = Successful(mutate.ConfigFile(img, config))
+		Expect(tarball.WriteToFile(filepath.Join(tmpDirPath, imageFilename(imageref, false)),
+			Successful(name.ParseReference(imageref)), img)).To(Succeed())
+	}
+
+	It("doesn't find missing or broken images", func() {
+		Expect(savedImage(imageref, "linux/amd64", tmpDirPath, false)).To(BeNil())
+		Expect(os.WriteFile(filepath.Join(tmpDirPath, imageFilename(imageref, false)),
+			[]byte("garbage"), 0666)).To(Succeed())
+		Expect(savedImage(imageref, "linux/amd64", tmpDirPath, false)).To(BeNil())
+	})
+
+	It("finds saved images only for the correct platform", func() {
+		saveRandomImage(imageref, "linux/amd64")
+		Expect(savedImage(imageref, "linux/amd64", tmpDirPath, false)).NotTo(BeNil())
+		Expect(savedImage(imageref, "linux/arm64", tmpDirPath, false)).To(BeNil())
+		Expect(savedImage(imageref, "pl/a/t/t/f/o/r:m", tmpDirPath, false)).To(BeNil())
+	})
+
+	It("skips pulling already saved images", func() {
+		GrabLog(logrus.InfoLevel)
+		// As the image is referenced by digest, determining its registry
+		// digest doesn't need to contact the registry either.
+		const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		const imageref = "example.org/foo/bar@" + digest
+		Expect(os.Mkdir(filepath.Join(tmpDirPath, "images"), 0777)).To(Succeed())
+		saveRandomImage(imageref, "linux/amd64")
+		Expect(os.Rename(
+			filepath.Join(tmpDirPath, imageFilename(imageref, false)),
+			filepath.Join(tmpDirPath, "images", imageFilename(imageref, false)))).To(Succeed())
+		p := &ComposerProject{}
+		// with a cancelled context, any attempt to pull would fail.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageref}, "linux/amd64", tmpDirPath, nil)).
+			To(Succeed())
+		Expect(p.SavedImages()).To(ConsistOf(And(
+			HaveField("Ref", imageref),
+			HaveField("Digest", digest),
+			HaveField("ID", HavePrefix("sha256:")),
+		)))
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageref}, "linux/arm64", tmpDirPath, nil)).
+			To(MatchError(ContainSubstring("context canceled")))
+		Expect(filepath.Join(tmpDirPath, "images", imageFilename(imageref, false)+".partial")).
+			NotTo(BeAnExistingFile())
+	})
+
+})
+
+var _ = Describe("images referenced by digest", func() {
+
+	It("packages images referenced by digest", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		repo := strings.TrimPrefix(srv.URL, "http://") + "/hellorld/app"
+		img := Successful(random.Image(1024, 1))
+		Expect(remote.Write(Successful(name.ParseReference(repo+":1.2.3")), img)).To(Succeed())
+		digest := Successful(img.Digest()).String()
+		imageRef := repo + "@" + digest
+
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		services := Successful(lookupMap(a.project.yaml, "services"))
+		for _, config := range services {
+			config.(map[string]any)["image"] = imageRef
+		}
+		Expect(a.PullAndWriteCompose(ctx, "linux/amd64", nil)).To(Succeed())
+		Expect(a.SavedImages()).To(ConsistOf(And(
+			HaveField("Ref", imageRef), HaveField("Digest", digest))))
+		Expect(os.ReadFile(filepath.Join(a.StageDir(), a.repo, "docker-compose.yml"))).To(
+			ContainSubstring(imageRef))
+
+		Expect(a.SetDetails("1.2.3", "", "x86-64")).To(Succeed())
+		Expect(a.Package(filepath.Join(GinkgoT().TempDir(), "hellorld.app"))).To(Succeed())
+	})
+
+})
+
+var _ = Describe("registry digests of saved images", func() {
+
+	It("reports the registry digest regardless of where the image came from", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		imageRef := strings.TrimPrefix(srv.URL, "http://") + "/hellorld/app:1.2.3"
+		index := mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+		for _, arch := range []string{"amd64", "arm64"} {
+			img := Successful(random.Image(1024, 1))
+			config := Successful(img.ConfigFile())
+			config.OS, config.Architecture = "linux", arch
+			img = Successful(mutate.ConfigFile(img, config))
+			index = mutate.AppendManifests(index, mutate.IndexAddendum{
+				Add: img,
+				Descriptor: ociv1.Descriptor{
+					Platform: &ociv1.Platform{OS: "linux", Architecture: arch},
+				},
+			})
+		}
+		Expect(remote.WriteIndex(Successful(name.ParseReference(imageRef)), index)).To(Succeed())
+		indexDigest := Successful(index.Digest()).String()
+
+		root := GinkgoT().TempDir()
+		p := &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef}, "linux/arm64", root, nil,
+			WithRegistryDigests())).To(Succeed())
+		Expect(p.SavedImages()).To(ConsistOf(And(
+			HaveField("Digest", indexDigest),
+			HaveField("ID", Not(BeEmpty())))))
+		pulled := p.SavedImages()
+
+		// Resuming reads the saved image file back, but still reports the
+		// registry digest, and not the digest of the saved image.
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef}, "linux/arm64", root, nil,
+			WithRegistryDigests())).To(Succeed())
+		Expect(p.SavedImages()).To(Equal(pulled))
+
+		// Unless asked to, resuming doesn't contact the registry at all.
+		srv.Close()
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef}, "linux/arm64", root, nil)).To(Succeed())
+		Expect(p.SavedImages()).To(ConsistOf(And(
+			HaveField("Digest", And(HavePrefix("sha256:"), Not(Equal(indexDigest)))),
+			HaveField("ID", pulled[0].ID))))
+
+		// And when the registry cannot be reached, it falls back to the
+		// local digest instead of failing.
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef}, "linux/arm64", root, nil,
+			WithRegistryDigests(), WithRetries(0, 0))).To(Succeed())
+		Expect(p.SavedImages()[0].Digest).NotTo(Equal(indexDigest))
+	})
+
+})
+
+var _ = Describe("compressed images", func() {
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("saves gzip-compressed image tar-balls", func(ctx context.Context) {
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		imageRef := strings.TrimPrefix(srv.URL, "http://") + "/hellorld/app:1.2.3"
+		img := Successful(random.Image(1024, 1))
+		config := Successful(img.ConfigFile())
+		config.OS, config.Architecture = "linux", "amd64"
+		img = Successful(mutate.ConfigFile(img, config))
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), img)).To(Succeed())
+
+		dir := GinkgoT().TempDir()
+		filename := Successful(SaveImageToFile(ctx, imageRef, "linux/amd64", dir, nil, WithCompression()))
+		Expect(filename).To(HaveSuffix(".tar.gz"))
+
+		f := Successful(os.Open(filepath.Join(dir, filename)))
+		defer f.Close()
+		gz := Successful(gzip.NewReader(f))
+		tarrer := tar.NewReader(gz)
+		var names []string
+		for {
+			header, err := tarrer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, header.Name)
+		}
+		Expect(names).To(ContainElement("manifest.json"))
+
+		Expect(savedImage(imageRef, "linux/amd64", dir, false)).To(BeNil())
+		saved := savedImage(imageRef, "linux/amd64", dir, true)
+		Expect(saved).NotTo(BeNil())
+		Expect(saved.ConfigName()).To(Equal(Successful(img.ConfigName())))
+
+		contents := Successful(os.ReadFile(filepath.Join(dir, filename)))
+		digest := sha256.Sum256(contents)
+		Expect(FileDigests(dir)).To(HaveKeyWithValue(
+			filename, hex.EncodeToString(digest[:])))
+	})
+
+})
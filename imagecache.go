@@ -0,0 +1,93 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/otiai10/copy"
+	log "github.com/sirupsen/logrus"
+)
+
+// WithImageCache keeps the image files saved by PullImages in the specified
+// image cache directory, and first looks for image files saved there before,
+// instead of pulling the images again. As cached images are looked up by
+// their image references, they don't pick up moved tags, so the image cache is
+// intended for fast local iterations only. An empty directory disables
+// caching.
+func WithImageCache(dir string) PullOption {
+	return func(o *PullOptions) { o.CacheDir = dir }
+}
+
+// cachedDigestExt is the extension of the files in the image cache recording
+// the registry digests of the cached images.
+const cachedDigestExt = ".digest"
+
+// cachedImage returns the referenced image for the specified platform from the
+// specified image cache directory, after linking (or copying) its image file into the specified
+// images directory, together with the registry digest of the image when it was
+// cached, if known. Otherwise, it returns nil.
+func cachedImage(cacheDir string, imageRef string, platform string, imagesDir string, compressed bool) (ociv1.Image, string) {
+	if cacheDir == "" || savedImage(imageRef, platform, cacheDir, compressed) == nil {
+		return nil, ""
+	}
+	filename := imageFilename(imageRef, compressed)
+	if err := linkOrCopy(
+		filepath.Join(cacheDir, filename),
+		filepath.Join(imagesDir, filename),
+	); err != nil {
+		log.Debugf("🐛 cannot take image %s from cache: %s", imageRef, err)
+		return nil, ""
+	}
+	digest, _ := os.ReadFile(filepath.Join(cacheDir, filename+cachedDigestExt))
+	return savedImage(imageRef, platform, imagesDir, compressed), string(digest)
+}
+
+// cacheImage keeps the saved image file of the referenced image in the
+// specified image cache directory, if any, together with the specified registry digest of the image.
+func cacheImage(cacheDir string, imageRef string, imagesDir string, compressed bool, digest string) {
+	if cacheDir == "" {
+		return
+	}
+	filename := imageFilename(imageRef, compressed)
+	if err := linkOrCopy(
+		filepath.Join(imagesDir, filename),
+		filepath.Join(cacheDir, filename),
+	); err != nil {
+		log.Debugf("🐛 cannot cache image %s: %s", imageRef, err)
+		return
+	}
+	digestPath := filepath.Join(cacheDir, filename+cachedDigestExt)
+	if digest == "" {
+		_ = os.Remove(digestPath)
+		return
+	}
+	if err := os.WriteFile(digestPath, []byte(digest), 0666); err != nil {
+		log.Debugf("🐛 cannot cache digest of image %s: %s", imageRef, err)
+	}
+}
+
+// linkOrCopy hard links the specified source file to the destination path,
+// falling back to copying when linking isn't possible, such as across file
+// systems.
+func linkOrCopy(src string, dest string) error {
+	_ = os.Remove(dest)
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	return copy.Copy(src, dest)
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("image cache", func() {
+
+	var cacheDir string
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		cacheDir = GinkgoT().TempDir()
+	})
+
+	It("takes images from the cache instead of pulling them again", func(ctx context.Context) {
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		imageRef := strings.TrimPrefix(srv.URL, "http://") + "/hellorld/app:1.2.3"
+		img := Successful(random.Image(1024, 1))
+		config := Successful(img.ConfigFile())
+		config.OS, config.Architecture = "linux", "amd64"
+		img = Successful(mutate.ConfigFile(img, config))
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), img)).To(Succeed())
+		digest := Successful(img.Digest()).String()
+
+		p := &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithImageCache(cacheDir))).To(Succeed())
+		Expect(savedImage(imageRef, "linux/amd64", cacheDir, false)).NotTo(BeNil())
+		Expect(p.SavedImages()).To(ConsistOf(HaveField("Digest", digest)))
+
+		// With the registry gone, only the cache can save the day.
+		srv.Close()
+		p = &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithImageCache(cacheDir))).To(Succeed())
+		Expect(p.SavedImages()).To(ConsistOf(HaveField("Digest", digest)))
+
+		// ...but not for other platforms.
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef},
+			"linux/arm64", GinkgoT().TempDir(), nil, WithImageCache(cacheDir), WithRetries(0, 0))).NotTo(Succeed())
+	})
+
+})
@@ -0,0 +1,127 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+// ImageLock maps image references to their reviewed registry digests, such as
+// “busybox:stable” to “sha256:...”.
+type ImageLock map[string]string
+
+// LoadImageLock loads an image lockfile from the specified path. The
+// lockfile is a YAML (or JSON) associative array of image references to
+// their digests, using the same image references as the composer project.
+func LoadImageLock(path string) (ImageLock, error) {
+	locktext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image lockfile, reason: %w", err)
+	}
+	var lock ImageLock
+	if err := yaml.Unmarshal(locktext, &lock); err != nil {
+		return nil, fmt.Errorf("malformed image lockfile, reason: %w", err)
+	}
+	return lock, nil
+}
+
+// Check resolves the digests the specified image references currently resolve
+// to in their registries, in the same way as PinImageDigests does, and checks
+// them against the image lock. Check returns an error listing all images
+// missing from the lock or with mismatching digests, or the first error
+// resolving a digest. As Check doesn't need to pull the images, it also works
+// for slim app packages. Image references match lock entries also when only
+// one of them is qualified, see QualifyImages. Pass WithAuth or WithBasicAuth in order to
+// authenticate with explicit credentials; other pull options don't apply.
+func (l ImageLock) Check(ctx context.Context, imageRefs []string, opts ...PullOption) error {
+	options := pullOptions(opts)
+	// Image references might have been qualified after writing the lockfile,
+	// or the other way round, so fall back to comparing the qualified forms.
+	qualifiedLock := ImageLock{}
+	for imageRef, digest := range l {
+		if qualifiedRef, err := qualifyImageRef(imageRef); err == nil {
+			qualifiedLock[qualifiedRef] = digest
+		}
+	}
+	var problems []string
+	for _, imageRef := range imageRefs {
+		lockedDigest, ok := l[imageRef]
+		if !ok {
+			if qualifiedRef, err := qualifyImageRef(imageRef); err == nil {
+				lockedDigest, ok = qualifiedLock[qualifiedRef]
+			}
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("image %q missing from lockfile", imageRef))
+			continue
+		}
+		ref, err := name.ParseReference(imageRef, name.WithDefaultRegistry(DefaultRegistry))
+		if err != nil {
+			return fmt.Errorf("invalid image reference %q: %w", imageRef, err)
+		}
+		var digest string
+		err = retry(ctx, options, fmt.Sprintf("resolving digest of image %q", imageRef), func(ctx context.Context) (err error) {
+			digest, err = registryDigest(ctx, ref, options)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if digest != lockedDigest {
+			problems = append(problems, fmt.Sprintf("image %q has digest %s, but lockfile expects %s",
+				imageRef, digest, lockedDigest))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CheckImageLock checks the images of all services, as well as the extra
+// images, against the specified image lock, see also [ImageLock.Check].
+func (a *App) CheckImageLock(ctx context.Context, lock ImageLock, opts ...PullOption) error {
+	return lock.Check(ctx, a.project.imageRefs(), opts...)
+}
+
+// imageRefs returns the sorted unique image references of all services, as
+// well as of the extra images. Services lacking a valid image element are
+// skipped, as Images and Validate already report them.
+func (p *ComposerProject) imageRefs() []string {
+	uniqueImageRefs := map[string]nada{}
+	services, _ := lookupMap(p.yaml, "services")
+	for serviceName := range services {
+		config, err := lookupMap(services, serviceName)
+		if err != nil {
+			continue
+		}
+		if imageRef, err := lookupString(config, "image"); err == nil {
+			uniqueImageRefs[imageRef] = nada{}
+		}
+	}
+	for _, imageRef := range p.extraImages {
+		uniqueImageRefs[imageRef] = nada{}
+	}
+	return slices.Sorted(maps.Keys(uniqueImageRefs))
+}
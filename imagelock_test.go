@@ -0,0 +1,109 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("image lockfiles", func() {
+
+	var host string
+	var busybox, alpine string
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		host = strings.TrimPrefix(srv.URL, "http://")
+		push := func(imageRef string) string {
+			GinkgoHelper()
+			image := Successful(random.Image(1024, 1))
+			Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+			return Successful(image.Digest()).String()
+		}
+		busybox = push(host + "/busybox:stable")
+		alpine = push(host + "/alpine:edge")
+	})
+
+	It("loads lockfiles", func() {
+		lock := Successful(LoadImageLock("testdata/imagelock/lock.yaml"))
+		Expect(lock).To(HaveKeyWithValue("busybox:stable", "sha256:"+strings.Repeat("1", 64)))
+		Expect(lock).To(HaveKeyWithValue("alpine:edge", "sha256:"+strings.Repeat("2", 64)))
+	})
+
+	It("accepts images matching the lockfile", func(ctx context.Context) {
+		lock := ImageLock{host + "/busybox:stable": busybox, host + "/alpine:edge": alpine}
+		Expect(lock.Check(ctx, []string{host + "/busybox:stable", host + "/alpine:edge"})).To(Succeed())
+		Expect(lock.Check(ctx, []string{host + "/busybox:stable"})).To(Succeed())
+	})
+
+	It("rejects images mismatching or missing from the lockfile", func(ctx context.Context) {
+		lock := ImageLock{host + "/busybox:stable": busybox, host + "/alpine:edge": busybox}
+		Expect(lock.Check(ctx, []string{
+			host + "/busybox:stable",
+			host + "/alpine:edge",
+			host + "/alpine:3.18",
+		})).To(MatchError(
+			`image "` + host + `/alpine:edge" has digest ` + alpine +
+				", but lockfile expects " + busybox +
+				`; image "` + host + `/alpine:3.18" missing from lockfile`))
+	})
+
+	It("matches qualified and unqualified image references", Serial, func(ctx context.Context) {
+		oldDefaultRegistry := DefaultRegistry
+		DeferCleanup(func() { DefaultRegistry = oldDefaultRegistry })
+		DefaultRegistry = host
+
+		lock := ImageLock{"busybox:stable": busybox, host + "/alpine:edge": alpine}
+		Expect(lock.Check(ctx, []string{host + "/busybox:stable", "alpine:edge"})).To(Succeed())
+		Expect(lock.Check(ctx, []string{host + "/busybox:edge"})).To(
+			MatchError(ContainSubstring("missing from lockfile")))
+	})
+
+	It("checks the images of an app without pulling them", func(ctx context.Context) {
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		services := Successful(lookupMap(a.project.yaml, "services"))
+		for _, config := range services {
+			config.(map[string]any)["image"] = host + "/busybox:stable"
+		}
+		Expect(a.CheckImageLock(ctx, ImageLock{host + "/busybox:stable": busybox})).To(Succeed())
+		Expect(a.CheckImageLock(ctx, ImageLock{host + "/busybox:stable": alpine})).To(
+			MatchError(ContainSubstring("but lockfile expects")))
+	})
+
+	It("reports unreadable lockfiles", func() {
+		Expect(LoadImageLock("testdata/imagelock/nada-nothing-nil.yaml")).Error().To(
+			MatchError(ContainSubstring("cannot read image lockfile")))
+		Expect(LoadImageLock("testdata/imagelock/malformed.yaml")).Error().To(
+			MatchError(ContainSubstring("malformed image lockfile")))
+	})
+
+})
@@ -0,0 +1,141 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// includableElements lists the top-level composer project elements that get
+// merged from included composer project files.
+var includableElements = []string{"services", "volumes", "networks", "secrets", "configs"}
+
+// resolveIncludes loads the composer project files referenced by the
+// top-level “include” element of the specified composer project, if any, and
+// merges their services, volumes, networks, secrets, and configs into the
+// project. Relative include paths are relative to the directory of the
+// including composer project file at “path”. Similar to Docker's composer,
+// definitions from included files must not conflict with existing
+// definitions. Finally, resolveIncludes removes the “include” element.
+//
+// Please note that resolveIncludes doesn't rewrite any relative paths inside
+// the included composer project files, such as bind mount sources.
+func resolveIncludes(projectYAML map[string]any, path string, including []string) error {
+	includes, ok := projectYAML["include"]
+	if !ok {
+		return nil
+	}
+	delete(projectYAML, "include")
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot determine absolute composer project path, reason: %w", err)
+	}
+	including = append(slices.Clone(including), abspath)
+	paths, err := includePaths(includes)
+	if err != nil {
+		return err
+	}
+	for _, includePath := range paths {
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), includePath)
+		}
+		absIncludePath, err := filepath.Abs(includePath)
+		if err != nil {
+			return fmt.Errorf("cannot determine absolute include path, reason: %w", err)
+		}
+		if slices.Contains(including, absIncludePath) {
+			return fmt.Errorf("cyclic include of composer project %q", includePath)
+		}
+		included, err := loadComposerYAML(includePath, including)
+		if err != nil {
+			return fmt.Errorf("cannot include composer project %q, reason: %w", includePath, err)
+		}
+		if err := mergeIncluded(projectYAML, included, includePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includePaths returns the composer project file paths from the specified
+// “include” element, supporting both the short syntax of plain path strings as
+// well as the long syntax with its “path” element.
+func includePaths(includes any) ([]string, error) {
+	list, ok := includes.([]any)
+	if !ok {
+		return nil, fmt.Errorf("include in composer project is not a list")
+	}
+	var paths []string
+	for _, include := range list {
+		switch include := include.(type) {
+		case string:
+			paths = append(paths, include)
+		case map[string]any:
+			switch path := include["path"].(type) {
+			case string:
+				paths = append(paths, path)
+			case []any:
+				for _, p := range path {
+					s, ok := p.(string)
+					if !ok {
+						return nil, fmt.Errorf("invalid include path %v in composer project", p)
+					}
+					paths = append(paths, s)
+				}
+			default:
+				return nil, fmt.Errorf("invalid include path %v in composer project", path)
+			}
+		default:
+			return nil, fmt.Errorf("invalid include %v in composer project", include)
+		}
+	}
+	return paths, nil
+}
+
+// mergeIncluded merges the includable elements of the included composer
+// project into the including composer project, rejecting conflicting
+// definitions.
+func mergeIncluded(projectYAML map[string]any, included map[string]any, includePath string) error {
+	for _, key := range includableElements {
+		element, ok := included[key]
+		if !ok || element == nil {
+			continue
+		}
+		definitions, ok := element.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s in included composer project %q is not an associative array",
+				key, includePath)
+		}
+		existing, ok := projectYAML[key].(map[string]any)
+		if !ok {
+			if projectYAML[key] != nil {
+				return fmt.Errorf("%s in composer project is not an associative array", key)
+			}
+			existing = map[string]any{}
+			projectYAML[key] = existing
+		}
+		for _, name := range slices.Sorted(maps.Keys(definitions)) {
+			if _, ok := existing[name]; ok {
+				return fmt.Errorf("%s %q from included composer project %q conflicts with existing definition",
+					key, name, includePath)
+			}
+			existing[name] = definitions[name]
+		}
+	}
+	return nil
+}
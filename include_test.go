@@ -0,0 +1,68 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("composer project includes", func() {
+
+	It("merges included composer projects", func() {
+		GrabLog(logrus.InfoLevel)
+		p := Successful(LoadComposerProject("testdata/include/simple"))
+		Expect(p.yaml).NotTo(HaveKey("include"))
+		Expect(p.yaml).To(HaveKeyWithValue("networks", HaveKey("backend")))
+		Expect(p.yaml).To(HaveKeyWithValue("volumes", HaveKey("data")))
+		Expect(p.Images()).To(Equal(ServiceImages{
+			"foo": "busybox:stable",
+			"bar": "alpine:edge",
+			"db":  "alpine:edge",
+		}))
+	})
+
+	DescribeTable("reporting include problems",
+		func(dir string, errmsg string) {
+			Expect(LoadComposerProject(dir)).Error().To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "testdata/include/cycle", "cyclic include of composer project"),
+		Entry(nil, "testdata/include/conflict",
+			`services "foo" from included composer project "testdata/include/conflict/base.yaml" conflicts`),
+		Entry(nil, "testdata/include/missing", "cannot include composer project"),
+	)
+
+	DescribeTable("rejecting invalid includes",
+		func(include any, errmsg string) {
+			Expect(includePaths(include)).Error().To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, "foo.yaml", "not a list"),
+		Entry(nil, []any{42}, "invalid include"),
+		Entry(nil, []any{map[string]any{"path": 42}}, "invalid include path"),
+		Entry(nil, []any{map[string]any{"path": []any{42}}}, "invalid include path"),
+	)
+
+	It("rejects invalid included definitions", func() {
+		Expect(mergeIncluded(map[string]any{}, map[string]any{"services": "foo"}, "foo.yaml")).To(
+			MatchError(ContainSubstring("is not an associative array")))
+		Expect(mergeIncluded(map[string]any{"services": "foo"},
+			map[string]any{"services": map[string]any{"foo": nil}}, "foo.yaml")).To(
+			MatchError(ContainSubstring("is not an associative array")))
+	})
+
+})
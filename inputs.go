@@ -0,0 +1,89 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// InputsDigestDetailsField is the name of the “detail.json” field that
+// WriteInputsDigest writes the inputs digest to.
+const InputsDigestDetailsField = "x-tiap-inputs-digest"
+
+// InputsDigest returns a digest over all logical inputs of an app build,
+// that is, the app template files, the registry digests of the images pulled
+// by PullAndWriteCompose, the contents of the files added using AddFile, the
+// SourceDateEpochEnvVar environment variable, and the specified build
+// parameters, such as the app version, release notes, architecture, and tiap
+// version. Build systems can use the inputs digest to detect unchanged inputs
+// in order to skip rebuilds. InputsDigest must be called after
+// PullAndWriteCompose and after all AddFile calls.
+func (a *App) InputsDigest(params map[string]string) (string, error) {
+	templateDigests, err := FileDigests(a.sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine inputs digest, reason: %w", err)
+	}
+	images := a.project.SavedImages()
+	if images == nil {
+		images = []SavedImage{}
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	addedFiles := a.addedFiles
+	if addedFiles == nil {
+		addedFiles = map[string]string{}
+	}
+	// As encoding/json marshals maps with their keys sorted and the saved
+	// images are sorted too, the JSON representation is stable.
+	inputs, err := json.Marshal(struct {
+		Template        map[string]string `json:"template"`
+		Images          []SavedImage      `json:"images"`
+		AddedFiles      map[string]string `json:"addedFiles"`
+		SourceDateEpoch string            `json:"sourceDateEpoch"`
+		Params          map[string]string `json:"params"`
+	}{
+		Template:        templateDigests,
+		Images:          images,
+		AddedFiles:      addedFiles,
+		SourceDateEpoch: os.Getenv(SourceDateEpochEnvVar),
+		Params:          params,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot determine inputs digest, reason: %w", err)
+	}
+	digest := sha256.Sum256(inputs)
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
+
+// WriteInputsDigest writes the inputs digest for the specified build
+// parameters into the InputsDigestDetailsField of the “detail.json”. It must
+// thus be called after PullAndWriteCompose, SetDetails, and AddFile.
+func (a *App) WriteInputsDigest(params map[string]string) error {
+	digest, err := a.InputsDigest(params)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("🧾  inputs digest: %s", digest))
+	return updateDetails(a.detailsPath(), func(details map[string]any) {
+		details[InputsDigestDetailsField] = digest
+	})
+}
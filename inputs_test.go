@@ -0,0 +1,98 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/otiai10/copy"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("inputs digest", func() {
+
+	params := map[string]string{"version": "1.2.3", "tiap": "v0.42.0"}
+
+	newApp := func(template string) *App {
+		GinkgoHelper()
+		a := Successful(NewApp(template))
+		DeferCleanup(func() { a.Done() })
+		a.project.savedImages = []SavedImage{
+			{Ref: "busybox:stable", Digest: "sha256:1234", ID: "sha256:5678"},
+		}
+		return a
+	}
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("is stable across identical inputs", func() {
+		digest := Successful(newApp("testdata/app").InputsDigest(params))
+		Expect(digest).To(MatchRegexp(`^sha256:[0-9a-f]{64}$`))
+		Expect(newApp("testdata/app").InputsDigest(
+			map[string]string{"tiap": "v0.42.0", "version": "1.2.3"})).To(Equal(digest))
+	})
+
+	It("changes when the inputs change", func() {
+		a := newApp("testdata/app")
+		digest := Successful(a.InputsDigest(params))
+
+		Expect(a.InputsDigest(map[string]string{"version": "1.2.4", "tiap": "v0.42.0"})).
+			NotTo(Equal(digest))
+		Expect(a.InputsDigest(nil)).NotTo(Equal(digest))
+
+		a.project.savedImages[0].Digest = "sha256:abcd"
+		Expect(a.InputsDigest(params)).NotTo(Equal(digest))
+
+		template := GinkgoT().TempDir()
+		Expect(copy.Copy("testdata/app", template)).To(Succeed())
+		Expect(newApp(template).InputsDigest(params)).To(Equal(digest))
+		Expect(os.WriteFile(filepath.Join(template, "hellorld", "README"), []byte("hello"), 0666)).
+			To(Succeed())
+		Expect(newApp(template).InputsDigest(params)).NotTo(Equal(digest))
+	})
+
+	It("changes when added files or the source date epoch change", func() {
+		a := newApp("testdata/app")
+		digest := Successful(a.InputsDigest(params))
+
+		src := filepath.Join(GinkgoT().TempDir(), "notes.txt")
+		Expect(os.WriteFile(src, []byte("foo"), 0666)).To(Succeed())
+		Expect(a.AddFile(src, "notes.txt", false)).To(Succeed())
+		added := Successful(a.InputsDigest(params))
+		Expect(added).NotTo(Equal(digest))
+
+		Expect(os.WriteFile(src, []byte("bar"), 0666)).To(Succeed())
+		Expect(a.AddFile(src, "notes.txt", true)).To(Succeed())
+		Expect(a.InputsDigest(params)).NotTo(Equal(added))
+
+		GinkgoT().Setenv(SourceDateEpochEnvVar, "42")
+		Expect(newApp("testdata/app").InputsDigest(params)).NotTo(Equal(digest))
+	})
+
+	It("writes the inputs digest into detail.json", func() {
+		a := newApp("testdata/app")
+		Expect(a.WriteInputsDigest(params)).To(Succeed())
+		Expect(Successful(readDetails(a.detailsPath()))).To(HaveKeyWithValue(
+			InputsDigestDetailsField, Successful(a.InputsDigest(params))))
+	})
+
+})
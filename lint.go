@@ -0,0 +1,197 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// LintIssue describes a structural problem in a composer project, such as a
+// service element having the wrong type or shape.
+type LintIssue struct {
+	Path    string // dot-separated path to the offending element.
+	Message string // description of what is wrong.
+}
+
+// String returns the issue in “path: message” form.
+func (i LintIssue) String() string {
+	return i.Path + ": " + i.Message
+}
+
+// LintError combines all lint issues found in a composer project.
+type LintError []LintIssue
+
+// Error returns all lint issues, separated by semicolons.
+func (e LintError) Error() string {
+	issues := make([]string, 0, len(e))
+	for _, issue := range e {
+		issues = append(issues, issue.String())
+	}
+	return "composer project lint issues: " + strings.Join(issues, "; ")
+}
+
+// shape describes the YAML types an element is allowed to have.
+type shape int
+
+const (
+	shapeString shape = 1 << iota
+	shapeNumber
+	shapeBool
+	shapeNull
+	shapeList
+	shapeMap
+)
+
+// serviceElementShapes lists the service elements that we check together
+// with their allowed shapes. We're deliberately conservative here and only
+// check commonly used elements where we're sure about their allowed shapes.
+var serviceElementShapes = map[string]shape{
+	"image":       shapeString,
+	"mem_limit":   shapeString | shapeNumber,
+	"restart":     shapeString,
+	"command":     shapeString | shapeList,
+	"entrypoint":  shapeString | shapeList,
+	"environment": shapeMap | shapeList,
+	"labels":      shapeMap | shapeList,
+	"ports":       shapeList,
+	"expose":      shapeList,
+	"volumes":     shapeList,
+	"cap_add":     shapeList,
+	"cap_drop":    shapeList,
+	"devices":     shapeList,
+	"depends_on":  shapeMap | shapeList,
+	"networks":    shapeMap | shapeList,
+}
+
+// Lint checks the composer project for common structural mistakes, such as
+// “ports” being a map instead of a list, or “environment” variables having
+// non-scalar values. It returns nil if no issues were found, otherwise a
+// LintError listing all issues found. Lint complements the minimal validation
+// done by Images and is thus opt-in.
+func (p *ComposerProject) Lint() error {
+	var issues LintError
+	for _, key := range []string{"volumes", "networks", "secrets", "configs"} {
+		if element, ok := p.yaml[key]; ok {
+			issues.check(key, element, shapeMap|shapeNull)
+		}
+	}
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		issues = append(issues, LintIssue{Path: "services", Message: err.Error()})
+		return issues
+	}
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		path := "services." + serviceName
+		config, ok := services[serviceName].(map[string]any)
+		if !ok {
+			issues = append(issues, LintIssue{Path: path, Message: "not an associative array"})
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(config)) {
+			allowed, ok := serviceElementShapes[key]
+			if !ok {
+				continue
+			}
+			issues.check(path+"."+key, config[key], allowed)
+		}
+		if env, ok := config["environment"]; ok {
+			issues.checkEnvironment(path+".environment", env)
+		}
+		if ports, ok := config["ports"].([]any); ok {
+			for idx, port := range ports {
+				issues.check(fmt.Sprintf("%s.ports[%d]", path, idx), port,
+					shapeString|shapeNumber|shapeMap)
+			}
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+	return issues
+}
+
+// check adds a lint issue if the specified element doesn't have one of the
+// allowed shapes.
+func (e *LintError) check(path string, element any, allowed shape) {
+	if shapeOf(element)&allowed != 0 {
+		return
+	}
+	*e = append(*e, LintIssue{
+		Path:    path,
+		Message: fmt.Sprintf("is %s, but must be %s", shapeOf(element), allowed),
+	})
+}
+
+// checkEnvironment checks that environment variables have only scalar
+// values; this applies to both the map and list forms.
+func (e *LintError) checkEnvironment(path string, env any) {
+	switch env := env.(type) {
+	case map[string]any:
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			e.check(path+"."+name, env[name], shapeString|shapeNumber|shapeNull)
+		}
+	case []any:
+		for idx, variable := range env {
+			e.check(fmt.Sprintf("%s[%d]", path, idx), variable, shapeString)
+		}
+	}
+}
+
+// shapeOf returns the shape of the specified YAML element.
+func shapeOf(element any) shape {
+	switch element.(type) {
+	case nil:
+		return shapeNull
+	case string:
+		return shapeString
+	case int, int64, uint64, float64:
+		return shapeNumber
+	case bool:
+		return shapeBool
+	case []any:
+		return shapeList
+	case map[string]any:
+		return shapeMap
+	}
+	return 0
+}
+
+// String returns a textual description of the shape(s), such as “a string or
+// a list”.
+func (s shape) String() string {
+	var names []string
+	for _, n := range []struct {
+		shape shape
+		name  string
+	}{
+		{shapeString, "a string"},
+		{shapeNumber, "a number"},
+		{shapeBool, "a boolean"},
+		{shapeNull, "null"},
+		{shapeList, "a list"},
+		{shapeMap, "an associative array"},
+	} {
+		if s&n.shape != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "of unknown type"
+	}
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("linting composer projects", func() {
+
+	It("passes well-formed projects", func() {
+		p := Successful(LoadComposerProject("testdata/composer/hellorld"))
+		Expect(p.Lint()).To(Succeed())
+		p = Successful(LoadComposerProject("testdata/app/hellorld"))
+		Expect(p.Lint()).To(Succeed())
+	})
+
+	It("reports structural mistakes with their paths", func() {
+		p := Successful(LoadComposerProject("testdata/lint/broken"))
+		err := p.Lint()
+		Expect(err).To(HaveOccurred())
+		var issues LintError
+		Expect(err).To(BeAssignableToTypeOf(issues))
+		issues = err.(LintError)
+		Expect(issues).To(ConsistOf(
+			LintIssue{Path: "volumes", Message: "is a list, but must be null or an associative array"},
+			LintIssue{Path: "services.bar.environment[1]", Message: "is an associative array, but must be a string"},
+			LintIssue{Path: "services.bar.ports[1]", Message: "is a list, but must be a string or a number or an associative array"},
+			LintIssue{Path: "services.foo.environment.DEBUG", Message: "is a boolean, but must be a string or a number or null"},
+			LintIssue{Path: "services.foo.ports", Message: "is an associative array, but must be a list"},
+		))
+		Expect(err.Error()).To(HavePrefix("composer project lint issues: volumes: is a list"))
+	})
+
+	It("reports missing and invalid services", func() {
+		p := &ComposerProject{}
+		Expect(p.Lint()).To(MatchError(ContainSubstring("services: no services found")))
+
+		p = &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": 42,
+			},
+		}}
+		Expect(p.Lint()).To(MatchError(ContainSubstring("services.foo: not an associative array")))
+	})
+
+})
@@ -0,0 +1,81 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+)
+
+// WithMirror pushes all images of a composer project to the specified mirror
+// registry, such as “registry.example.org” or “registry.example.org/mirror”,
+// when pulling its images using PullImages, including images already saved or
+// taken from the image cache or local daemon. The mirrored images keep their
+// repository paths and tags or digests, but are placed into the mirror
+// registry. An empty mirror registry disables mirroring.
+//
+// Pushing to the mirror registry uses any explicit credentials for the mirror
+// registry passed using WithAuth or WithBasicAuth, or otherwise the
+// credentials from the Docker configuration, as in “docker login”.
+func WithMirror(mirror string) PullOption {
+	return func(o *PullOptions) { o.Mirror = mirror }
+}
+
+// mirrorRef returns the reference of the mirrored image in the specified
+// mirror registry for the specified image reference.
+func mirrorRef(mirror string, imageRef name.Reference) (name.Reference, error) {
+	ref := mirror + "/" + imageRef.Context().RepositoryStr()
+	if _, ok := imageRef.(name.Digest); ok {
+		ref += "@" + imageRef.Identifier()
+	} else {
+		ref += ":" + imageRef.Identifier()
+	}
+	mirrorRef, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror image reference %q, reason: %w", ref, err)
+	}
+	return mirrorRef, nil
+}
+
+// mirrorImage pushes the specified image to the mirror registry, retagging
+// the image reference accordingly.
+func mirrorImage(
+	ctx context.Context,
+	mirror string,
+	imageRef name.Reference,
+	image ociv1.Image,
+	options PullOptions,
+) error {
+	mirrorRef, err := mirrorRef(mirror, imageRef)
+	if err != nil {
+		return err
+	}
+	log.Debugf("🐛 mirroring image %s to %s...", imageRef, mirrorRef)
+	err = remote.Write(mirrorRef, image,
+		remote.WithContext(ctx),
+		options.registryAuth(),
+		registryTransport())
+	if err != nil {
+		return fmt.Errorf("cannot mirror image %s to %s, reason: %w",
+			imageRef, mirrorRef, err)
+	}
+	log.Info(fmt.Sprintf("   🪞  mirrored 🖼  image %s to %s", imageRef, mirrorRef))
+	return nil
+}
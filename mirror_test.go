@@ -0,0 +1,110 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("mirroring images", Serial, func() {
+
+	// newRegistry returns the host of a new in-memory test registry.
+	newRegistry := func() string {
+		GinkgoHelper()
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+
+	It("derives mirror image references", func() {
+		Expect(mirrorRef("mirror.example.org/team",
+			Successful(name.ParseReference("busybox:stable")))).To(
+			HaveField("String()", "mirror.example.org/team/library/busybox:stable"))
+		digest := "sha256:" + strings.Repeat("0", 64)
+		Expect(mirrorRef("mirror.example.org",
+			Successful(name.ParseReference("example.org/foo/bar@"+digest)))).To(
+			HaveField("String()", "mirror.example.org/foo/bar@"+digest))
+		Expect(mirrorRef("MIRROR", Successful(name.ParseReference("busybox:stable")))).Error().To(
+			MatchError(ContainSubstring("invalid mirror image reference")))
+	})
+
+	// mirrorTo returns the pull options for mirroring to the specified
+	// registry, disabling retries so that failing mirrors fail fast.
+	mirrorTo := func(mirror string) PullOptions {
+		return pullOptions([]PullOption{WithMirror(mirror), WithRetries(0, 0)})
+	}
+
+	It("pushes pulled images to the mirror", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		source := newRegistry()
+		mirror := newRegistry()
+
+		image := Successful(random.Image(1024, 1))
+		imageRef := source + "/hellorld/app:1.2.3"
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+
+		Expect(pullAndSaveImage(ctx, imageRef, "linux/amd64", GinkgoT().TempDir(), nil, mirrorTo(mirror))).
+			Error().NotTo(HaveOccurred())
+		mirrored := Successful(remote.Image(
+			Successful(name.ParseReference(mirror + "/hellorld/app:1.2.3"))))
+		Expect(mirrored.Digest()).To(Equal(Successful(image.Digest())))
+	})
+
+	It("pushes already saved images to the mirror", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		source := newRegistry()
+		mirror := newRegistry()
+
+		image := Successful(random.Image(1024, 1))
+		imageRef := source + "/hellorld/app:1.2.3"
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+
+		imagesDir := GinkgoT().TempDir()
+		Expect(pullAndSaveImage(ctx, imageRef, "linux/amd64", imagesDir, nil, PullOptions{})).
+			Error().NotTo(HaveOccurred())
+
+		Expect(pullAndSaveImage(ctx, imageRef, "linux/amd64", imagesDir, nil, mirrorTo(mirror))).
+			Error().NotTo(HaveOccurred())
+		mirrored := Successful(remote.Image(
+			Successful(name.ParseReference(mirror + "/hellorld/app:1.2.3"))))
+		Expect(mirrored.ConfigName()).To(Equal(Successful(image.ConfigName())))
+	})
+
+	It("reports failing mirrors", func(ctx context.Context) {
+		GrabLog(logrus.InfoLevel)
+		source := newRegistry()
+		imageRef := source + "/hellorld/app:1.2.3"
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)),
+			Successful(random.Image(1024, 1)))).To(Succeed())
+
+		Expect(pullAndSaveImage(ctx, imageRef, "linux/amd64", GinkgoT().TempDir(), nil, mirrorTo("127.0.0.1:1"))).
+			Error().To(MatchError(ContainSubstring("cannot mirror image")))
+	})
+
+})
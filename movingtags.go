@@ -0,0 +1,90 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/distribution/reference"
+)
+
+// DefaultMovingTags lists the patterns of image tags that are discouraged as
+// they usually get moved to newer images over time, similar to “latest”.
+var DefaultMovingTags = []string{"stable", "edge", "nightly", "main", "master", "dev*"}
+
+// MovingTag describes a service using an image with a moving tag.
+type MovingTag struct {
+	Service string // service name
+	Image   string // image reference
+	Tag     string // moving tag
+}
+
+// String returns a textual description of the moving tag use.
+func (m MovingTag) String() string {
+	return fmt.Sprintf("service %q image %q uses moving tag %q", m.Service, m.Image, m.Tag)
+}
+
+// MovingTags returns the services using image tags matching any of the
+// specified patterns in path.Match syntax, such as “nightly*”, sorted by
+// service name. Images pinned by digest are never considered to use moving
+// tags, even if they additionally have a tag.
+func (p *ComposerProject) MovingTags(patterns []string) ([]MovingTag, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid moving tag pattern %q, reason: %w", pattern, err)
+		}
+	}
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return nil, fmt.Errorf("no services found, reason: %w", err)
+	}
+	var moving []MovingTag
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		config, err := lookupMap(services, serviceName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service %q, reason: %w", serviceName, err)
+		}
+		imageRef, err := lookupString(config, "image")
+		if err != nil {
+			return nil, fmt.Errorf("invalid image element in service %q, reason: %w", serviceName, err)
+		}
+		ir, err := reference.Parse(imageRef)
+		if err != nil {
+			return nil, fmt.Errorf("service %q with invalid image reference %q, reason: %w",
+				serviceName, imageRef, err)
+		}
+		if _, ok := ir.(reference.Digested); ok {
+			continue
+		}
+		tagged, ok := ir.(reference.Tagged)
+		if !ok {
+			continue
+		}
+		for _, pattern := range patterns {
+			if match, _ := path.Match(pattern, tagged.Tag()); match {
+				moving = append(moving, MovingTag{
+					Service: serviceName,
+					Image:   imageRef,
+					Tag:     tagged.Tag(),
+				})
+				break
+			}
+		}
+	}
+	return moving, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("moving tags", func() {
+
+	It("finds moving tags using the default patterns", func() {
+		p := Successful(LoadComposerProject("testdata/composer/hellorld"))
+		Expect(p.MovingTags(DefaultMovingTags)).To(HaveExactElements(
+			MovingTag{Service: "bar", Image: "alpine:edge", Tag: "edge"},
+			MovingTag{Service: "baz", Image: "alpine:edge", Tag: "edge"},
+			MovingTag{Service: "foo", Image: "busybox:stable", Tag: "stable"},
+		))
+		Expect(MovingTag{Service: "foo", Image: "busybox:stable", Tag: "stable"}.String()).To(
+			Equal(`service "foo" image "busybox:stable" uses moving tag "stable"`))
+	})
+
+	It("uses configurable tag patterns", func() {
+		p := testProjectWith("image", map[string]string{
+			"foo": "busybox:nightly-20231024",
+			"bar": "busybox:1.36",
+			"baz": "busybox:stable",
+			"qux": "busybox:nightly@sha256:" + strings.Repeat("0", 64),
+			"zoo": "busybox@sha256:" + strings.Repeat("0", 64),
+		})
+		Expect(p.MovingTags([]string{"nightly*", "1.*"})).To(HaveExactElements(
+			MovingTag{Service: "bar", Image: "busybox:1.36", Tag: "1.36"},
+			MovingTag{Service: "foo", Image: "busybox:nightly-20231024", Tag: "nightly-20231024"},
+		))
+		Expect(p.MovingTags(nil)).To(BeEmpty())
+	})
+
+	It("rejects invalid patterns and projects", func() {
+		Expect(testProjectWith[string]("image", nil).MovingTags([]string{"["})).Error().To(
+			MatchError(ContainSubstring("invalid moving tag pattern")))
+		Expect((&ComposerProject{}).MovingTags(nil)).Error().To(
+			MatchError(ContainSubstring("no services found")))
+		Expect(testProjectWith("image", map[string]string{"foo": "Busybox"}).MovingTags(nil)).Error().To(
+			MatchError(ContainSubstring("invalid image reference")))
+	})
+
+})
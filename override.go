@@ -0,0 +1,97 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// composerOverrideFiles lists the composer project override file names
+// picked up automatically by LoadComposerProjectWithOverrides.
+var composerOverrideFiles = []string{
+	"docker-compose.override.yaml",
+	"docker-compose.override.yml",
+}
+
+// LoadComposerProjectWithOverrides works like LoadComposerProject, but
+// additionally merges override files into the composer project, similar to
+// Docker's composer. If no “extra” override files are specified, it picks up
+// a “docker-compose.override.yml” (or “.yaml”) in the same directory, if
+// present. Otherwise, it merges the specified override files in order,
+// with relative paths being relative to “dir”.
+//
+// Merging follows Docker's composer semantics: maps get merged, while
+// scalars and sequences get replaced. The usual checks, such as rejecting
+// “latest” images and enforcing mem_limit, apply to the merged project.
+func LoadComposerProjectWithOverrides(dir string, extra ...string) (*ComposerProject, error) {
+	name, err := findComposerFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	projectYAML, err := loadComposerYAML(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make([]string, 0, len(extra))
+	for _, override := range extra {
+		if !filepath.IsAbs(override) {
+			override = filepath.Join(dir, override)
+		}
+		overrides = append(overrides, override)
+	}
+	if len(extra) == 0 {
+		for _, overrideFilename := range composerOverrideFiles {
+			override := filepath.Join(dir, overrideFilename)
+			if _, err := os.Stat(override); err == nil {
+				overrides = append(overrides, override)
+				break
+			}
+		}
+	}
+	for _, override := range overrides {
+		overrideYAML, err := loadComposerYAML(override, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load composer project override %q, reason: %w",
+				override, err)
+		}
+		projectYAML = mergeOverride(projectYAML, overrideYAML)
+	}
+	p := &ComposerProject{yaml: projectYAML}
+	if err := p.applyExtension(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// mergeOverride deep-merges the override map into the base map, returning
+// the merged map: maps get merged recursively, while scalars and sequences in
+// the override replace those in the base.
+func mergeOverride(base map[string]any, override map[string]any) map[string]any {
+	if base == nil {
+		base = map[string]any{}
+	}
+	for key, value := range override {
+		overrideMap, isMap := value.(map[string]any)
+		baseMap, isBaseMap := base[key].(map[string]any)
+		if isMap && isBaseMap {
+			base[key] = mergeOverride(baseMap, overrideMap)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("composer project overrides", func() {
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("merges the default override file", func() {
+		p := Successful(LoadComposerProjectWithOverrides("testdata/override"))
+		Expect(p.Images()).To(Equal(ServiceImages{
+			"web":      "busybox:1.37",
+			"sidekick": "alpine:3.18",
+		}))
+		web := p.yaml["services"].(map[string]any)["web"]
+		Expect(web).To(HaveKeyWithValue("mem_limit", "10mb"))
+		Expect(web).To(HaveKeyWithValue("ports", ConsistOf("8081:80")))
+		Expect(web).To(HaveKeyWithValue("environment", map[string]any{
+			"FOO": "foo",
+			"BAR": "baz",
+		}))
+	})
+
+	It("merges explicitly specified override files", func() {
+		p := Successful(LoadComposerProjectWithOverrides("testdata/override", "latest.yml"))
+		Expect(p.yaml["services"]).NotTo(HaveKey("sidekick"))
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("attempts to use latest tag")))
+
+		p = Successful(LoadComposerProjectWithOverrides("testdata/override",
+			"docker-compose.override.yml", "nomemlimit.yml"))
+		Expect(p.Images()).Error().To(MatchError(ContainSubstring("lacks mem_limit")))
+	})
+
+	It("reports missing project and override files", func() {
+		Expect(LoadComposerProjectWithOverrides("testdata/nada-nothing-nil")).Error().To(
+			MatchError(ContainSubstring("no composer project file found")))
+		Expect(LoadComposerProjectWithOverrides("testdata/override", "nada.yml")).Error().To(
+			MatchError(ContainSubstring("cannot load composer project override")))
+	})
+
+	It("merges maps and replaces everything else", func() {
+		Expect(mergeOverride(nil, map[string]any{"foo": 42})).To(Equal(map[string]any{"foo": 42}))
+		Expect(mergeOverride(
+			map[string]any{"foo": map[string]any{"bar": 1, "baz": []any{1}}, "qux": "a"},
+			map[string]any{"foo": map[string]any{"baz": []any{2}}, "qux": map[string]any{"x": 1}},
+		)).To(Equal(map[string]any{
+			"foo": map[string]any{"bar": 1, "baz": []any{2}},
+			"qux": map[string]any{"x": 1},
+		}))
+	})
+
+})
@@ -0,0 +1,72 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// gzipMagic are the first two bytes of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressed returns a reader transparently decompressing the data from the
+// specified reader if it is gzip-compressed, as detected by sniffing for the
+// gzip magic; otherwise, the returned reader passes the data through as is.
+// decompressed additionally reports whether the data is gzip-compressed.
+func decompressed(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); string(magic) != string(gzipMagic) {
+		return br, false, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, false, err
+	}
+	return gz, true, nil
+}
+
+// packageReader reads the tar entries of an IE app package, transparently
+// decompressing gzip'ed app packages.
+type packageReader struct {
+	*tar.Reader
+	f       *os.File
+	gzipped bool // app package is gzip'ed
+}
+
+// openPackage opens the IE app package at the specified path for reading its
+// tar entries, regardless of whether the package has been gzip'ed using
+// WithGzip or not. The caller is responsible for closing the package reader
+// when done with it.
+func openPackage(pkgPath string) (*packageReader, error) {
+	f, err := os.Open(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	r, gzipped, err := decompressed(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &packageReader{Reader: tar.NewReader(r), f: f, gzipped: gzipped}, nil
+}
+
+// Close closes the underlying app package file.
+func (p *packageReader) Close() error {
+	return p.f.Close()
+}
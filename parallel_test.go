@@ -0,0 +1,186 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("pulling images in parallel", Serial, func() {
+
+	var host string
+	var cancelled chan struct{}
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		// Requests for the “slow” repository block until the client gives
+		// up, so we can see pulls getting cancelled.
+		cancelled = make(chan struct{})
+		cancel := sync.OnceFunc(func() { close(cancelled) })
+		reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/slow/") {
+				select {
+				case <-r.Context().Done():
+					cancel()
+				case <-time.After(10 * time.Second):
+				}
+				return
+			}
+			reg.ServeHTTP(w, r)
+		}))
+		DeferCleanup(srv.Close)
+		host = strings.TrimPrefix(srv.URL, "http://")
+	})
+
+	push := func(imageRef string) string {
+		GinkgoHelper()
+		image := Successful(random.Image(1024, 1))
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+		return Successful(image.Digest()).String()
+	}
+
+	It("pulls a two-image project", func(ctx context.Context) {
+		fooRef := host + "/hellorld/foo:1.0"
+		barRef := host + "/hellorld/bar:1.0"
+		fooDigest := push(fooRef)
+		barDigest := push(barRef)
+
+		p := &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": fooRef, "bar": barRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithConcurrency(2))).To(Succeed())
+		Expect(p.SavedImages()).To(HaveExactElements(
+			And(HaveField("Ref", barRef), HaveField("Digest", barDigest)),
+			And(HaveField("Ref", fooRef), HaveField("Digest", fooDigest)),
+		))
+	})
+
+	It("reports progress for each image", func(ctx context.Context) {
+		fooRef := host + "/hellorld/foo:1.0"
+		barRef := host + "/hellorld/bar:1.0"
+		push(fooRef)
+		push(barRef)
+
+		var mu sync.Mutex
+		var events []PullProgress
+		progress := func(p PullProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, p)
+		}
+
+		p := &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": fooRef, "bar": barRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithConcurrency(2), WithProgress(progress))).To(Succeed())
+		for _, ref := range []string{fooRef, barRef} {
+			Expect(events).To(ContainElement(And(
+				HaveField("Ref", ref), HaveField("State", PullStarted))))
+			Expect(events).To(ContainElement(And(
+				HaveField("Ref", ref), HaveField("State", PullSaved),
+				HaveField("Bytes", BeNumerically(">", 1024)))))
+		}
+	})
+
+	When("pulling by dependencies", func() {
+
+		It("pulls in depends_on order", func(ctx context.Context) {
+			webRef := host + "/hellorld/a-web:1.0"
+			apiRef := host + "/hellorld/b-api:1.0"
+			dbRef := host + "/hellorld/c-db:1.0"
+			extraRef := host + "/hellorld/0-extra:1.0"
+			for _, ref := range []string{webRef, apiRef, dbRef, extraRef} {
+				push(ref)
+			}
+
+			var started []string
+			progress := func(p PullProgress) {
+				if p.State == PullStarted {
+					started = append(started, p.Ref)
+				}
+			}
+
+			p := &ComposerProject{
+				yaml: map[string]any{
+					"services": map[string]any{
+						"web": map[string]any{"depends_on": []any{"api"}},
+						"api": map[string]any{"depends_on": map[string]any{
+							"db": map[string]any{"condition": "service_healthy"},
+						}},
+						"db": map[string]any{},
+					},
+				},
+				extraImages: []string{extraRef},
+			}
+			Expect(p.PullImages(ctx, ServiceImages{"web": webRef, "api": apiRef, "db": dbRef},
+				"linux/amd64", GinkgoT().TempDir(), nil, WithDependencyOrder(), WithConcurrency(1), WithProgress(progress))).To(Succeed())
+			Expect(started).To(HaveExactElements(dbRef, apiRef, webRef, extraRef))
+			Expect(p.SavedImages()).To(HaveExactElements(
+				HaveField("Ref", extraRef),
+				HaveField("Ref", webRef),
+				HaveField("Ref", apiRef),
+				HaveField("Ref", dbRef),
+			))
+		})
+
+		It("reports depends_on cycles", func(ctx context.Context) {
+			p := &ComposerProject{
+				yaml: map[string]any{
+					"services": map[string]any{
+						"foo": map[string]any{"depends_on": []any{"bar"}},
+						"bar": map[string]any{"depends_on": []any{"baz"}},
+						"baz": map[string]any{"depends_on": []any{"foo"}},
+						"qux": map[string]any{},
+					},
+				},
+			}
+			Expect(p.PullImages(ctx, ServiceImages{"foo": host + "/hellorld/foo:1.0"},
+				"linux/amd64", GinkgoT().TempDir(), nil, WithDependencyOrder())).To(MatchError(
+				ContainSubstring(`services ["bar" "baz" "foo"] have cyclic depends_on dependencies`)))
+		})
+
+	})
+
+	It("cancels other pulls when a pull fails", func(ctx context.Context) {
+		slowRef := host + "/slow/app:1.0"
+		missingRef := host + "/hellorld/missing:1.0"
+
+		p := &ComposerProject{}
+		start := time.Now()
+		Expect(p.PullImages(ctx, ServiceImages{"slow": slowRef, "missing": missingRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithConcurrency(2))).To(MatchError(
+			ContainSubstring(`cannot pull and save image "` + missingRef + `"`)))
+		Eventually(cancelled).Should(BeClosed())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(p.SavedImages()).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,76 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// CheckPermissions checks the staged files and directories for setuid,
+// setgid, and sticky bits, as well as for world-writable permissions,
+// returning an error listing all offending paths. It ignores symbolic links,
+// as these don't have permissions of their own. CheckPermissions should be
+// called right before Package.
+func (a *App) CheckPermissions() error {
+	return checkPermissions(a.tmpDir)
+}
+
+// checkPermissions checks the files and directories inside the specified
+// root directory for insecure permissions.
+func checkPermissions(root string) error {
+	var problems []string
+	err := fs.WalkDir(os.DirFS(root), ".", func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." || dirEntry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		var smells []string
+		mode := info.Mode()
+		if mode&fs.ModeSetuid != 0 {
+			smells = append(smells, "setuid")
+		}
+		if mode&fs.ModeSetgid != 0 {
+			smells = append(smells, "setgid")
+		}
+		if mode&fs.ModeSticky != 0 {
+			smells = append(smells, "sticky")
+		}
+		if mode.Perm()&0002 != 0 {
+			smells = append(smells, "world-writable")
+		}
+		if len(smells) > 0 {
+			problems = append(problems, fmt.Sprintf("%s is %s (%s)",
+				path, strings.Join(smells, ", "), mode))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot check permissions, reason: %w", err)
+	}
+	if len(problems) > 0 {
+		return errors.New("insecure permissions: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("insecure permissions", func() {
+
+	var a *App
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		a = Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+	})
+
+	chmod := func(path string, mode os.FileMode) {
+		GinkgoHelper()
+		Expect(os.Chmod(filepath.Join(a.tmpDir, path), mode)).To(Succeed())
+	}
+
+	It("accepts secure permissions", func() {
+		Expect(os.Symlink("appicon.png", filepath.Join(a.tmpDir, a.repo, "link.png"))).To(Succeed())
+		Expect(a.CheckPermissions()).To(Succeed())
+	})
+
+	It("reports offending files and directories", func() {
+		chmod("detail.json", 0666)
+		chmod("hellorld/appicon.png", 0644|os.ModeSetuid|os.ModeSetgid)
+		chmod("hellorld", 0777|os.ModeSticky)
+		Expect(a.CheckPermissions()).To(MatchError(
+			"insecure permissions: " +
+				"detail.json is world-writable (-rw-rw-rw-); " +
+				"hellorld is sticky, world-writable (dtrwxrwxrwx); " +
+				"hellorld/appicon.png is setuid, setgid (ugrw-r--r--)"))
+	})
+
+	It("reports unreadable stages", func() {
+		Expect(checkPermissions("testdata/nada-nothing-nil")).To(
+			MatchError(ContainSubstring("cannot check permissions")))
+	})
+
+})
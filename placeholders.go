@@ -0,0 +1,60 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPlaceholderFields lists the “detail.json” fields that app templates
+// must leave empty (or absent), as tiap fills them in.
+var DefaultPlaceholderFields = []string{"versionNumber", "versionId"}
+
+// CheckPlaceholders checks that the app template's “detail.json” leaves the
+// specified fields empty or absent, so that template authors don't fill in
+// fields prematurely that tiap later overwrites anyway. CheckPlaceholders
+// checks the template itself, not the staged copy, so it can be called any
+// time, and also when resuming.
+func (a *App) CheckPlaceholders(fields []string) error {
+	return checkPlaceholders(filepath.Join(a.sourcePath, DetailsFile), fields)
+}
+
+// checkPlaceholders checks that the “detail.json” at the specified path
+// leaves the specified fields empty or absent.
+func checkPlaceholders(path string, fields []string) error {
+	details, err := readDetails(path)
+	if err != nil {
+		return err
+	}
+	var filled []string
+	for _, field := range fields {
+		switch value := details[field].(type) {
+		case nil:
+			continue
+		case string:
+			if value == "" {
+				continue
+			}
+		}
+		filled = append(filled, fmt.Sprintf("%q", field))
+	}
+	if len(filled) > 0 {
+		return fmt.Errorf("app template detail.json must leave placeholder fields empty, but fills %s",
+			strings.Join(filled, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("detail.json placeholders", func() {
+
+	It("accepts a conforming template", func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		defer a.Done()
+		Expect(a.CheckPlaceholders(DefaultPlaceholderFields)).To(Succeed())
+	})
+
+	It("rejects a non-conforming template", func() {
+		Expect(checkPlaceholders("testdata/details/filled/detail.json", DefaultPlaceholderFields)).To(
+			MatchError(HaveSuffix(`but fills "versionNumber"`)))
+		Expect(checkPlaceholders("testdata/details/filled/detail.json",
+			[]string{"versionId", "description", "releaseNotes", "title", "nada"})).To(
+			MatchError(HaveSuffix(`but fills "releaseNotes", "title"`)))
+	})
+
+	It("reports unreadable detail.json", func() {
+		Expect(checkPlaceholders("testdata/details/malformed/detail.json", nil)).To(
+			MatchError(ContainSubstring("malformed detail.json")))
+	})
+
+})
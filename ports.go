@@ -0,0 +1,225 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hostPorts is a published host port or range of host ports, optionally bound
+// to a specific host IP.
+type hostPorts struct {
+	ip       string // empty if unspecified, that is, all host IPs.
+	first    uint16
+	last     uint16
+	protocol string
+}
+
+func (h hostPorts) String() string {
+	s := strconv.Itoa(int(h.first))
+	if h.last != h.first {
+		s += "-" + strconv.Itoa(int(h.last))
+	}
+	s += "/" + h.protocol
+	if h.ip != "" {
+		s = h.ip + ":" + s
+	}
+	return s
+}
+
+// overlap returns the host ports published by both host port ranges, and
+// false if both can be published at the same time. Instead of expanding port
+// ranges into individual ports, overlap simply intersects the ranges.
+func (h hostPorts) overlap(other hostPorts) (hostPorts, bool) {
+	if h.protocol != other.protocol ||
+		(h.ip != "" && other.ip != "" && h.ip != other.ip) {
+		return hostPorts{}, false
+	}
+	first, last := max(h.first, other.first), min(h.last, other.last)
+	if first > last {
+		return hostPorts{}, false
+	}
+	ip := h.ip
+	if ip == "" {
+		ip = other.ip
+	}
+	return hostPorts{ip: ip, first: first, last: last, protocol: h.protocol}, true
+}
+
+// CheckPorts checks that no two services publish the same host port, and that
+// no service publishes the same host port multiple times, returning an error
+// listing all conflicts found. CheckPorts understands both the short string
+// syntax as well as the long syntax of compose port declarations; it ignores
+// ports without a published host port, as these get ephemeral host ports
+// assigned at deployment time.
+func (p *ComposerProject) CheckPorts() error {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return fmt.Errorf("no services found, reason: %w", err)
+	}
+	type publication struct {
+		service string
+		ports   hostPorts
+	}
+	var published []publication
+	var conflicts []string
+	for _, serviceName := range slices.Sorted(maps.Keys(services)) {
+		config, ok := services[serviceName].(map[string]any)
+		if !ok {
+			return fmt.Errorf("invalid service %q, reason: not an associative array", serviceName)
+		}
+		element, ok := config["ports"]
+		if !ok {
+			continue
+		}
+		ports, ok := element.([]any)
+		if !ok {
+			return fmt.Errorf("invalid ports in service %q, reason: not a list", serviceName)
+		}
+		for _, port := range ports {
+			hp, err := parseHostPorts(port)
+			if err != nil {
+				return fmt.Errorf("invalid port in service %q, reason: %w", serviceName, err)
+			}
+			if hp == nil {
+				continue
+			}
+			for _, other := range published {
+				overlap, ok := other.ports.overlap(*hp)
+				if !ok {
+					continue
+				}
+				if other.service == serviceName {
+					conflicts = append(conflicts, fmt.Sprintf(
+						"service %q publishes host port %s more than once",
+						serviceName, overlap))
+					continue
+				}
+				conflicts = append(conflicts, fmt.Sprintf(
+					"services %q and %q both publish host port %s",
+					other.service, serviceName, overlap))
+			}
+			published = append(published, publication{service: serviceName, ports: *hp})
+		}
+	}
+	if len(conflicts) > 0 {
+		return errors.New(strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// parseHostPorts returns the host ports published by the specified compose
+// port declaration in either short or long syntax, or nil if the declaration
+// doesn't publish any host port.
+func parseHostPorts(port any) (*hostPorts, error) {
+	switch port := port.(type) {
+	case int:
+		return nil, nil // container port only
+	case string:
+		return parseShortHostPorts(port)
+	case map[string]any:
+		return parseLongHostPorts(port)
+	}
+	return nil, fmt.Errorf("unsupported port declaration %v", port)
+}
+
+// parseShortHostPorts parses the short port syntax in form of
+// “[[IP:][HOST-PORT(S)]:]CONTAINER-PORT(S)[/PROTOCOL]”.
+func parseShortHostPorts(port string) (*hostPorts, error) {
+	spec, protocol, ok := strings.Cut(port, "/")
+	if !ok {
+		protocol = "tcp"
+	}
+	ip := ""
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid IPv6 address in port %q", port)
+		}
+		ip, spec = spec[1:end], spec[end+2:]
+	}
+	fields := strings.Split(spec, ":")
+	var published string
+	switch len(fields) {
+	case 1:
+		return nil, nil // container port(s) only
+	case 2:
+		published = fields[0]
+	case 3:
+		if ip != "" {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		ip, published = fields[0], fields[1]
+	default:
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return newHostPorts(ip, published, protocol)
+}
+
+// parseLongHostPorts parses the long port syntax with its “published”,
+// “host_ip”, and “protocol” elements.
+func parseLongHostPorts(port map[string]any) (*hostPorts, error) {
+	var published string
+	switch p := port["published"].(type) {
+	case nil:
+		return nil, nil // container port only
+	case int:
+		published = strconv.Itoa(p)
+	case string:
+		published = p
+	default:
+		return nil, fmt.Errorf("invalid published port %v", p)
+	}
+	ip, _ := port["host_ip"].(string)
+	protocol, _ := port["protocol"].(string)
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return newHostPorts(ip, published, protocol)
+}
+
+// newHostPorts returns the host ports for a single published port or a port
+// range “FROM-TO”, or nil if there is no published port.
+func newHostPorts(ip string, published string, protocol string) (*hostPorts, error) {
+	if published == "" {
+		return nil, nil // ephemeral host port
+	}
+	if ip == "0.0.0.0" || ip == "::" {
+		ip = ""
+	}
+	from, to, isRange := strings.Cut(published, "-")
+	first, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid published port %q", published)
+	}
+	last := first
+	if isRange {
+		last, err = strconv.ParseUint(to, 10, 16)
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid published port range %q", published)
+		}
+	}
+	return &hostPorts{
+		ip:       ip,
+		first:    uint16(first),
+		last:     uint16(last),
+		protocol: strings.ToLower(protocol),
+	}, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("published ports", func() {
+
+	DescribeTable("parsing host ports",
+		func(port any, expected *hostPorts) {
+			Expect(parseHostPorts(port)).To(Equal(expected))
+		},
+		Entry("container port only", 80, nil),
+		Entry("container port only string", "80", nil),
+		Entry("ephemeral host port", "127.0.0.1::80", nil),
+		Entry("host port", "8080:80", &hostPorts{first: 8080, last: 8080, protocol: "tcp"}),
+		Entry("host port with protocol", "8080:80/UDP", &hostPorts{first: 8080, last: 8080, protocol: "udp"}),
+		Entry("host IP and port", "127.0.0.1:8080:80",
+			&hostPorts{ip: "127.0.0.1", first: 8080, last: 8080, protocol: "tcp"}),
+		Entry("IPv6 host IP and port", "[::1]:8080:80",
+			&hostPorts{ip: "::1", first: 8080, last: 8080, protocol: "tcp"}),
+		Entry("any host IP", "0.0.0.0:8080:80", &hostPorts{first: 8080, last: 8080, protocol: "tcp"}),
+		Entry("host port range", "8080-8081:80-81",
+			&hostPorts{first: 8080, last: 8081, protocol: "tcp"}),
+		Entry("long syntax without published port", map[string]any{"target": 80}, nil),
+		Entry("long syntax", map[string]any{"target": 80, "published": 8080},
+			&hostPorts{first: 8080, last: 8080, protocol: "tcp"}),
+		Entry("long syntax with string port", map[string]any{
+			"target": 80, "published": "8080", "host_ip": "127.0.0.1", "protocol": "udp"},
+			&hostPorts{ip: "127.0.0.1", first: 8080, last: 8080, protocol: "udp"}),
+	)
+
+	DescribeTable("rejecting invalid ports",
+		func(port any) {
+			Expect(parseHostPorts(port)).Error().To(HaveOccurred())
+		},
+		Entry(nil, 3.14),
+		Entry(nil, "1:2:3:4"),
+		Entry(nil, "[::1:80:80"),
+		Entry(nil, "[::1]:127.0.0.1:80:80"),
+		Entry(nil, "foo:80"),
+		Entry(nil, "8081-8080:80"),
+		Entry(nil, "8080-foo:80"),
+		Entry(nil, "65536:80"),
+		Entry(nil, map[string]any{"published": 3.14}),
+	)
+
+	It("accepts non-conflicting ports", func() {
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"8080:80", "8080:80/udp", 81},
+			"bar": {"127.0.0.1:8081:80", map[string]any{"target": 80, "published": "8082"}},
+			"baz": {"127.0.0.2:8081:80", "80"},
+		}).CheckPorts()).To(Succeed())
+		Expect(Successful(LoadComposerProject("testdata/app/hellorld")).CheckPorts()).To(Succeed())
+	})
+
+	It("reports conflicting ports", func() {
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"8080:80"},
+			"bar": {map[string]any{"target": 80, "published": 8080}},
+		}).CheckPorts()).To(MatchError(
+			`services "bar" and "foo" both publish host port 8080/tcp`))
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"127.0.0.1:8080:80"},
+			"bar": {"8079-8081:80-82"},
+		}).CheckPorts()).To(MatchError(
+			`services "bar" and "foo" both publish host port 127.0.0.1:8080/tcp`))
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"8000-8100:8000-8100"},
+			"bar": {"8090-8200:8090-8200", "8090:80/udp"},
+		}).CheckPorts()).To(MatchError(
+			`services "bar" and "foo" both publish host port 8090-8100/tcp`))
+	})
+
+	It("reports ports published multiple times by the same service", func() {
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"8080:80", "127.0.0.1:8080:81"},
+		}).CheckPorts()).To(MatchError(
+			`service "foo" publishes host port 127.0.0.1:8080/tcp more than once`))
+	})
+
+	It("checks huge port ranges without expanding them", func() {
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"1-65535:1-65535"},
+			"bar": {"1-65535:1-65535/udp"},
+		}).CheckPorts()).To(Succeed())
+	})
+
+	It("reports invalid services and ports", func() {
+		Expect((&ComposerProject{}).CheckPorts()).Error().To(HaveOccurred())
+		Expect((&ComposerProject{yaml: map[string]any{
+			"services": map[string]any{"foo": 42},
+		}}).CheckPorts()).To(MatchError(ContainSubstring("invalid service")))
+		Expect((&ComposerProject{yaml: map[string]any{
+			"services": map[string]any{"foo": map[string]any{"ports": 42}},
+		}}).CheckPorts()).To(MatchError(ContainSubstring("invalid ports")))
+		Expect(testProjectWith("ports", map[string][]any{
+			"foo": {"foo:80"},
+		}).CheckPorts()).To(MatchError(ContainSubstring("invalid port in service")))
+	})
+
+})
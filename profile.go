@@ -0,0 +1,74 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/go-units"
+)
+
+// DeviceProfile bundles the package limits appropriate for a class of
+// Industrial Edge devices.
+type DeviceProfile struct {
+	MaxSize  int64 // maximum app package file size in bytes.
+	MaxFiles int   // maximum number of files in the app package.
+}
+
+// DeviceProfiles maps the names of the known device profiles to their limits.
+var DeviceProfiles = map[string]DeviceProfile{
+	"small": {MaxSize: 512 * units.MiB, MaxFiles: 1000},
+	"large": {MaxSize: 4 * units.GiB, MaxFiles: 10000},
+}
+
+// Check checks the app package file at the specified path against the limits
+// of this device profile, returning an error if the package violates any of
+// them.
+func (d DeviceProfile) Check(out string) error {
+	tarrer, err := openPackage(out)
+	if err != nil {
+		return fmt.Errorf("cannot check IE app package, reason: %w", err)
+	}
+	defer tarrer.Close()
+	info, err := tarrer.f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot check IE app package, reason: %w", err)
+	}
+	if info.Size() > d.MaxSize {
+		return fmt.Errorf("IE app package size of %s exceeds device profile maximum of %s",
+			units.BytesSize(float64(info.Size())), units.BytesSize(float64(d.MaxSize)))
+	}
+	files := 0
+	for {
+		header, err := tarrer.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot check IE app package, reason: %w", err)
+		}
+		if header.Typeflag != tar.TypeDir {
+			files++
+		}
+	}
+	if files > d.MaxFiles {
+		return fmt.Errorf("IE app package with %d files exceeds device profile maximum of %d files",
+			files, d.MaxFiles)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("device profiles", func() {
+
+	var out string
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		defer a.Done()
+		out = filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out)).To(Succeed())
+	})
+
+	It("accepts packages within the profile limits", func() {
+		Expect(DeviceProfiles["small"].Check(out)).To(Succeed())
+		Expect(DeviceProfiles["large"].Check(out)).To(Succeed())
+	})
+
+	It("rejects packages exceeding the profile size", func() {
+		Expect(DeviceProfile{MaxSize: 1024, MaxFiles: 1000}.Check(out)).To(
+			MatchError(ContainSubstring("exceeds device profile maximum of 1KiB")))
+	})
+
+	It("rejects packages exceeding the profile file count", func() {
+		Expect(DeviceProfile{MaxSize: units.GiB, MaxFiles: 2}.Check(out)).To(
+			MatchError(ContainSubstring("with 4 files exceeds device profile maximum of 2 files")))
+	})
+
+	It("reports unreadable packages", func() {
+		Expect(DeviceProfiles["small"].Check("testdata/nada-nothing-nil.app")).To(
+			MatchError(ContainSubstring("cannot check IE app package")))
+		garbage := filepath.Join(GinkgoT().TempDir(), "garbage.app")
+		Expect(os.WriteFile(garbage, []byte("garbage"), 0666)).To(Succeed())
+		Expect(DeviceProfiles["small"].Check(garbage)).To(
+			MatchError(ContainSubstring("cannot check IE app package")))
+	})
+
+})
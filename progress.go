@@ -0,0 +1,81 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"io"
+	"time"
+)
+
+// PullState is the state of pulling and saving a single image, as reported to
+// a ProgressFunc.
+type PullState int
+
+const (
+	PullStarted      PullState = iota // started pulling and saving the image
+	PullTransferring                  // still writing the image file
+	PullSaved                         // image file completely written
+	PullSkipped                       // image had already been saved before
+)
+
+// PullProgress describes the progress of pulling and saving a single image.
+type PullProgress struct {
+	Ref      string        // image reference
+	State    PullState     // what is happening
+	Bytes    int64         // bytes written so far; the saved size when done
+	Duration time.Duration // time elapsed since the pull started
+}
+
+// ProgressFunc receives progress updates while pulling and saving images.
+// Please note that a ProgressFunc gets called concurrently when pulling
+// images in parallel.
+type ProgressFunc func(PullProgress)
+
+// progressInterval throttles PullTransferring updates.
+const progressInterval = time.Second
+
+// report calls the progress function, if any, with the specified update.
+func (fn ProgressFunc) report(ref string, state PullState, bytes int64, start time.Time) {
+	if fn == nil {
+		return
+	}
+	fn(PullProgress{
+		Ref:      ref,
+		State:    state,
+		Bytes:    bytes,
+		Duration: time.Since(start),
+	})
+}
+
+// progressWriter counts the bytes written to the underlying writer and
+// reports them in regular intervals as PullTransferring updates.
+type progressWriter struct {
+	w        io.Writer
+	ref      string
+	progress ProgressFunc
+	start    time.Time
+	last     time.Time
+	written  int64
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	if now := time.Now(); now.Sub(pw.last) >= progressInterval {
+		pw.last = now
+		pw.progress.report(pw.ref, PullTransferring, pw.written, pw.start)
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+// testProject returns a new composer project consisting only of the specified
+// services with their service configurations.
+func testProject(services map[string]map[string]any) *ComposerProject {
+	svcs := map[string]any{}
+	for serviceName, config := range services {
+		svcs[serviceName] = config
+	}
+	return &ComposerProject{yaml: map[string]any{"services": svcs}}
+}
+
+// testProjectWith returns a new composer project consisting only of services
+// with a single configuration element, as specified by the per-service values.
+// Services with a nil value get an empty configuration instead.
+func testProjectWith[V any](element string, values map[string]V) *ComposerProject {
+	services := map[string]map[string]any{}
+	for serviceName, value := range values {
+		config := map[string]any{}
+		if any(value) != nil {
+			config[element] = value
+		}
+		services[serviceName] = config
+	}
+	return testProject(services)
+}
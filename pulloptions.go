@@ -0,0 +1,80 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import "time"
+
+// PullOptions controls how SaveImageToFile and PullImages pull and save
+// images. Some options also apply to other functions accessing registries,
+// such as PinImageDigests.
+type PullOptions struct {
+	Progress        ProgressFunc   // receives progress updates, if non-nil
+	Compress        bool           // write gzip-compressed image tar-balls
+	Auth            []RegistryAuth // explicit registry credentials
+	RegistryDigests bool           // resolve digests of resumed images in their registry
+	Concurrency     int            // max. number of images to pull in parallel, if positive
+	ByDependencies  bool           // pull in “depends_on” order instead of alphabetically
+	Mirror          string         // registry to mirror pulled images to, if non-empty
+	CacheDir        string         // image cache directory, if non-empty
+	Retries         int            // number of retries after transient failures
+	RetryDelay      time.Duration  // initial delay before retrying
+}
+
+// PullOption sets an option for SaveImageToFile and PullImages.
+type PullOption func(*PullOptions)
+
+// WithProgress reports the progress of pulling and saving images to the
+// specified progress function.
+func WithProgress(progress ProgressFunc) PullOption {
+	return func(o *PullOptions) { o.Progress = progress }
+}
+
+// WithCompression writes gzip-compressed image tar-balls with a “.tar.gz”
+// extension instead of uncompressed “.tar” image tar-balls, resulting in
+// smaller app packages. While “docker load” accepts gzip-compressed image
+// tar-balls, please check that your Industrial Edge version accepts them too
+// before shipping such app packages.
+func WithCompression() PullOption {
+	return func(o *PullOptions) { o.Compress = true }
+}
+
+// WithConcurrency limits how many images PullImages pulls and saves in
+// parallel. Zero or a negative number means the default of the number of
+// CPUs, but at most 4.
+func WithConcurrency(n int) PullOption {
+	return func(o *PullOptions) { o.Concurrency = n }
+}
+
+// WithRegistryDigests resolves the digests of images not freshly pulled, such
+// as when resuming or using the image cache or the local daemon, in their
+// registries. This keeps the digests of saved images stable, as required for
+// WriteImageDigests and SBOMs, at the cost of a registry request per image.
+// Without this option, such images get the digests of their local manifests.
+func WithRegistryDigests() PullOption {
+	return func(o *PullOptions) { o.RegistryDigests = true }
+}
+
+// pullOptions returns the pull options after applying the specified options to
+// the defaults.
+func pullOptions(opts []PullOption) PullOptions {
+	options := PullOptions{
+		Retries:    DefaultPullRetries,
+		RetryDelay: DefaultPullRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
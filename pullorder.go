@@ -0,0 +1,119 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// WithDependencyOrder pulls the images of services in the topological order
+// of their “depends_on” dependencies, so that the images of services other
+// services depend on get pulled first. Otherwise, PullImages pulls the images
+// in the alphabetical order of their references. Extra images are always
+// pulled last. Please note that when pulling images in parallel, see
+// WithConcurrency, pulls of independent images still overlap.
+func WithDependencyOrder() PullOption {
+	return func(o *PullOptions) { o.ByDependencies = true }
+}
+
+// serviceOrder returns the names of the project's services in topological
+// order of their “depends_on” dependencies, breaking ties alphabetically. It
+// returns an error if the dependencies form a cycle.
+func (p *ComposerProject) serviceOrder() ([]string, error) {
+	services, err := lookupMap(p.yaml, "services")
+	if err != nil {
+		return nil, fmt.Errorf("no services found, reason: %w", err)
+	}
+	// Count the dependencies of each service still unresolved, as well as
+	// note the services depending on each service.
+	pending := map[string]int{}
+	dependents := map[string][]string{}
+	for name := range services {
+		pending[name] = 0
+	}
+	for name := range services {
+		config, _ := lookupMap(services, name)
+		for _, dep := range dependencies(config) {
+			if _, ok := services[dep]; !ok {
+				continue // not our business here, see SelectProfiles.
+			}
+			pending[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	var order []string
+	for len(pending) > 0 {
+		var ready []string
+		for name, count := range pending {
+			if count == 0 {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			return nil, fmt.Errorf("services %q have cyclic depends_on dependencies",
+				slices.Sorted(maps.Keys(pending)))
+		}
+		slices.Sort(ready)
+		for _, name := range ready {
+			delete(pending, name)
+			for _, dependent := range dependents[name] {
+				pending[dependent]--
+			}
+		}
+		order = append(order, ready...)
+	}
+	return order, nil
+}
+
+// pullOrder returns the unique image references of the specified service
+// images as well as of the project's extra images in the order to pull them,
+// optionally by dependencies, see WithDependencyOrder.
+func (p *ComposerProject) pullOrder(serviceimgs ServiceImages, byDependencies bool) ([]string, error) {
+	uniqueImageRefs := map[string]nada{}
+	for _, imageRef := range serviceimgs {
+		uniqueImageRefs[imageRef] = nada{}
+	}
+	if !byDependencies {
+		for _, imageRef := range p.extraImages {
+			uniqueImageRefs[imageRef] = nada{}
+		}
+		return slices.Sorted(maps.Keys(uniqueImageRefs)), nil
+	}
+	services, err := p.serviceOrder()
+	if err != nil {
+		return nil, err
+	}
+	var imageRefs []string
+	add := func(imageRef string) {
+		if !slices.Contains(imageRefs, imageRef) {
+			imageRefs = append(imageRefs, imageRef)
+		}
+	}
+	for _, service := range services {
+		if imageRef, ok := serviceimgs[service]; ok {
+			add(imageRef)
+		}
+	}
+	// Service images not belonging to any of the project's services.
+	for _, imageRef := range slices.Sorted(maps.Keys(uniqueImageRefs)) {
+		add(imageRef)
+	}
+	for _, imageRef := range slices.Sorted(slices.Values(p.extraImages)) {
+		add(imageRef)
+	}
+	return imageRefs, nil
+}
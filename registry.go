@@ -0,0 +1,143 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// RegistryLimiter optionally paces all HTTP requests to (remote) registries
+// made while pulling images. It is shared by all image pulls, so that several
+// pulls in the same run don't overstep a registry's rate limit when added
+// together. A nil RegistryLimiter means no client-side rate limit.
+//
+// Independent of RegistryLimiter, any “Retry-After” sent by a registry
+// together with a “429 Too Many Requests” response is always honored.
+var RegistryLimiter *rate.Limiter
+
+// maxRetryAfterAttempts limits how often a single registry request gets
+// retried after the registry told us to come back later.
+const maxRetryAfterAttempts = 3
+
+// pacedTransport is an http.RoundTripper that waits on an (optional) rate
+// limiter before sending requests and that retries requests after the delay
+// indicated by a registry's “Retry-After” in “429 Too Many Requests”
+// responses.
+type pacedTransport struct {
+	limiter *rate.Limiter
+	inner   http.RoundTripper
+}
+
+var _ http.RoundTripper = (*pacedTransport)(nil)
+
+// newPacedTransport returns a new pacedTransport wrapping the specified inner
+// transport, using the currently configured RegistryLimiter.
+func newPacedTransport(inner http.RoundTripper) *pacedTransport {
+	return &pacedTransport{
+		limiter: RegistryLimiter,
+		inner:   inner,
+	}
+}
+
+// RoundTrip sends the specified request after waiting for the rate limiter (if
+// any), retrying when told by the registry to come back after a while. As
+// RoundTrip must not modify the caller's request, retries are sent using
+// clones of the original request with fresh bodies.
+func (t *pacedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	try := req
+	for attempt := 0; ; attempt++ {
+		if t.limiter != nil {
+			if err := t.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.inner.RoundTrip(try)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		// We can only retry requests without a body or with a body we can
+		// get afresh.
+		if attempt >= maxRetryAfterAttempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+		resp.Body.Close()
+		try = req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			try.Body = body
+		}
+		log.Warnf("⏳  registry rate limit hit, retrying %s in %s", req.URL.Host, delay)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter returns the delay indicated by the specified “Retry-After” header
+// value, relative to “now”. The header value can be either a number of seconds
+// or an HTTP date. The delay is capped at maxRetryDelay, so that a registry
+// cannot stall us for hours. If the header value is missing or invalid,
+// retryAfter returns false.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if secs, err := strconv.ParseUint(value, 10, 32); err == nil {
+		delay = time.Duration(secs) * time.Second
+	} else {
+		at, err := http.ParseTime(value)
+		if err != nil {
+			return 0, false
+		}
+		delay = max(at.Sub(now), 0)
+	}
+	return min(delay, maxRetryDelay), true
+}
+
+// sleep waits for the specified duration, unless the context gets cancelled
+// before.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// registryTransport returns the remote option for pacing registry requests.
+func registryTransport() remote.Option {
+	return remote.WithTransport(newPacedTransport(remote.DefaultTransport))
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("pacing registry requests", func() {
+
+	var (
+		srv      *httptest.Server
+		requests atomic.Int32
+		tooMany  atomic.Int32
+	)
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		requests.Store(0)
+		tooMany.Store(0)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if tooMany.Load() > 0 {
+				tooMany.Add(-1)
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(func() { srv.Close() })
+	})
+
+	get := func(ctx context.Context, t http.RoundTripper) *http.Response {
+		GinkgoHelper()
+		req := Successful(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil))
+		resp := Successful(t.RoundTrip(req))
+		resp.Body.Close()
+		return resp
+	}
+
+	It("paces requests", func(ctx context.Context) {
+		t := &pacedTransport{
+			limiter: rate.NewLimiter(rate.Every(100*time.Millisecond), 1),
+			inner:   http.DefaultTransport,
+		}
+		start := time.Now()
+		for range 4 {
+			Expect(get(ctx, t).StatusCode).To(Equal(http.StatusOK))
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+		Expect(requests.Load()).To(Equal(int32(4)))
+	})
+
+	It("doesn't pace without a limiter", func(ctx context.Context) {
+		t := &pacedTransport{inner: http.DefaultTransport}
+		start := time.Now()
+		for range 4 {
+			Expect(get(ctx, t).StatusCode).To(Equal(http.StatusOK))
+		}
+		Expect(time.Since(start)).To(BeNumerically("<", 300*time.Millisecond))
+	})
+
+	It("honors Retry-After", func(ctx context.Context) {
+		tooMany.Store(1)
+		t := &pacedTransport{inner: http.DefaultTransport}
+		start := time.Now()
+		Expect(get(ctx, t).StatusCode).To(Equal(http.StatusOK))
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+		Expect(requests.Load()).To(Equal(int32(2)))
+	})
+
+	It("retries requests with bodies using fresh request clones", func(ctx context.Context) {
+		var bodies []string
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bodies = append(bodies, string(Successful(io.ReadAll(r.Body))))
+			if len(bodies) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+		t := &pacedTransport{inner: http.DefaultTransport}
+		req := Successful(http.NewRequestWithContext(ctx, http.MethodPost, srv.URL,
+			strings.NewReader("hellorld")))
+		body := req.Body
+		resp := Successful(t.RoundTrip(req))
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodies).To(ConsistOf("hellorld", "hellorld"))
+		Expect(req.Body).To(BeIdenticalTo(body))
+	})
+
+	It("gives up after too many retries", func(ctx context.Context) {
+		tooMany.Store(maxRetryAfterAttempts + 1)
+		t := &pacedTransport{inner: http.DefaultTransport}
+		Expect(get(ctx, t).StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(requests.Load()).To(Equal(int32(maxRetryAfterAttempts + 1)))
+	})
+
+	It("stops waiting when the context gets cancelled", func() {
+		tooMany.Store(1)
+		t := &pacedTransport{inner: http.DefaultTransport}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req := Successful(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil))
+		Expect(t.RoundTrip(req)).Error().To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("parses Retry-After", func() {
+		now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+		for _, value := range []string{"", "foo", "-1"} {
+			_, ok := retryAfter(value, now)
+			Expect(ok).To(BeFalse(), "Retry-After: %q", value)
+		}
+		for value, delay := range map[string]time.Duration{
+			" 12 ":                          12 * time.Second,
+			"86400":                         maxRetryDelay,
+			"Sun, 01 Jan 2023 12:00:10 GMT": 10 * time.Second,
+			"Sun, 01 Jan 2023 11:00:00 GMT": 0,
+			"Mon, 02 Jan 2023 12:00:00 GMT": maxRetryDelay,
+		} {
+			d, ok := retryAfter(value, now)
+			Expect(ok).To(BeTrue(), "Retry-After: %q", value)
+			Expect(d).To(Equal(delay), "Retry-After: %q", value)
+		}
+	})
+
+})
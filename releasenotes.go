@@ -0,0 +1,72 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ReleaseNotesImages lists the images shipped with an app, for use in release
+// notes templates.
+type ReleaseNotesImages []SavedImage
+
+// String renders the images as a list, one image reference with its digest
+// per line, so that “{{.Images}}” gives a usable list out of the box.
+func (i ReleaseNotesImages) String() string {
+	var list strings.Builder
+	for idx, image := range i {
+		if idx > 0 {
+			list.WriteString("\n")
+		}
+		fmt.Fprintf(&list, "- %s (%s)", image.Ref, image.Digest)
+	}
+	return list.String()
+}
+
+// releaseNotesData is passed to release notes templates.
+type releaseNotesData struct {
+	Images ReleaseNotesImages
+}
+
+// ExpandReleaseNotes expands the release notes in “detail.json” as a Go
+// text/template, passing in the images pulled by PullAndWriteCompose as
+// “.Images”. It must thus be called after PullAndWriteCompose and after
+// SetDetails.
+func (a *App) ExpandReleaseNotes() error {
+	return expandReleaseNotes(a.detailsPath(), a.project.SavedImages())
+}
+
+// expandReleaseNotes expands the release notes in the “detail.json” at the
+// specified path, using the specified images.
+func expandReleaseNotes(path string, images []SavedImage) error {
+	details, err := readDetails(path)
+	if err != nil {
+		return err
+	}
+	notes, _ := details["releaseNotes"].(string)
+	tmpl, err := template.New("release notes").Parse(notes)
+	if err != nil {
+		return fmt.Errorf("cannot parse release notes template, reason: %w", err)
+	}
+	var expanded strings.Builder
+	if err := tmpl.Execute(&expanded, releaseNotesData{Images: images}); err != nil {
+		return fmt.Errorf("cannot expand release notes template, reason: %w", err)
+	}
+	return updateDetails(path, func(details map[string]any) {
+		details["releaseNotes"] = expanded.String()
+	})
+}
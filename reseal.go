@@ -0,0 +1,151 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ResealPackage recomputes the “digests.json” of the IE app package at the
+// specified path over the package's current contents and then repacks it in
+// place, such as after adding a file to the package out-of-band. As when
+// packaging from a template, the files get digested according to
+// DigestAlgorithms. The resealed package keeps the compression and the file
+// owner of the original package.
+func ResealPackage(pkgPath string) error {
+	log.Info(fmt.Sprintf("🔏  resealing IE app package %q...", pkgPath))
+	tmpDir, err := os.MkdirTemp("", "tiap-reseal-")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary unpacking folder, reason: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	unpacked, err := unpackPackage(pkgPath, tmpDir)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(tmpDir, "digests.json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot remove stale digests.json, reason: %w", err)
+	}
+	// Write the resealed package next to the original one first, so that we
+	// never leave behind an incompletely written package under its final
+	// name.
+	partial := pkgPath + ".partial"
+	opts := []PackageOption{WithUID(unpacked.uid), WithGID(unpacked.gid)}
+	if unpacked.gzipped {
+		opts = append(opts, WithGzip())
+	}
+	a := &App{tmpDir: tmpDir}
+	if err := a.Package(partial, opts...); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, pkgPath); err != nil {
+		_ = os.Remove(partial)
+		return fmt.Errorf("cannot finalize resealed IE app package, reason: %w", err)
+	}
+	return nil
+}
+
+// unpackedPackage describes how an unpacked IE app package was packaged.
+type unpackedPackage struct {
+	gzipped  bool // whole package gzip'ed
+	uid, gid int  // owner of the packaged files
+}
+
+// unpackPackage unpacks the IE app package at the specified path into the
+// specified directory, preserving the permissions and modification times of
+// the packaged files and directories. It reports whether the IE app package
+// is gzip'ed as well as the owner of its first entry, as tiap packages all
+// files with the same owner.
+func unpackPackage(pkgPath string, dir string) (unpackedPackage, error) {
+	var unpacked unpackedPackage
+	tarrer, err := openPackage(pkgPath)
+	if err != nil {
+		return unpacked, fmt.Errorf("cannot read IE app package, reason: %w", err)
+	}
+	defer tarrer.Close()
+	unpacked.gzipped = tarrer.gzipped
+	var dirHeaders []*tar.Header
+	owned := false
+	for {
+		header, err := tarrer.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return unpacked, fmt.Errorf("cannot read IE app package %q, reason: %w", pkgPath, err)
+		}
+		if !owned {
+			unpacked.uid, unpacked.gid = header.Uid, header.Gid
+			owned = true
+		}
+		if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+			return unpacked, fmt.Errorf("invalid path %q in IE app package %q", header.Name, pkgPath)
+		}
+		name := filepath.Join(dir, filepath.FromSlash(header.Name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return unpacked, fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+			}
+			dirHeaders = append(dirHeaders, header)
+		case tar.TypeReg:
+			if err := unpackFile(tarrer, header, name); err != nil {
+				return unpacked, err
+			}
+		default:
+			return unpacked, fmt.Errorf("unsupported entry %q in IE app package %q", header.Name, pkgPath)
+		}
+	}
+	// Only restore the directory permissions and modification times after
+	// all files have been unpacked, as otherwise unpacking the files would
+	// interfere.
+	for _, header := range dirHeaders {
+		name := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if err := os.Chmod(name, header.FileInfo().Mode().Perm()); err != nil {
+			return unpacked, fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+		}
+		_ = os.Chtimes(name, header.ModTime, header.ModTime)
+	}
+	return unpacked, nil
+}
+
+// unpackFile unpacks the current tar entry with the specified header into the
+// named file.
+func unpackFile(r io.Reader, header *tar.Header, name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot unpack %q, reason: %w", header.Name, err)
+	}
+	_ = os.Chtimes(name, header.ModTime, header.ModTime)
+	return nil
+}
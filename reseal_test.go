@@ -0,0 +1,151 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("resealing app packages", func() {
+
+	// packagedDigests returns the digests listed in the package's digests.json
+	// as well as the digests of the package's current contents.
+	packagedDigests := func(pkgPath string) (listed, actual map[string]string) {
+		GinkgoHelper()
+		dir := GinkgoT().TempDir()
+		Expect(unpackPackage(pkgPath, dir)).Error().NotTo(HaveOccurred())
+		var digests struct {
+			Files map[string]string `json:"files"`
+		}
+		Expect(json.Unmarshal(Successful(os.ReadFile(filepath.Join(dir, "digests.json"))), &digests)).
+			To(Succeed())
+		return digests.Files, Successful(FileDigests(dir))
+	}
+
+	// addFile adds a file out-of-band to the package.
+	addFile := func(pkgPath string, name string, contents string) {
+		GinkgoHelper()
+		orig := Successful(os.ReadFile(pkgPath))
+		f := Successful(os.Create(pkgPath))
+		defer f.Close()
+		tarwr := tar.NewWriter(f)
+		tarrd := tar.NewReader(bytes.NewReader(orig))
+		for {
+			header, err := tarrd.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tarwr.WriteHeader(header)).To(Succeed())
+			Expect(io.Copy(tarwr, tarrd)).Error().NotTo(HaveOccurred())
+		}
+		Expect(tarwr.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			ModTime:  time.Now(),
+		})).To(Succeed())
+		Expect(tarwr.Write([]byte(contents))).Error().NotTo(HaveOccurred())
+		Expect(tarwr.Close()).To(Succeed())
+	}
+
+	It("recomputes digests after modifying a package", func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+		pkgPath := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(pkgPath)).To(Succeed())
+
+		addFile(pkgPath, "hellorld/licenses.txt", "hellorld")
+		listed, actual := packagedDigests(pkgPath)
+		Expect(listed).NotTo(Equal(actual))
+
+		Expect(ResealPackage(pkgPath)).To(Succeed())
+		listed, actual = packagedDigests(pkgPath)
+		Expect(listed).To(HaveKey("hellorld/licenses.txt"))
+		Expect(listed).To(Equal(actual))
+		Expect(pkgPath + ".partial").NotTo(BeAnExistingFile())
+	})
+
+	It("reseals gzip'ed packages as gzip'ed packages", func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+		pkgPath := filepath.Join(GinkgoT().TempDir(), "hellorld.app.gz")
+		Expect(a.Package(pkgPath, WithGzip())).To(Succeed())
+
+		Expect(ResealPackage(pkgPath)).To(Succeed())
+		Expect(Successful(os.ReadFile(pkgPath))[:2]).To(Equal(gzipMagic))
+		Expect(Successful(unpackPackage(pkgPath, GinkgoT().TempDir())).gzipped).To(BeTrue())
+		listed, actual := packagedDigests(pkgPath)
+		Expect(listed).To(Equal(actual))
+	})
+
+	It("keeps the owner of the packaged files", func() {
+		GrabLog(logrus.InfoLevel)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+		pkgPath := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(pkgPath, WithUID(4242), WithGID(666))).To(Succeed())
+
+		Expect(ResealPackage(pkgPath)).To(Succeed())
+		f := Successful(os.Open(pkgPath))
+		defer f.Close()
+		tarrd := tar.NewReader(f)
+		for {
+			header, err := tarrd.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Uid).To(Equal(4242), "owner of %s", header.Name)
+			Expect(header.Gid).To(Equal(666), "group of %s", header.Name)
+		}
+	})
+
+	It("rejects invalid packages", func() {
+		GrabLog(logrus.InfoLevel)
+		Expect(ResealPackage("testdata/nada-nothing-nil.app")).To(MatchError(
+			ContainSubstring("cannot read IE app package")))
+
+		pkgPath := filepath.Join(GinkgoT().TempDir(), "evil.app")
+		f := Successful(os.Create(pkgPath))
+		tarwr := tar.NewWriter(f)
+		Expect(tarwr.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: "../evil.txt", Mode: 0644,
+		})).To(Succeed())
+		Expect(tarwr.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+		Expect(ResealPackage(pkgPath)).To(MatchError(ContainSubstring("invalid path")))
+	})
+
+})
@@ -0,0 +1,119 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults for retrying failed image pulls, see WithRetries.
+const (
+	DefaultPullRetries    = 2
+	DefaultPullRetryDelay = 500 * time.Millisecond
+)
+
+// WithRetries retries a failed image pull (including saving the pulled image)
+// up to the specified number of times when the failure looks transient, such
+// as network failures, “429 Too Many Requests”, and server errors. Failures
+// such as unknown manifests or failed authentication are never retried. The
+// delay before the first retry doubles with each further retry, plus some
+// jitter. Without this option, failed pulls get retried DefaultPullRetries
+// times, starting with DefaultPullRetryDelay.
+func WithRetries(retries int, delay time.Duration) PullOption {
+	return func(o *PullOptions) {
+		o.Retries = retries
+		o.RetryDelay = delay
+	}
+}
+
+// maxRetryDelay caps the exponential backoff of retries, as well as the delays
+// registries ask for using “Retry-After”.
+const maxRetryDelay = 30 * time.Second
+
+// retry calls the specified function, retrying it as often as the specified
+// options allow with exponential backoff as long as it fails with a transient
+// error. retry gives up immediately when the context gets cancelled. The
+// “what” describes the operation in log messages, such as “pulling image
+// "foo:1.0"”.
+func retry(ctx context.Context, options PullOptions, what string, fn func(ctx context.Context) error) error {
+	delay := options.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= options.Retries || !transientError(err) || ctx.Err() != nil {
+			return err
+		}
+		// Add up to 50% jitter, so that parallel pulls don't retry in
+		// lockstep.
+		wait := delay + rand.N(delay/2+1)
+		log.Warn(fmt.Sprintf("⏳  %s failed, retrying in %s: %s",
+			what, wait.Round(time.Millisecond), err))
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+// transient marks the specified error as transient, so that retry retries it,
+// such as for errors from clients that don't preserve the underlying network
+// errors.
+func transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientErr{err}
+}
+
+// transientErr wraps an error explicitly marked as transient.
+type transientErr struct{ error }
+
+func (e *transientErr) Unwrap() error { return e.error }
+
+// transientError returns true if the specified error looks like it might go
+// away when trying again, such as network failures, “429 Too Many Requests”,
+// and server errors.
+func transientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var marked *transientErr
+	if errors.As(err, &marked) {
+		return true
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return terr.StatusCode == http.StatusTooManyRequests ||
+			terr.StatusCode == http.StatusRequestTimeout ||
+			terr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("retrying transient failures", Serial, func() {
+
+	var options PullOptions
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		options = pullOptions([]PullOption{WithRetries(2, 10*time.Millisecond)})
+	})
+
+	// failing returns a function failing with the specified errors in turn,
+	// and succeeding afterwards, as well as the counter of calls.
+	failing := func(errs ...error) (func(context.Context) error, *int) {
+		calls := 0
+		return func(context.Context) error {
+			calls++
+			if calls <= len(errs) {
+				return errs[calls-1]
+			}
+			return nil
+		}, &calls
+	}
+
+	It("retries transient errors until success", func(ctx context.Context) {
+		fn, calls := failing(
+			&transport.Error{StatusCode: http.StatusTooManyRequests},
+			io.ErrUnexpectedEOF)
+		Expect(retry(ctx, options, "foo", fn)).To(Succeed())
+		Expect(*calls).To(Equal(3))
+	})
+
+	It("doesn't retry permanent errors", func(ctx context.Context) {
+		fn, calls := failing(&transport.Error{StatusCode: http.StatusNotFound})
+		Expect(retry(ctx, options, "foo", fn)).To(HaveOccurred())
+		Expect(*calls).To(Equal(1))
+	})
+
+	It("retries errors explicitly marked as transient", func(ctx context.Context) {
+		fn, calls := failing(transient(errors.New("daemon not yet up")))
+		Expect(retry(ctx, options, "foo", fn)).To(Succeed())
+		Expect(*calls).To(Equal(2))
+	})
+
+	It("gives up after the configured number of retries", func(ctx context.Context) {
+		fn, calls := failing(io.EOF, io.EOF, io.EOF, io.EOF)
+		Expect(retry(ctx, options, "foo", fn)).To(MatchError(io.EOF))
+		Expect(*calls).To(Equal(3))
+	})
+
+	It("stops retrying when the context gets cancelled", func(ctx context.Context) {
+		options.RetryDelay = 10 * time.Second
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+		fn, calls := failing(io.EOF, io.EOF)
+		start := time.Now()
+		Expect(retry(ctx, options, "foo", fn)).To(MatchError(context.Canceled))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(*calls).To(Equal(1))
+	})
+
+	It("pulls from a flaky registry", func(ctx context.Context) {
+		// The registry rejects the first manifest requests with “429 Too
+		// Many Requests” before it gets its act together.
+		var rejects atomic.Int32
+		rejects.Store(2)
+		reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") && rejects.Add(-1) >= 0 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			reg.ServeHTTP(w, r)
+		}))
+		DeferCleanup(srv.Close)
+		imageRef := strings.TrimPrefix(srv.URL, "http://") + "/hellorld/foo:1.0"
+		image := Successful(random.Image(1024, 1))
+		rejects.Store(0)
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+		rejects.Store(2)
+
+		p := &ComposerProject{}
+		Expect(p.PullImages(ctx, ServiceImages{"foo": imageRef},
+			"linux/amd64", GinkgoT().TempDir(), nil, WithRetries(2, 10*time.Millisecond))).To(Succeed())
+		Expect(p.SavedImages()).To(HaveExactElements(
+			HaveField("Digest", Successful(image.Digest()).String())))
+		Expect(rejects.Load()).To(BeNumerically("<", 0))
+	})
+
+})
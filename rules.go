@@ -0,0 +1,144 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+// Rule describes a validation rule that tiap enforces, either always or when
+// explicitly asked for.
+type Rule struct {
+	Name      string `json:"name"`      // short rule name
+	Check     string `json:"check"`     // what the rule checks
+	Rationale string `json:"rationale"` // why the rule exists
+	Default   bool   `json:"default"`   // enforced by default
+	Control   string `json:"control"`   // how to opt in or out, if at all
+}
+
+// Rules lists the validation rules tiap enforces. When adding or changing
+// checks, please keep this list in sync, as “tiap rules” explains the rules
+// to users based on this list.
+var Rules = []Rule{
+	{
+		Name:      "composer-in-repository",
+		Check:     "the composer project file is placed inside the app repository subdirectory, not the template root",
+		Rationale: "Industrial Edge expects the composer project inside the app repository",
+		Default:   true,
+	},
+	{
+		Name:      "no-latest-tag",
+		Check:     "service and extra images don't use the \"latest\" tag",
+		Rationale: "\"latest\" images change over time, so app packages wouldn't be reproducible",
+		Default:   true,
+		Control:   "disable using --allow-latest",
+	},
+	{
+		Name:      "explicit-tag",
+		Check:     "service and extra images specify an explicit tag or digest",
+		Rationale: "untagged images implicitly use the \"latest\" tag",
+		Default:   true,
+		Control:   "disable using --allow-latest",
+	},
+	{
+		Name:      "prebuilt-images",
+		Check:     "services reference prebuilt images instead of only declaring build:",
+		Rationale: "app packages can only ship prebuilt images",
+		Default:   true,
+	},
+	{
+		Name:      "mem-limit",
+		Check:     "services declare a valid mem_limit",
+		Rationale: "Industrial Edge requires memory limits, and missing ones are the most common stumbling block",
+		Default:   true,
+		Control:   "opt out using the top-level composer project extension \"x-tiap: {require-mem-limit: false}\"",
+	},
+	{
+		Name:      "unique-container-names",
+		Check:     "no two services declare the same container_name",
+		Rationale: "container names must be unique per host, so duplicates fail deployment",
+		Default:   true,
+	},
+	{
+		Name:      "single-platform",
+		Check:     "an app package is built for a single platform only",
+		Rationale: "detail.json supports only a single architecture",
+		Default:   true,
+	},
+	{
+		Name:      "ie-arch",
+		Check:     "the IE App architecture is x86-64 or arm64",
+		Rationale: "the Industrial Edge catalog rejects app packages for other architectures",
+		Default:   true,
+	},
+	{
+		Name:      "max-files",
+		Check:     "templates and packages don't contain too many files",
+		Rationale: "safety valve against runaway templates, such as accidentally pointing at $HOME",
+		Default:   true,
+		Control:   "change or disable the limit using --max-files",
+	},
+	{
+		Name:      "strict-parsing",
+		Check:     "composer projects contain a single YAML document, and detail.json contains no duplicate keys",
+		Rationale: "additional documents and duplicate keys would otherwise be silently ignored",
+		Control:   "opt in using --strict-yaml",
+	},
+	{
+		Name:      "lint",
+		Check:     "composer project elements have the expected structure",
+		Rationale: "structural mistakes otherwise only surface when deploying the app",
+		Control:   "opt in using --lint",
+	},
+	{
+		Name:      "port-conflicts",
+		Check:     "no two services publish the same host port",
+		Rationale: "conflicting host ports otherwise only surface when deploying the app",
+		Control:   "opt in using --check-ports",
+	},
+	{
+		Name:      "moving-tags",
+		Check:     "service images don't use moving tags, such as \"stable\" or \"edge\"",
+		Rationale: "moving tags change over time, similar to \"latest\"",
+		Control:   "opt in using --warn-moving-tags or --reject-moving-tags, patterns set using --moving-tags",
+	},
+	{
+		Name:      "placeholders",
+		Check:     "the template's detail.json leaves the fields tiap fills in empty",
+		Rationale: "keeps templates clean from prematurely filled in fields",
+		Control:   "opt in using --check-placeholders, fields set using --placeholder-fields",
+	},
+	{
+		Name:      "device-profile",
+		Check:     "the app package doesn't exceed the size and file count limits of a device profile",
+		Rationale: "different classes of devices have different limits",
+		Control:   "opt in using --device-profile",
+	},
+	{
+		Name:      "permissions",
+		Check:     "packaged files and directories have neither setuid, setgid, or sticky bits, nor are world-writable",
+		Rationale: "such permissions are a security smell, usually committed accidentally",
+		Default:   true,
+		Control:   "warns by default, fails using --strict-perms",
+	},
+	{
+		Name:      "image-lock",
+		Check:     "the pulled images match the digests in an image lockfile",
+		Rationale: "ensures that only reviewed images get packaged",
+		Control:   "opt in using --image-lock",
+	},
+	{
+		Name:      "saved-platform",
+		Check:     "the saved images actually are for the requested platform",
+		Rationale: "catches single-platform images silently substituted for the requested platform",
+		Control:   "opt in using --verify-saved-arch",
+	},
+}
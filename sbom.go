@@ -0,0 +1,239 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported SBOM formats.
+const (
+	SBOMCycloneDX = "cyclonedx" // CycloneDX 1.5 JSON
+	SBOMSPDX      = "spdx"      // SPDX 2.3 JSON
+)
+
+// SBOMExtensions maps the supported SBOM formats to their customary file name
+// extensions.
+var SBOMExtensions = map[string]string{
+	SBOMCycloneDX: ".cdx.json",
+	SBOMSPDX:      ".spdx.json",
+}
+
+// sbomImage describes a packaged container image for inclusion in an SBOM.
+type sbomImage struct {
+	SavedImage
+	name string // last repository path element, such as “busybox”
+	tag  string // tag, if any
+	purl string // OCI package URL
+	hash string // hex-encoded SHA256 manifest digest, without scheme prefix
+}
+
+// WriteSBOM writes a minimal image-level SBOM in the specified format
+// (SBOMCycloneDX or SBOMSPDX) to the specified writer, listing the container
+// images pulled by PullAndWriteCompose together with their digests and the
+// specified platform. WriteSBOM doesn't look inside the images, so the SBOM
+// doesn't list any packages contained in the images. It must be called after
+// PullAndWriteCompose and after SetDetails.
+func (a *App) WriteSBOM(w io.Writer, format string, platform string) error {
+	var details struct {
+		Title         string `json:"title"`
+		AppID         string `json:"appId"`
+		VersionNumber string `json:"versionNumber"`
+		VersionID     string `json:"versionId"`
+	}
+	detailsJSON, err := os.ReadFile(a.detailsPath())
+	if err != nil {
+		return fmt.Errorf("cannot read detail.json, reason: %w", err)
+	}
+	if err := json.Unmarshal(detailsJSON, &details); err != nil {
+		return fmt.Errorf("cannot parse detail.json, reason: %w", err)
+	}
+	var images []sbomImage
+	for _, saved := range a.project.SavedImages() {
+		image, err := newSBOMImage(saved, platform)
+		if err != nil {
+			return err
+		}
+		images = append(images, image)
+	}
+	log.Info(fmt.Sprintf("🧾  writing %s SBOM listing %d images", format, len(images)))
+	var sbom any
+	switch format {
+	case SBOMCycloneDX:
+		sbom = cycloneDX(details.Title, details.VersionNumber, platform, images)
+	case SBOMSPDX:
+		sbom = spdx(details.Title, details.AppID+"/"+details.VersionID, platform, images)
+	default:
+		return fmt.Errorf("unsupported SBOM format %q", format)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sbom); err != nil {
+		return fmt.Errorf("cannot write SBOM, reason: %w", err)
+	}
+	return nil
+}
+
+// newSBOMImage returns the SBOM information for the specified saved image.
+func newSBOMImage(saved SavedImage, platform string) (sbomImage, error) {
+	ref, err := name.ParseReference(saved.Ref, name.WithDefaultRegistry(DefaultRegistry))
+	if err != nil {
+		return sbomImage{}, fmt.Errorf("invalid image reference %q, reason: %w", saved.Ref, err)
+	}
+	image := sbomImage{
+		SavedImage: saved,
+		name:       path.Base(ref.Context().RepositoryStr()),
+		hash:       strings.TrimPrefix(saved.Digest, "sha256:"),
+	}
+	if tag, ok := ref.(name.Tag); ok {
+		image.tag = tag.TagStr()
+	}
+	repoURL := ref.Context().Name()
+	if rest, ok := strings.CutPrefix(repoURL, name.DefaultRegistry+"/"); ok {
+		repoURL = "docker.io/" + rest
+	}
+	qualifiers := url.Values{"repository_url": {repoURL}}
+	if image.tag != "" {
+		qualifiers.Set("tag", image.tag)
+	}
+	if _, arch, ok := strings.Cut(platform, "/"); ok {
+		qualifiers.Set("arch", strings.SplitN(arch, "/", 2)[0])
+	}
+	image.purl = "pkg:oci/" + url.QueryEscape(image.name) + "@" +
+		url.QueryEscape(saved.Digest) + "?" + qualifiers.Encode()
+	return image, nil
+}
+
+// cycloneDX returns a minimal CycloneDX 1.5 SBOM for the specified images.
+func cycloneDX(title string, version string, platform string, images []sbomImage) any {
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type hash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	type component struct {
+		Type       string     `json:"type"`
+		BOMRef     string     `json:"bom-ref,omitempty"`
+		Name       string     `json:"name"`
+		Version    string     `json:"version,omitempty"`
+		PURL       string     `json:"purl,omitempty"`
+		Hashes     []hash     `json:"hashes,omitempty"`
+		Properties []property `json:"properties,omitempty"`
+	}
+	components := []component{}
+	for _, image := range images {
+		components = append(components, component{
+			Type:    "container",
+			BOMRef:  image.purl,
+			Name:    image.name,
+			Version: image.tag,
+			PURL:    image.purl,
+			Hashes:  []hash{{Alg: "SHA-256", Content: image.hash}},
+			Properties: []property{
+				{Name: "tiap:image", Value: image.Ref},
+				{Name: "tiap:image-id", Value: image.ID},
+				{Name: "tiap:platform", Value: platform},
+			},
+		})
+	}
+	return map[string]any{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"version":     1,
+		"metadata": map[string]any{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"tools": map[string]any{
+				"components": []component{{Type: "application", Name: "tiap"}},
+			},
+			"component": component{Type: "application", Name: title, Version: version},
+		},
+		"components": components,
+	}
+}
+
+// spdx returns a minimal SPDX 2.3 SBOM for the specified images.
+func spdx(title string, namespace string, platform string, images []sbomImage) any {
+	type checksum struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"checksumValue"`
+	}
+	type externalRef struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		Name             string        `json:"name"`
+		SPDXID           string        `json:"SPDXID"`
+		VersionInfo      string        `json:"versionInfo,omitempty"`
+		DownloadLocation string        `json:"downloadLocation"`
+		FilesAnalyzed    bool          `json:"filesAnalyzed"`
+		Checksums        []checksum    `json:"checksums"`
+		ExternalRefs     []externalRef `json:"externalRefs"`
+		Comment          string        `json:"comment,omitempty"`
+	}
+	type relationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+	packages := []pkg{}
+	relationships := []relationship{}
+	for idx, image := range images {
+		id := fmt.Sprintf("SPDXRef-Image-%d", idx+1)
+		packages = append(packages, pkg{
+			Name:             image.name,
+			SPDXID:           id,
+			VersionInfo:      image.tag,
+			DownloadLocation: "NOASSERTION",
+			Checksums:        []checksum{{Algorithm: "SHA256", Value: image.hash}},
+			ExternalRefs: []externalRef{
+				{Category: "PACKAGE-MANAGER", Type: "purl", Locator: image.purl},
+			},
+			Comment: fmt.Sprintf("image %s, ID %s, platform %s", image.Ref, image.ID, platform),
+		})
+		relationships = append(relationships, relationship{
+			Element: "SPDXRef-DOCUMENT",
+			Type:    "DESCRIBES",
+			Related: id,
+		})
+	}
+	return map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              title,
+		"documentNamespace": "https://github.com/thediveo/tiap/spdx/" + namespace,
+		"creationInfo": map[string]any{
+			"created":  time.Now().UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: tiap"},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
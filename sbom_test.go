@@ -0,0 +1,110 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("SBOMs", func() {
+
+	var a *App
+	digest := "sha256:" + strings.Repeat("1", 64)
+	purl := "pkg:oci/busybox@sha256%3A" + strings.Repeat("1", 64) +
+		"?arch=arm64&repository_url=docker.io%2Flibrary%2Fbusybox&tag=stable"
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		a = Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+		a.project.savedImages = []SavedImage{{
+			Ref:    "busybox:stable",
+			Digest: digest,
+			ID:     "sha256:" + strings.Repeat("2", 64),
+		}}
+	})
+
+	sbom := func(format string) map[string]any {
+		GinkgoHelper()
+		var buff bytes.Buffer
+		Expect(a.WriteSBOM(&buff, format, "linux/arm64")).To(Succeed())
+		var m map[string]any
+		Expect(json.Unmarshal(buff.Bytes(), &m)).To(Succeed())
+		return m
+	}
+
+	It("writes CycloneDX", func() {
+		m := sbom(SBOMCycloneDX)
+		Expect(m).To(HaveKeyWithValue("bomFormat", "CycloneDX"))
+		Expect(m).To(HaveKeyWithValue("specVersion", "1.5"))
+		Expect(m).To(HaveKeyWithValue("metadata", HaveKeyWithValue("component", And(
+			HaveKeyWithValue("name", "Hellorld!"),
+			HaveKeyWithValue("version", "1.2.3"),
+		))))
+		Expect(m).To(HaveKeyWithValue("components", ConsistOf(And(
+			HaveKeyWithValue("type", "container"),
+			HaveKeyWithValue("name", "busybox"),
+			HaveKeyWithValue("version", "stable"),
+			HaveKeyWithValue("purl", purl),
+			HaveKeyWithValue("hashes", ConsistOf(map[string]any{
+				"alg":     "SHA-256",
+				"content": strings.Repeat("1", 64),
+			})),
+			HaveKeyWithValue("properties", ContainElement(map[string]any{
+				"name":  "tiap:platform",
+				"value": "linux/arm64",
+			})),
+		))))
+	})
+
+	It("writes SPDX", func() {
+		m := sbom(SBOMSPDX)
+		Expect(m).To(HaveKeyWithValue("spdxVersion", "SPDX-2.3"))
+		Expect(m).To(HaveKeyWithValue("SPDXID", "SPDXRef-DOCUMENT"))
+		Expect(m).To(HaveKeyWithValue("name", "Hellorld!"))
+		Expect(m).To(HaveKeyWithValue("documentNamespace",
+			MatchRegexp(`^https://github.com/thediveo/tiap/spdx/c535a6d381284839b458e3f572af18ce/[0-9a-zA-Z]{32}$`)))
+		Expect(m).To(HaveKeyWithValue("packages", ConsistOf(And(
+			HaveKeyWithValue("SPDXID", "SPDXRef-Image-1"),
+			HaveKeyWithValue("name", "busybox"),
+			HaveKeyWithValue("versionInfo", "stable"),
+			HaveKeyWithValue("checksums", ConsistOf(map[string]any{
+				"algorithm":     "SHA256",
+				"checksumValue": strings.Repeat("1", 64),
+			})),
+			HaveKeyWithValue("externalRefs", ConsistOf(HaveKeyWithValue("referenceLocator", purl))),
+		))))
+		Expect(m).To(HaveKeyWithValue("relationships", ConsistOf(map[string]any{
+			"spdxElementId":      "SPDXRef-DOCUMENT",
+			"relationshipType":   "DESCRIBES",
+			"relatedSpdxElement": "SPDXRef-Image-1",
+		})))
+	})
+
+	It("rejects unsupported formats", func() {
+		Expect(a.WriteSBOM(&bytes.Buffer{}, "foobar", "linux/arm64")).To(MatchError(
+			ContainSubstring("unsupported SBOM format")))
+	})
+
+})
@@ -0,0 +1,81 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	log "github.com/sirupsen/logrus"
+)
+
+// PinImageDigests pins the image references of all services to the manifest
+// digests their tags currently resolve to in their registries, such as
+// “busybox:1.36@sha256:...”, without pulling the images. Images already
+// referenced by digest are left untouched. If resolving any digest fails,
+// PinImageDigests leaves all image references unchanged, see also
+// [ComposerProject.RewriteImages]. All requests to remote registries
+// are paced by the shared RegistryLimiter, if set. Pass WithAuth or
+// WithBasicAuth in order to authenticate with explicit credentials; other pull
+// options don't apply.
+func (p *ComposerProject) PinImageDigests(ctx context.Context, opts ...PullOption) error {
+	options := pullOptions(opts)
+	return p.RewriteImages(func(imageRef string) (string, error) {
+		return pinImageDigest(ctx, imageRef, options)
+	})
+}
+
+// pinImageDigest returns the specified image reference with the digest of the
+// manifest (or index) it currently resolves to appended.
+func pinImageDigest(ctx context.Context, imageRef string, options PullOptions) (string, error) {
+	ref, err := name.ParseReference(imageRef, name.WithDefaultRegistry(DefaultRegistry))
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", imageRef, err)
+	}
+	if _, ok := ref.(name.Digest); ok {
+		return imageRef, nil
+	}
+	digest, err := registryDigest(ctx, ref, options)
+	if err != nil {
+		return "", err
+	}
+	return imageRef + "@" + digest, nil
+}
+
+// WriteComposeWithoutImages validates the app's composer project and writes it
+// into the stage, but without pulling and saving any images, resulting in a
+// slim app package for deployments pulling their images from a registry at
+// deploy time. Optionally, the image references get pinned to their current
+// digests, see also [ComposerProject.PinImageDigests], authenticating as
+// specified by the pull options. As extra images aren't referenced by any
+// service, deployments won't pull them, so WriteComposeWithoutImages warns
+// about dropping them.
+func (a *App) WriteComposeWithoutImages(ctx context.Context, pinDigests bool, opts ...PullOption) error {
+	log.Info("🪶  writing composer project without bundling images...")
+	if _, err := a.ResolveImages(); err != nil {
+		return err
+	}
+	if extraImages := a.project.extraImages; len(extraImages) > 0 {
+		log.Warn(fmt.Sprintf("⚠  dropping %s images %q, as slim app packages cannot ship them",
+			extraImagesExtension, extraImages))
+	}
+	if pinDigests {
+		if err := a.project.PinImageDigests(ctx, opts...); err != nil {
+			return err
+		}
+	}
+	return a.WriteCompose()
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("slim app packages", func() {
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+	})
+
+	It("packages without images", func(ctx context.Context) {
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(Succeed())
+		Expect(a.SetDetails("1.2.3", "", "arm64")).To(Succeed())
+		out := filepath.Join(GinkgoT().TempDir(), "hellorld.app")
+		Expect(a.Package(out)).To(Succeed())
+
+		f := Successful(os.Open(out))
+		defer f.Close()
+		var names []string
+		tarrer := tar.NewReader(f)
+		for {
+			header, err := tarrer.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, header.Name)
+		}
+		Expect(names).To(ContainElements(
+			"detail.json", "digests.json", "hellorld/docker-compose.yml"))
+		Expect(names).NotTo(ContainElement(ContainSubstring("images")))
+	})
+
+	It("warns about dropping extra images", func(ctx context.Context) {
+		var logged bytes.Buffer
+		logrus.SetOutput(&logged)
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		a.project.extraImages = []string{"alpine:3.18", "busybox:1.36"}
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(Succeed())
+		Expect(logged.String()).To(ContainSubstring("level=warning"))
+		Expect(logged.String()).To(ContainSubstring(
+			`dropping x-tiap-extra-images images [\"alpine:3.18\" \"busybox:1.36\"]`))
+	})
+
+	It("still validates image references", func(ctx context.Context) {
+		a := Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		services := Successful(lookupMap(a.project.yaml, "services"))
+		for _, config := range services {
+			config.(map[string]any)["image"] = "busybox:latest"
+		}
+		Expect(a.WriteComposeWithoutImages(ctx, false)).To(MatchError(
+			ContainSubstring("attempts to use latest tag")))
+	})
+
+	It("pins image digests without pulling", func(ctx context.Context) {
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		DeferCleanup(srv.Close)
+		host := strings.TrimPrefix(srv.URL, "http://")
+
+		image := Successful(random.Image(1024, 1))
+		imageRef := host + "/hellorld/app:1.2.3"
+		Expect(remote.Write(Successful(name.ParseReference(imageRef)), image)).To(Succeed())
+		digest := Successful(image.Digest()).String()
+
+		p := &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": imageRef},
+				"bar": map[string]any{"image": imageRef + "@" + digest},
+			},
+		}}
+		Expect(p.PinImageDigests(ctx)).To(Succeed())
+		services := Successful(lookupMap(p.yaml, "services"))
+		Expect(services).To(And(
+			HaveKeyWithValue("foo", HaveKeyWithValue("image", imageRef+"@"+digest)),
+			HaveKeyWithValue("bar", HaveKeyWithValue("image", imageRef+"@"+digest)),
+		))
+
+		p = &ComposerProject{yaml: map[string]any{
+			"services": map[string]any{
+				"foo": map[string]any{"image": host + "/hellorld/nada:1.2.3"},
+			},
+		}}
+		Expect(p.PinImageDigests(ctx)).To(MatchError(
+			ContainSubstring("cannot resolve digest of image")))
+	})
+
+})
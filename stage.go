@@ -0,0 +1,138 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/otiai10/copy"
+)
+
+// Modes of staging symbolic links in app templates, see StageSymlinks.
+const (
+	SymlinksPreserve = "preserve" // stage symbolic links as such (default).
+	SymlinksFollow   = "follow"   // stage copies of the symbolic link targets.
+	SymlinksSkip     = "skip"     // don't stage symbolic links at all.
+)
+
+// StageSymlinks controls how NewApp stages symbolic links found in app
+// templates: SymlinksPreserve stages them as symbolic links, SymlinksFollow
+// stages copies of their targets instead, and SymlinksSkip leaves them out.
+// Please note that Package always packages the targets of symbolic links, as
+// Industrial Edge app packages cannot contain symbolic links, and the same
+// goes for digesting. SymlinksFollow thus makes the staged tree match what
+// gets packaged, including link targets outside the app template.
+var StageSymlinks = SymlinksPreserve
+
+// StagePreservePermissions controls whether NewApp preserves the permissions
+// of the files and directories when staging an app template. Otherwise, it
+// normalizes them to 0755 for directories and executable files, and to 0644
+// for all other files, independent of any umask at the time the template
+// was checked out.
+var StagePreservePermissions = true
+
+// StagePaths optionally restricts NewApp to staging only the listed paths of
+// an app template, relative to the template root, such as “myapp” and
+// “icons/logo.png”. Listed directories get staged including their contents.
+// The details file is always staged, but the app repository with its Docker
+// compose project file must be within the listed paths. An empty StagePaths
+// stages the whole app template.
+var StagePaths []string
+
+// StageExcludes lists absolute paths of files that NewApp never stages, such
+// as an app package and its sidecar files written into the app template
+// directory by a previous build.
+var StageExcludes []string
+
+// stagePathFilter returns a function reporting whether to stage the specified
+// path relative to the template root, according to StagePaths.
+func stagePathFilter() (func(rel string) bool, error) {
+	if len(StagePaths) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	paths := make([]string, 0, len(StagePaths))
+	for _, path := range StagePaths {
+		clean := filepath.Clean(path)
+		if !filepath.IsLocal(clean) {
+			return nil, fmt.Errorf("invalid stage path %q, must be relative to and within the app template", path)
+		}
+		paths = append(paths, clean)
+	}
+	return func(rel string) bool {
+		if rel == "." || rel == DetailsFile {
+			return true
+		}
+		for _, path := range paths {
+			// Stage the listed path, everything inside it, and the
+			// directories leading to it.
+			if rel == path ||
+				strings.HasPrefix(rel, path+string(filepath.Separator)) ||
+				strings.HasPrefix(path, rel+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// stageCopyOptions returns the copy options for staging an app template
+// according to StageSymlinks and StagePreservePermissions, using the
+// specified skip function.
+func stageCopyOptions(
+	skip func(info os.FileInfo, src, dest string) (bool, error),
+) (copy.Options, error) {
+	opts := copy.Options{
+		Skip:              skip,
+		PermissionControl: copy.PerservePermission,
+	}
+	switch StageSymlinks {
+	case SymlinksPreserve, "":
+		opts.OnSymlink = func(string) copy.SymlinkAction { return copy.Shallow }
+	case SymlinksFollow:
+		opts.OnSymlink = func(string) copy.SymlinkAction { return copy.Deep }
+	case SymlinksSkip:
+		opts.OnSymlink = func(string) copy.SymlinkAction { return copy.Skip }
+	default:
+		return copy.Options{}, fmt.Errorf("invalid symbolic link staging mode %q, must be %q, %q, or %q",
+			StageSymlinks, SymlinksPreserve, SymlinksFollow, SymlinksSkip)
+	}
+	if !StagePreservePermissions {
+		opts.PermissionControl = normalizePermissions
+	}
+	return opts, nil
+}
+
+// normalizePermissions is a copy permission control that normalizes the
+// permissions of staged files and directories.
+func normalizePermissions(srcinfo fs.FileInfo, dest string) (func(*error), error) {
+	mode := os.FileMode(0644)
+	if srcinfo.IsDir() || srcinfo.Mode().Perm()&0111 != 0 {
+		mode = 0755
+	}
+	if srcinfo.IsDir() {
+		if err := os.MkdirAll(dest, mode); err != nil {
+			return func(*error) {}, err
+		}
+	}
+	return func(err *error) {
+		if cherr := os.Chmod(dest, mode); *err == nil {
+			*err = cherr
+		}
+	}, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/otiai10/copy"
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("staging app templates", Serial, func() {
+
+	var template string
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		oldSymlinks, oldPerms, oldPaths, oldExcludes := StageSymlinks, StagePreservePermissions, StagePaths, StageExcludes
+		DeferCleanup(func() {
+			StageSymlinks, StagePreservePermissions, StagePaths, StageExcludes = oldSymlinks, oldPerms, oldPaths, oldExcludes
+		})
+
+		template = GinkgoT().TempDir()
+		Expect(copy.Copy("testdata/app", template)).To(Succeed())
+		repo := filepath.Join(template, "hellorld")
+		Expect(os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("notes"), 0600)).To(Succeed())
+		Expect(os.Chmod(filepath.Join(repo, "notes.txt"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(repo, "run.sh"), []byte("#!/bin/sh"), 0700)).To(Succeed())
+		Expect(os.Chmod(filepath.Join(repo, "run.sh"), 0700)).To(Succeed())
+		Expect(os.Symlink("notes.txt", filepath.Join(repo, "link.txt"))).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(template, "docs", "api"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(template, "docs", "api", "index.md"), []byte("# API"), 0644)).To(Succeed())
+	})
+
+	stage := func() string {
+		GinkgoHelper()
+		a := Successful(NewApp(template))
+		DeferCleanup(func() { a.Done() })
+		return filepath.Join(a.tmpDir, a.repo)
+	}
+
+	mode := func(path string) os.FileMode {
+		GinkgoHelper()
+		return Successful(os.Lstat(path)).Mode()
+	}
+
+	It("preserves symbolic links and permissions by default", func() {
+		repo := stage()
+		Expect(mode(filepath.Join(repo, "link.txt")) & os.ModeSymlink).NotTo(BeZero())
+		Expect(os.Readlink(filepath.Join(repo, "link.txt"))).To(Equal("notes.txt"))
+		Expect(mode(filepath.Join(repo, "notes.txt")).Perm()).To(Equal(os.FileMode(0600)))
+		Expect(mode(filepath.Join(repo, "run.sh")).Perm()).To(Equal(os.FileMode(0700)))
+	})
+
+	It("follows symbolic links", func() {
+		StageSymlinks = SymlinksFollow
+		repo := stage()
+		Expect(mode(filepath.Join(repo, "link.txt")).IsRegular()).To(BeTrue())
+		Expect(os.ReadFile(filepath.Join(repo, "link.txt"))).To(Equal([]byte("notes")))
+	})
+
+	It("skips symbolic links", func() {
+		StageSymlinks = SymlinksSkip
+		repo := stage()
+		Expect(filepath.Join(repo, "link.txt")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(repo, "notes.txt")).To(BeARegularFile())
+	})
+
+	It("normalizes permissions", func() {
+		StagePreservePermissions = false
+		repo := stage()
+		Expect(mode(filepath.Join(repo, "notes.txt")).Perm()).To(Equal(os.FileMode(0644)))
+		Expect(mode(filepath.Join(repo, "run.sh")).Perm()).To(Equal(os.FileMode(0755)))
+		Expect(mode(repo).Perm()).To(Equal(os.FileMode(0755)))
+	})
+
+	It("stages only the listed paths", func() {
+		StagePaths = []string{"hellorld/docker-compose.yaml", "hellorld/nginx/"}
+		repo := stage()
+		stage := filepath.Dir(repo)
+		Expect(filepath.Join(stage, DetailsFile)).To(BeARegularFile())
+		Expect(filepath.Join(repo, "nginx", "nginx.json")).To(BeARegularFile())
+		Expect(filepath.Join(repo, "appicon.png")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(stage, "docs")).NotTo(BeAnExistingFile())
+	})
+
+	It("doesn't stage excluded files", func() {
+		Expect(os.WriteFile(filepath.Join(template, "hellorld.app"), nil, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(template, "hellorld.cdx.json"), nil, 0644)).To(Succeed())
+		StageExcludes = []string{
+			filepath.Join(template, "hellorld.app"),
+			filepath.Join(template, "hellorld.cdx.json"),
+		}
+		stage := filepath.Dir(stage())
+		Expect(filepath.Join(stage, "hellorld.app")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(stage, "hellorld.cdx.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(stage, DetailsFile)).To(BeARegularFile())
+	})
+
+	It("rejects stage paths without the compose project", func() {
+		StagePaths = []string{"docs"}
+		Expect(NewApp(template)).Error().To(
+			MatchError(ContainSubstring("lacks Docker compose project file within stage paths")))
+		StagePaths = []string{"../hellorld"}
+		Expect(NewApp(template)).Error().To(
+			MatchError(ContainSubstring(`invalid stage path "../hellorld"`)))
+	})
+
+	It("rejects invalid symbolic link modes", func() {
+		StageSymlinks = "dunno"
+		Expect(NewApp(template)).Error().To(
+			MatchError(ContainSubstring("invalid symbolic link staging mode")))
+	})
+
+})
@@ -0,0 +1,101 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StrictParsing, when true, additionally rejects composer project files
+// containing multiple YAML documents, as well as “detail.json” files
+// containing duplicate keys. Please note that duplicate keys in composer
+// project files are always rejected, regardless of StrictParsing.
+var StrictParsing bool
+
+// checkSingleYAMLDocument returns an error if the specified YAML text contains
+// more than a single YAML document; yaml.Unmarshal otherwise would silently
+// ignore all documents after the first one.
+func checkSingleYAMLDocument(yamltext []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(yamltext))
+	var doc yaml.Node
+	for count := 0; ; count++ {
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("multiple YAML documents, starting again at line %d", doc.Line)
+		}
+	}
+}
+
+// checkJSONDuplicateKeys returns an error if the specified JSON text contains
+// duplicate keys in any of its objects; encoding/json otherwise would silently
+// let the last key win.
+func checkJSONDuplicateKeys(jsontext []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(jsontext))
+	if err := checkJSONValue(decoder, "$"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkJSONValue checks the next JSON value from the decoder for duplicate
+// object keys, recursing into nested arrays and objects.
+func checkJSONValue(decoder *json.Decoder, path string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return nil
+	}
+	switch delim {
+	case '[':
+		for idx := 0; decoder.More(); idx++ {
+			if err := checkJSONValue(decoder, fmt.Sprintf("%s[%d]", path, idx)); err != nil {
+				return err
+			}
+		}
+	case '{':
+		keys := map[string]struct{}{}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string) // object keys are always strings
+			if _, ok := keys[key]; ok {
+				return fmt.Errorf("duplicate key %q in %s", key, path)
+			}
+			keys[key] = struct{}{}
+			if err := checkJSONValue(decoder, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = decoder.Token() // consume closing delimiter
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("strict parsing", Serial, func() {
+
+	strictly := func(strict bool) {
+		old := StrictParsing
+		DeferCleanup(func() { StrictParsing = old })
+		StrictParsing = strict
+	}
+
+	It("always rejects duplicate keys in composer projects", func() {
+		strictly(false)
+		Expect(LoadComposerProject("testdata/strict/duplicate")).Error().To(MatchError(
+			ContainSubstring(`mapping key "image" already defined`)))
+	})
+
+	It("rejects multiple documents in composer projects only when strict", func() {
+		strictly(false)
+		Expect(LoadComposerProject("testdata/strict/multidoc")).Error().NotTo(HaveOccurred())
+		strictly(true)
+		Expect(LoadComposerProject("testdata/strict/multidoc")).Error().To(MatchError(
+			ContainSubstring("multiple YAML documents, starting again at line 5")))
+		Expect(LoadComposerProject("testdata/composer/hellorld")).Error().NotTo(HaveOccurred())
+	})
+
+	It("rejects duplicate keys in detail.json only when strict", func() {
+		GrabLog(logrus.InfoLevel)
+		tmpDirPath := Successful(os.MkdirTemp("", "tiap-test-*"))
+		DeferCleanup(func() { os.RemoveAll(tmpDirPath) })
+		path := filepath.Join(tmpDirPath, "detail.json")
+		details := Successful(os.ReadFile("testdata/strict/details/detail.json"))
+
+		Expect(os.WriteFile(path, details, 0666)).To(Succeed())
+		strictly(true)
+		Expect(setDetails(path, "hellorld", "1.2.3", "", "")).To(MatchError(
+			ContainSubstring(`duplicate key "title" in $`)))
+		strictly(false)
+		Expect(setDetails(path, "hellorld", "1.2.3", "", "")).To(Succeed())
+
+		strictly(true)
+		Expect(os.WriteFile(path, Successful(os.ReadFile("testdata/details/good/detail.json")), 0666)).
+			To(Succeed())
+		Expect(setDetails(path, "hellorld", "1.2.3", "", "")).To(Succeed())
+	})
+
+	DescribeTable("checking JSON for duplicate keys",
+		func(jsontext string, errmsg string) {
+			err := checkJSONDuplicateKeys([]byte(jsontext))
+			if errmsg == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(errmsg)))
+		},
+		Entry(nil, `42`, ""),
+		Entry(nil, `{"foo": [{"bar": 1}, {"bar": 2}], "baz": {"bar": 3}}`, ""),
+		Entry(nil, `{"foo": 1, "foo": 2}`, `duplicate key "foo" in $`),
+		Entry(nil, `{"foo": [{}, {"bar": 1, "bar": 2}]}`, `duplicate key "bar" in $.foo[1]`),
+		Entry(nil, `{"foo": {"bar": {"baz": 1, "baz": 2}}}`, `duplicate key "baz" in $.foo.bar`),
+	)
+
+	It("reports malformed JSON", func() {
+		for _, jsontext := range []string{`{"foo": `, `[1, `, `{"foo": 1`} {
+			Expect(checkJSONDuplicateKeys([]byte(jsontext))).NotTo(Succeed())
+		}
+	})
+
+})
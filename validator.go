@@ -0,0 +1,63 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RunValidator runs the specified external validator command on the staged
+// app, for checking organization-specific policies. The command is split at
+// whitespace into the executable and its arguments, with the path of the
+// staging directory appended as the final argument. Additionally, the
+// environment variables TIAP_STAGE_DIR, TIAP_REPO, and TIAP_COMPOSE_FILE
+// point to the staging directory, the app repository subdirectory inside it,
+// and the staged composer project file. A zero exit code passes validation,
+// while any non-zero exit code fails validation, with the validator's stderr
+// output becoming part of the returned error. RunValidator should be called
+// after PullAndWriteCompose, and before Package.
+func (a *App) RunValidator(ctx context.Context, command string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("empty validator command")
+	}
+	log.Info(fmt.Sprintf("👮  running external validator %q", command))
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], a.tmpDir)...)
+	cmd.Env = append(os.Environ(),
+		"TIAP_STAGE_DIR="+a.tmpDir,
+		"TIAP_REPO="+a.repo,
+		"TIAP_COMPOSE_FILE="+filepath.Join(a.tmpDir, a.repo, "docker-compose.yml"))
+	var stderr bytes.Buffer
+	cmd.Stdout = os.Stderr // don't mess up our own stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("external validator %q failed with exit code %d: %s",
+				command, exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("cannot run external validator %q, reason: %w", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 by Harald Albrecht
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package tiap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("external validators", func() {
+
+	var a *App
+	var scriptDir string
+
+	BeforeEach(func() {
+		GrabLog(logrus.InfoLevel)
+		a = Successful(NewApp("testdata/app"))
+		DeferCleanup(func() { a.Done() })
+		scriptDir = GinkgoT().TempDir()
+	})
+
+	script := func(name string, body string) string {
+		GinkgoHelper()
+		path := filepath.Join(scriptDir, name)
+		Expect(os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0777)).To(Succeed())
+		return path
+	}
+
+	It("passes", func(ctx context.Context) {
+		validator := script("pass",
+			`echo "$1 $2 $TIAP_STAGE_DIR $TIAP_REPO $TIAP_COMPOSE_FILE" > "$0.out"`)
+		Expect(a.RunValidator(ctx, validator+" --strict")).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(scriptDir, "pass.out"))).To(Equal([]byte(
+			"--strict " + a.tmpDir + " " + a.tmpDir + " hellorld " +
+				filepath.Join(a.tmpDir, "hellorld", "docker-compose.yml") + "\n")))
+	})
+
+	It("fails with the validator's stderr", func(ctx context.Context) {
+		validator := script("fail", "echo 'policy violated' >&2\nexit 3\n")
+		Expect(a.RunValidator(ctx, validator)).To(MatchError(
+			HaveSuffix("failed with exit code 3: policy violated")))
+	})
+
+	It("reports invalid validators", func(ctx context.Context) {
+		Expect(a.RunValidator(ctx, "  ")).To(MatchError("empty validator command"))
+		Expect(a.RunValidator(ctx, filepath.Join(scriptDir, "nada-nothing-nil"))).To(
+			MatchError(ContainSubstring("cannot run external validator")))
+	})
+
+})